@@ -2,22 +2,60 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/araddon/dateparse"
 	"github.com/danesparza/appliance-monitor/data"
-	"github.com/spf13/viper"
+	"github.com/danesparza/appliance-monitor/export"
 )
 
+// ActivityAPI represents the activity and energy API routes
+type ActivityAPI struct {
+	// Store is the open datastore
+	Store *data.Store
+}
+
 // ActivityRequest represents an API request for activity
 type ActivityRequest struct {
 	StartTime string `json:"starttime"`
 	EndTime   string `json:"endtime"`
+	DeviceID  string `json:"deviceId"`
+
+	// Limit, Before, After and NewestFirst page through the activity.  If none
+	// of them are set, all the activity is returned at once
+	Limit       int    `json:"limit"`
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	NewestFirst bool   `json:"newestfirst"`
+}
+
+// paged returns true if the request asks for a page of activity
+func (r ActivityRequest) paged() bool {
+	return r.Limit > 0 || r.Before != "" || r.After != "" || r.NewestFirst
+}
+
+// pageRequest creates the datastore request for a page of activity
+func (r ActivityRequest) pageRequest(starttime, endtime time.Time) data.PageRequest {
+	return data.PageRequest{
+		DeviceID:    r.DeviceID,
+		StartTime:   starttime,
+		EndTime:     endtime,
+		Before:      r.Before,
+		After:       r.After,
+		Limit:       r.Limit,
+		NewestFirst: r.NewestFirst,
+	}
 }
 
 // GetActivityInRange gets activity for the appliance for a given time range
-func GetActivityInRange(rw http.ResponseWriter, req *http.Request) {
+func (a *ActivityAPI) GetActivityInRange(rw http.ResponseWriter, req *http.Request) {
 	//	req.Body is a ReadCloser -- we need to remember to close it:
 	defer req.Body.Close()
 
@@ -43,11 +81,16 @@ func GetActivityInRange(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	//	Get the activity datastore:
-	activityDB := data.ActivityDB{
-		Database: viper.GetString("datastore.activity")}
+	activityDB := a.Store.Activity
+
+	//	If we're paging, just get the page:
+	if request.paged() {
+		sendActivityPage(rw, activityDB, request.pageRequest(starttime, endtime))
+		return
+	}
 
 	//	Send the request to the datastore and get a response:
-	response, err := activityDB.GetRange(starttime, endtime)
+	response, err := activityDB.GetRange(request.DeviceID, starttime, endtime)
 	if err != nil {
 		sendErrorResponse(rw, err, http.StatusInternalServerError)
 		return
@@ -58,14 +101,148 @@ func GetActivityInRange(rw http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(rw).Encode(response)
 }
 
-// GetAllActivity gets activity for the appliance for a given time range
-func GetAllActivity(rw http.ResponseWriter, req *http.Request) {
+// GetAllActivity gets all activity.  Pass the 'device' query parameter to
+// only get activity for that device.  Pass 'limit', 'before', 'after' or
+// 'newestfirst' to get a page of activity instead
+func (a *ActivityAPI) GetAllActivity(rw http.ResponseWriter, req *http.Request) {
 	//	Get the activity datastore:
-	activityDB := data.ActivityDB{
-		Database: viper.GetString("datastore.activity")}
+	activityDB := a.Store.Activity
+
+	//	Read the query:
+	query := req.URL.Query()
+	request := ActivityRequest{
+		DeviceID: query.Get("device"),
+		Before:   query.Get("before"),
+		After:    query.Get("after"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid limit: %v", value), http.StatusBadRequest)
+			return
+		}
+		request.Limit = limit
+	}
+
+	if value := query.Get("newestfirst"); value != "" {
+		newestFirst, err := strconv.ParseBool(value)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid newestfirst: %v", value), http.StatusBadRequest)
+			return
+		}
+		request.NewestFirst = newestFirst
+	}
+
+	//	If we're paging, just get the page:
+	if request.paged() {
+		sendActivityPage(rw, activityDB, request.pageRequest(time.Time{}, time.Time{}))
+		return
+	}
 
 	//	Send the request to the datastore and get a response:
-	response, err := activityDB.GetAllActivity()
+	response, err := activityDB.GetAllActivity(request.DeviceID)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetCyclesInRange gets device cycles that started in a given time range
+func (a *ActivityAPI) GetCyclesInRange(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	The default request:
+	starttime := time.Now().Add(-24 * time.Hour)
+	endtime := time.Now()
+
+	//	Decode the POST body:
+	request := ActivityRequest{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Parse the dates from many different formats: https://github.com/araddon/dateparse
+	if t, err := dateparse.ParseAny(request.StartTime); err == nil {
+		starttime = t
+	}
+
+	if t, err := dateparse.ParseAny(request.EndTime); err == nil {
+		endtime = t
+	}
+
+	//	Get the activity datastore:
+	activityDB := a.Store.Activity
+
+	//	Send the request to the datastore and get a response:
+	response, err := activityDB.GetCycles(request.DeviceID, starttime, endtime)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// DeleteActivityInRange removes activity in a given time range.  Both the start
+// and end time are required.  Cycles aren't removed
+func (a *ActivityAPI) DeleteActivityInRange(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the body:
+	request := ActivityRequest{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Don't guess at what to delete:
+	starttime, err := dateparse.ParseAny(request.StartTime)
+	if err != nil {
+		sendErrorResponse(rw, fmt.Errorf("A valid starttime is required"), http.StatusBadRequest)
+		return
+	}
+
+	endtime, err := dateparse.ParseAny(request.EndTime)
+	if err != nil {
+		sendErrorResponse(rw, fmt.Errorf("A valid endtime is required"), http.StatusBadRequest)
+		return
+	}
+
+	if endtime.Before(starttime) {
+		sendErrorResponse(rw, fmt.Errorf("The endtime can't be before the starttime"), http.StatusBadRequest)
+		return
+	}
+
+	//	Send the request to the datastore:
+	if err := a.Store.Activity.DeleteRange(request.DeviceID, starttime, endtime); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(fmt.Sprintf("Removed activity from %s to %s", starttime.Format(time.RFC3339), endtime.Format(time.RFC3339)))
+}
+
+// sendActivityPage gets a page of activity and sends it
+func sendActivityPage(rw http.ResponseWriter, activityDB *data.ActivityDB, request data.PageRequest) {
+	response, err := activityDB.GetPage(request)
+	if err == data.ErrInvalidCursor || err == data.ErrBeforeAndAfter {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		sendErrorResponse(rw, err, http.StatusInternalServerError)
 		return
@@ -75,3 +252,132 @@ func GetAllActivity(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(rw).Encode(response)
 }
+
+// ExportActivity exports activity and cycles.  Pass the 'format' query parameter
+// (csv, jsonl or ics), and optionally 'device', 'starttime' and 'endtime'
+func (a *ActivityAPI) ExportActivity(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	//	The default request:
+	format := query.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	starttime := time.Time{}
+	endtime := time.Now()
+
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		sendErrorResponse(rw, fmt.Errorf("Unknown export format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	//	Parse the dates from many different formats: https://github.com/araddon/dateparse
+	if value := query.Get("starttime"); value != "" {
+		t, err := dateparse.ParseAny(value)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid starttime: %v", value), http.StatusBadRequest)
+			return
+		}
+		starttime = t
+	}
+
+	if value := query.Get("endtime"); value != "" {
+		t, err := dateparse.ParseAny(value)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid endtime: %v", value), http.StatusBadRequest)
+			return
+		}
+		endtime = t
+	}
+
+	//	Get the activity to export:
+	response, err := export.Load(a.Store, query.Get("device"), starttime, endtime)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Write it out:
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "appliance-monitor-activity."+format))
+	if err := export.Write(rw, format, response); err != nil {
+		log.Printf("[ERROR] Problem exporting activity: %v", err)
+	}
+}
+
+// maxImportSize is the largest file that can be imported
+const maxImportSize = 64 << 20
+
+// ImportActivity imports activity and cycles exported as CSV or JSON Lines.  The
+// file can be sent as the request body, or as the 'file' file in a multipart form.
+// Pass the 'format' query parameter if it can't be told from the content type or
+// file name, and 'dryrun=true' to see what would be imported without storing anything
+func (a *ActivityAPI) ImportActivity(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+	req.Body = http.MaxBytesReader(rw, req.Body, maxImportSize)
+
+	query := req.URL.Query()
+
+	dryRun := false
+	if value := query.Get("dryrun"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid dryrun: %v", value), http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	//	Find the upload, and what format it's in:
+	var upload io.Reader = req.Body
+	format := query.Get("format")
+	if format == "" {
+		format = importFormat(req.Header.Get("Content-Type"))
+	}
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := req.FormFile("file")
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		upload = file
+
+		if query.Get("format") == "" {
+			format = strings.TrimPrefix(path.Ext(header.Filename), ".")
+		}
+	}
+
+	//	Read it:
+	records, err := export.Read(upload, format)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Send the request to the datastore and get a response:
+	response, err := a.Store.Activity.Import(records.Activities, records.Cycles, dryRun)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// importFormat gets the import format from a content type
+func importFormat(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return export.FormatCSV
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		return export.FormatJSONLines
+	}
+
+	return ""
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/gorilla/mux"
+)
+
+// AuthAPI represents the authentication API routes
+type AuthAPI struct {
+	// Store is the open datastore
+	Store *data.Store
+}
+
+// PasswordRequest describes a request to set the admin password
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// TokenRequest describes a request to create an API token
+type TokenRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// TokenResponse is a newly created API token.  Token is only ever returned here
+type TokenResponse struct {
+	data.APIToken
+	Token string `json:"token"`
+}
+
+// Setup sets the admin password on first run.  Once it's set, it can only
+// be changed with ChangePassword
+func (a *AuthAPI) Setup(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := PasswordRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	err := a.Store.Config.SetupAdminPassword(request.Password)
+	if err == data.ErrAdminPasswordSet {
+		sendErrorResponse(rw, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode("Admin password set")
+}
+
+// ChangePassword changes the admin password
+func (a *AuthAPI) ChangePassword(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := PasswordRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.Store.Config.SetAdminPassword(request.Password); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode("Admin password changed")
+}
+
+// GetAllTokens gets all API tokens (without their values) and returns them in JSON format
+func (a *AuthAPI) GetAllTokens(rw http.ResponseWriter, req *http.Request) {
+	response, err := a.Store.Config.GetAllTokens()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// CreateToken creates an API token and returns it in JSON format.  This is
+// the only time the token value is returned
+func (a *AuthAPI) CreateToken(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := TokenRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(request.Name) == "" {
+		sendErrorResponse(rw, errors.New("Token name can't be blank"), http.StatusBadRequest)
+		return
+	}
+
+	if !data.ValidScope(request.Scope) {
+		sendErrorResponse(rw, fmt.Errorf("Unknown scope: %s", request.Scope), http.StatusBadRequest)
+		return
+	}
+
+	token, value, err := a.Store.Config.CreateToken(request.Name, request.Scope)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(TokenResponse{APIToken: token, Token: value})
+}
+
+// RemoveToken revokes an API token
+func (a *AuthAPI) RemoveToken(rw http.ResponseWriter, req *http.Request) {
+	//	Get the token id from the request:
+	id := mux.Vars(req)["id"]
+
+	if err := a.Store.Config.RemoveToken(id); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(fmt.Sprintf("Removed %s", id))
+}
+
+// SessionCookie is the name of the UI login session cookie
+const SessionCookie = "am_session"
+
+// Principal is who made a request
+type Principal struct {
+	// Username is the user that logged in.  It's blank for API tokens
+	Username string `json:"username"`
+
+	// Role is the user's role.  It's blank for API tokens
+	Role string `json:"role"`
+
+	// Scope is what the request is allowed to do (read / write / admin)
+	Scope string `json:"scope"`
+}
+
+// principalKey is the request context key for the Principal
+type principalKey struct{}
+
+// CurrentPrincipal gets who made the request.  It's empty for public requests
+// that didn't send credentials
+func CurrentPrincipal(req *http.Request) Principal {
+	principal, _ := req.Context().Value(principalKey{}).(Principal)
+	return principal
+}
+
+// Authenticator checks the credentials on each request against the scope the
+// route needs.  Requests can use a bearer token, the UI session cookie, or basic
+// auth with a username and password.  Browsers can't set headers on websocket and
+// event stream connections, so the token can also be sent as the access_token parameter.
+// Clients that keep sending wrong passwords have to wait before trying again
+type Authenticator struct {
+	// Store is the open datastore
+	Store *data.Store
+
+	// PublicRead lets anyone use the read-only routes
+	PublicRead bool
+}
+
+// Handler wraps the router with authentication
+func (a Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		needed := requiredScope(req)
+
+		principal, err := a.principal(req)
+		if err == nil {
+			req = req.WithContext(context.WithValue(req.Context(), principalKey{}, principal))
+		}
+
+		if needed == "" || (needed == data.ScopeRead && a.PublicRead) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		if err == data.ErrInvalidCredentials {
+			//	Point people at setup if there's no way to log in yet:
+			if hasPassword, _ := a.Store.Config.HasAdminPassword(); !hasPassword {
+				err = errors.New("The admin password hasn't been set.  Set it with POST /auth/setup")
+			}
+
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="appliance-monitor"`)
+			sendErrorResponse(rw, err, http.StatusUnauthorized)
+			return
+		}
+		if backoff, ok := err.(backoffError); ok {
+			sendBackoffResponse(rw, backoff)
+			return
+		}
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+
+		if !data.ScopeAllows(principal.Scope, needed) {
+			sendErrorResponse(rw, fmt.Errorf("This needs %s access", needed), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// principal finds who sent the request from its credentials
+func (a Authenticator) principal(req *http.Request) (Principal, error) {
+	configDB := a.Store.Config
+
+	//	A username and password:
+	if username, password, ok := req.BasicAuth(); ok {
+		user, err := checkUserPassword(configDB, req, username, password)
+		if err != nil {
+			return Principal{}, err
+		}
+
+		return userPrincipal(user), nil
+	}
+
+	//	An API token:
+	value := req.URL.Query().Get("access_token")
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		value = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	if value != "" {
+		token, err := configDB.CheckToken(value)
+		if err != nil {
+			return Principal{}, err
+		}
+
+		return Principal{Scope: token.Scope}, nil
+	}
+
+	//	A UI session:
+	if cookie, err := req.Cookie(SessionCookie); err == nil {
+		user, err := configDB.CheckSession(cookie.Value)
+		if err != nil {
+			return Principal{}, err
+		}
+
+		return userPrincipal(user), nil
+	}
+
+	return Principal{}, data.ErrInvalidCredentials
+}
+
+// userPrincipal gets the Principal for a logged in user
+func userPrincipal(user data.User) Principal {
+	return Principal{Username: user.Username, Role: user.Role, Scope: data.RoleScope(user.Role)}
+}
+
+// requiredScope gets the scope a request needs.  Blank means anyone can make it.
+// Versioned paths need the same scope as their unversioned aliases
+func requiredScope(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, APIVersionPrefix)
+	if path != req.URL.Path && path != "" && !strings.HasPrefix(path, "/") {
+		path = req.URL.Path
+	}
+
+	switch {
+	//	The UI, first run setup, logging in and the API description are open to anyone:
+	case path == "/" || path == "/ui" || strings.HasPrefix(path, "/ui/"),
+		path == "/auth/setup", path == "/auth/login", path == "/auth/logout",
+		path == "/openapi.json":
+		return ""
+
+	//	CORS preflight requests don't carry credentials:
+	case req.Method == http.MethodOptions:
+		return ""
+
+	//	Anyone logged in can see (and change the password for) their own account:
+	case path == "/auth/me" || strings.HasPrefix(path, "/auth/me/"):
+		return data.ScopeRead
+
+	//	Anything that manages access, the network, or the whole database:
+	case strings.HasPrefix(path, "/auth/"),
+		strings.HasPrefix(path, "/reset/"),
+		path == "/system/wifi",
+		path == "/system/network",
+		path == "/system/backup",
+		path == "/system/restore":
+		return data.ScopeAdmin
+
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		return data.ScopeRead
+
+	//	Queries that are sent as a POST:
+	case path == "/activity" && req.Method == http.MethodPost,
+		path == "/activity/cycles",
+		path == "/activity/stats":
+		return data.ScopeRead
+
+	//	Anyone logged in can manage their own notification subscribers:
+	case path == "/subscribers" || strings.HasPrefix(path, "/subscribers/"):
+		return data.ScopeRead
+	}
+
+	//	Everything else changes config or history:
+	return data.ScopeAdmin
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	Each route should need the right scope, with or without the version prefix
+func TestRequiredScope_Routes_MatchScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		//	Public routes:
+		{"GET", "/", ""},
+		{"GET", "/ui/index.html", ""},
+		{"POST", "/auth/setup", ""},
+		{"POST", "/v1/auth/setup", ""},
+		{"POST", "/v1/auth/login", ""},
+		{"POST", "/auth/logout", ""},
+		{"GET", "/v1/openapi.json", ""},
+		{"OPTIONS", "/v1/config", ""},
+
+		//	The user's own account:
+		{"GET", "/auth/me", data.ScopeRead},
+		{"POST", "/v1/auth/me/password", data.ScopeRead},
+
+		//	Reading and queries:
+		{"GET", "/activity", data.ScopeRead},
+		{"GET", "/v1/devices/washer", data.ScopeRead},
+		{"POST", "/v1/activity", data.ScopeRead},
+		{"POST", "/v1/activity/stats", data.ScopeRead},
+		{"POST", "/subscribers", data.ScopeRead},
+		{"POST", "/v1/subscribers/1/test", data.ScopeRead},
+
+		//	Admin routes:
+		{"GET", "/auth/tokens", data.ScopeAdmin},
+		{"GET", "/v1/auth/users", data.ScopeAdmin},
+		{"GET", "/v1/system/wifi", data.ScopeAdmin},
+		{"POST", "/system/network", data.ScopeAdmin},
+		{"GET", "/v1/system/backup", data.ScopeAdmin},
+		{"POST", "/v1/reset/config", data.ScopeAdmin},
+		{"POST", "/v1/config", data.ScopeAdmin},
+		{"DELETE", "/activity", data.ScopeAdmin},
+		{"DELETE", "/v1/devices/washer", data.ScopeAdmin},
+
+		//	Paths that only look versioned aren't public:
+		{"POST", "/v1auth/setup", data.ScopeAdmin},
+		{"GET", "/v1", data.ScopeRead},
+	}
+
+	for _, test := range tests {
+		//	Arrange
+		req, _ := http.NewRequest(test.method, test.path, nil)
+
+		//	Act
+		got := requiredScope(req)
+
+		//	Assert
+		if got != test.want {
+			t.Errorf("requiredScope failed: %s %s should need '%s', but got '%s'", test.method, test.path, test.want, got)
+		}
+	}
+}
+
+//	Clients that keep sending wrong passwords should wait longer and longer,
+//	without slowing anyone else down
+func TestFailureBackoff_RepeatedFailures_WaitGrows(t *testing.T) {
+	//	Arrange
+	backoff := newFailureBackoff()
+	now := time.Now()
+
+	//	Act
+	for i := 0; i < backoffFreeFailures; i++ {
+		backoff.failed("10.0.0.2", now)
+	}
+	free := backoff.wait("10.0.0.2", now)
+
+	backoff.failed("10.0.0.2", now)
+	first := backoff.wait("10.0.0.2", now)
+
+	backoff.failed("10.0.0.2", now)
+	second := backoff.wait("10.0.0.2", now)
+
+	other := backoff.wait("10.0.0.3", now)
+
+	backoff.succeeded("10.0.0.2")
+	reset := backoff.wait("10.0.0.2", now)
+
+	//	Assert
+	if free != 0 {
+		t.Errorf("Backoff failed: The first few failures shouldn't have to wait, but got %v", free)
+	}
+
+	if first != time.Second || second != 2*time.Second {
+		t.Errorf("Backoff failed: The wait should double with each failure, but got %v then %v", first, second)
+	}
+
+	if other != 0 {
+		t.Errorf("Backoff failed: Other clients shouldn't have to wait, but got %v", other)
+	}
+
+	if reset != 0 {
+		t.Errorf("Backoff failed: The right password should reset the wait, but got %v", reset)
+	}
+}
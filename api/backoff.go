@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// How many wrong passwords a client can send before it has to wait, the
+// longest it has to wait, and how long until its failures are forgotten
+var (
+	backoffFreeFailures = 5
+	backoffMaxWait      = 5 * time.Minute
+	backoffForget       = 15 * time.Minute
+)
+
+// passwordBackoff tracks wrong passwords for the login and basic auth checks
+var passwordBackoff = newFailureBackoff()
+
+// backoffError is returned when a client has to wait before trying another password
+type backoffError struct {
+	wait time.Duration
+}
+
+func (err backoffError) Error() string {
+	return fmt.Sprintf("Too many wrong passwords.  Try again in %v", err.wait)
+}
+
+// failureBackoff makes clients that keep sending wrong passwords wait longer
+// and longer between tries, so passwords can't be guessed quickly
+type failureBackoff struct {
+	mu      sync.Mutex
+	clients map[string]*clientFailures
+}
+
+// clientFailures are the recent wrong passwords from a client
+type clientFailures struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+func newFailureBackoff() *failureBackoff {
+	return &failureBackoff{clients: map[string]*clientFailures{}}
+}
+
+// wait returns how long the client has to wait before trying again
+func (b *failureBackoff) wait(client string, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failures, found := b.clients[client]; found && failures.until.After(now) {
+		return failures.until.Sub(now)
+	}
+
+	return 0
+}
+
+// failed records a wrong password.  After the free failures, the wait
+// doubles with each one, starting at a second
+func (b *failureBackoff) failed(client string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	//	Forget clients that stopped trying:
+	for key, failures := range b.clients {
+		if now.Sub(failures.last) > backoffForget {
+			delete(b.clients, key)
+		}
+	}
+
+	failures, found := b.clients[client]
+	if !found {
+		failures = &clientFailures{}
+		b.clients[client] = failures
+	}
+
+	failures.count++
+	failures.last = now
+
+	if extra := failures.count - backoffFreeFailures; extra > 0 {
+		wait := backoffMaxWait
+		if extra < 20 && time.Second<<uint(extra-1) < backoffMaxWait {
+			wait = time.Second << uint(extra-1)
+		}
+		failures.until = now.Add(wait)
+	}
+}
+
+// succeeded forgets the client's wrong passwords
+func (b *failureBackoff) succeeded(client string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.clients, client)
+}
+
+// checkUserPassword checks a username and password like
+// ConfigDB.CheckUserPassword, but turns the client away with a backoffError
+// if it's sent too many wrong passwords
+func checkUserPassword(configDB *data.ConfigDB, req *http.Request, username, password string) (data.User, error) {
+	client, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		client = req.RemoteAddr
+	}
+
+	if wait := passwordBackoff.wait(client, time.Now()); wait > 0 {
+		return data.User{}, backoffError{wait: (wait + time.Second - 1).Truncate(time.Second)}
+	}
+
+	user, err := configDB.CheckUserPassword(username, password)
+	switch err {
+	case nil:
+		passwordBackoff.succeeded(client)
+	case data.ErrInvalidCredentials:
+		passwordBackoff.failed(client, time.Now())
+	}
+
+	return user, err
+}
+
+// sendBackoffResponse tells the client how long to wait before trying again
+func sendBackoffResponse(rw http.ResponseWriter, err backoffError) {
+	rw.Header().Set("Retry-After", fmt.Sprintf("%d", int(err.wait/time.Second)))
+	sendErrorResponse(rw, err, http.StatusTooManyRequests)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CaptivePortal sends browsers on the setup network to the UI.  Phones and
+// laptops check for a captive portal by loading a page from a well known
+// host when they join a network.  The setup network answers every DNS lookup
+// with the monitor's address, so those requests end up here and get redirected
+type CaptivePortal struct {
+	// Active returns true while the portal should redirect
+	Active func() bool
+
+	// Address is the monitor's address on the setup network
+	Address string
+
+	// Hosts are other names the monitor answers to
+	Hosts []string
+}
+
+// Handler redirects requests for other hosts to the UI while the portal is active
+func (c CaptivePortal) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if c.Active == nil || !c.Active() || c.isMonitor(req.Host) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		http.Redirect(rw, req, "http://"+c.Address+"/ui/", http.StatusFound)
+	})
+}
+
+// isMonitor returns true if the host is one of the monitor's own names
+func (c CaptivePortal) isMonitor(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+
+	if host == "" || host == c.Address {
+		return true
+	}
+
+	for _, name := range c.Hosts {
+		if strings.EqualFold(host, name) {
+			return true
+		}
+	}
+
+	return false
+}
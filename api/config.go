@@ -8,11 +8,12 @@ import (
 
 	"github.com/danesparza/appliance-monitor/data"
 	"github.com/gorilla/mux"
-	"github.com/spf13/viper"
 )
 
 // ConfigAPI represents the configuration API routes
 type ConfigAPI struct {
+	// Store is the open datastore
+	Store *data.Store
 
 	// Updated signals when the configuration has been updated
 	Updated chan bool
@@ -22,8 +23,7 @@ type ConfigAPI struct {
 func (c *ConfigAPI) GetAllConfig(rw http.ResponseWriter, req *http.Request) {
 
 	//	Connect to the datastore:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := c.Store.Config
 
 	response, err := configDB.GetAll()
 
@@ -32,18 +32,27 @@ func (c *ConfigAPI) GetAllConfig(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	//	Secrets are write-only:
+	response = redactConfigItems(response)
+
 	//	Serialize to JSON & return the response:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(rw).Encode(response)
 }
 
+// GetConfigSchema gets the known settings and returns them in JSON format
+func (c *ConfigAPI) GetConfigSchema(rw http.ResponseWriter, req *http.Request) {
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(data.Settings)
+}
+
 // GetConfigItem gets a single configuration and returns it in JSON format.
 // If the item can't be found, returns an empty config item
 func (c *ConfigAPI) GetConfigItem(rw http.ResponseWriter, req *http.Request) {
 
 	//	Connect to the datastore:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := c.Store.Config
 
 	//	Get the config name from the request:
 	configName := mux.Vars(req)["name"]
@@ -58,19 +67,23 @@ func (c *ConfigAPI) GetConfigItem(rw http.ResponseWriter, req *http.Request) {
 
 	//	Serialize to JSON & return the response:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(rw).Encode(response)
+	json.NewEncoder(rw).Encode(data.RedactConfigItem(response))
 }
 
 // RemoveConfigItem removes a single config item
 func (c *ConfigAPI) RemoveConfigItem(rw http.ResponseWriter, req *http.Request) {
 
 	//	Get the config datastore:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := c.Store.Config
 
 	//	Get the config name from the request:
 	configName := mux.Vars(req)["name"]
 
+	if data.IsReadOnly(configName) {
+		sendErrorResponse(rw, fmt.Errorf("%s can't be changed", configName), http.StatusBadRequest)
+		return
+	}
+
 	//	Send the request to the datastore and get a response:
 	err := configDB.Remove(configName)
 	if err != nil {
@@ -96,9 +109,32 @@ func (c *ConfigAPI) SetConfigItem(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	//	Make sure it's a setting we know about, and can change:
+	if err := data.ValidateConfigItem(request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	if data.IsReadOnly(request.Name) {
+		sendErrorResponse(rw, fmt.Errorf("%s can't be changed", request.Name), http.StatusBadRequest)
+		return
+	}
+
 	//	Get the config datastore:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := c.Store.Config
+
+	//	A redacted secret is being sent back unchanged, so leave it alone:
+	if unchangedSecret(request) {
+		response, err := configDB.Get(request.Name)
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(rw).Encode(data.RedactConfigItem(response))
+		return
+	}
 
 	//	Send the request to the datastore and get a response:
 	response, err := configDB.Set(request)
@@ -111,7 +147,7 @@ func (c *ConfigAPI) SetConfigItem(rw http.ResponseWriter, req *http.Request) {
 
 	//	Serialize to JSON & return the response:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(rw).Encode(response)
+	json.NewEncoder(rw).Encode(data.RedactConfigItem(response))
 }
 
 // SetAllConfigItems adds or updates multiple config items and returns all config items in JSON format
@@ -128,11 +164,40 @@ func (c *ConfigAPI) SetAllConfigItems(rw http.ResponseWriter, req *http.Request)
 	}
 
 	//	Get the config datastore:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := c.Store.Config
+
+	//	Check all the items before we set any of them.  Read-only settings
+	//	can be sent back, as long as they haven't changed:
+	readOnly := map[string]bool{}
+	for _, item := range request {
+		if err := data.ValidateConfigItem(item); err != nil {
+			sendErrorResponse(rw, err, http.StatusBadRequest)
+			return
+		}
+
+		if data.IsReadOnly(item.Name) {
+			current, err := configDB.Get(item.Name)
+			if err != nil {
+				sendErrorResponse(rw, err, http.StatusInternalServerError)
+				return
+			}
+
+			if item.Value != current.Value {
+				sendErrorResponse(rw, fmt.Errorf("%s can't be changed", item.Name), http.StatusBadRequest)
+				return
+			}
+
+			readOnly[item.Name] = true
+		}
+	}
 
 	//	Send each request to the datastore and get a response:
 	for c := 0; c < len(request); c++ {
+		//	Skip secrets that are being sent back unchanged, and read-only settings:
+		if unchangedSecret(request[c]) || readOnly[request[c].Name] {
+			continue
+		}
+
 		//	Set the config item:
 		_, err := configDB.Set(request[c])
 		if err != nil {
@@ -147,8 +212,25 @@ func (c *ConfigAPI) SetAllConfigItems(rw http.ResponseWriter, req *http.Request)
 		sendErrorResponse(rw, err, http.StatusInternalServerError)
 		return
 	}
+	response = redactConfigItems(response)
 
 	//	Serialize to JSON & return the response:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(rw).Encode(response)
 }
+
+// unchangedSecret returns true if the item is a secret that was read back
+// (redacted) from the API and is being sent back without a new value
+func unchangedSecret(item data.ConfigItem) bool {
+	return data.IsSecret(item.Name) && item.Value == data.RedactedValue
+}
+
+// redactConfigItems hides the values of any secrets in the list
+func redactConfigItems(items []data.ConfigItem) []data.ConfigItem {
+	retval := make([]data.ConfigItem, len(items))
+	for i, item := range items {
+		retval[i] = data.RedactConfigItem(item)
+	}
+
+	return retval
+}
@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/api"
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	The deviceID can be sent back with the rest of the config, but not changed
+func TestConfig_ReadOnlySetting_CantBeChanged(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store, err := data.OpenStore("testing.db", "testactivity.db", time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the store: %v", err)
+	}
+	defer store.Close()
+
+	store.Config.Set(data.ConfigItem{Name: "deviceID", Value: "original"})
+
+	server := &api.Server{Config: &api.ConfigAPI{Store: store, Updated: make(chan bool, 10)}, Store: store}
+	router := server.Router()
+
+	send := func(method, path, body string) int {
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rw.Code
+	}
+
+	//	Act
+	setOne := send("POST", "/v1/config/deviceID", `{"name": "deviceID", "value": "changed"}`)
+	setAllChanged := send("POST", "/v1/config", `[{"name": "deviceID", "value": "changed"}, {"name": "name", "value": "laundry"}]`)
+	setAllUnchanged := send("POST", "/v1/config", `[{"name": "deviceID", "value": "original"}, {"name": "name", "value": "laundry"}]`)
+	remove := send("DELETE", "/v1/config/deviceID", "")
+
+	deviceID, _ := store.Config.Get("deviceID")
+	name, _ := store.Config.Get("name")
+
+	//	Assert
+	if setOne != http.StatusBadRequest || setAllChanged != http.StatusBadRequest || remove != http.StatusBadRequest {
+		t.Errorf("Config failed: Changing the deviceID should be rejected, but got %v / %v / %v", setOne, setAllChanged, remove)
+	}
+
+	if setAllUnchanged != http.StatusOK || name.Value != "laundry" {
+		t.Errorf("Config failed: Sending the deviceID back unchanged should be allowed, but got %v / %+v", setAllUnchanged, name)
+	}
+
+	if deviceID.Value != "original" {
+		t.Errorf("Config failed: The deviceID shouldn't have changed: %+v", deviceID)
+	}
+}
@@ -3,13 +3,14 @@ package api
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type connection struct {
 	// Buffered channel of outbound messages.
-	send chan []byte
+	send chan HubMessage
 
 	// The Hub.
 	h *Hub
@@ -22,14 +23,14 @@ func (c *connection) reader(wg *sync.WaitGroup, wsConn *websocket.Conn) {
 		if err != nil {
 			break
 		}
-		c.h.Broadcast <- message
+		c.h.Broadcast <- HubMessage{Time: time.Now(), Data: message}
 	}
 }
 
 func (c *connection) writer(wg *sync.WaitGroup, wsConn *websocket.Conn) {
 	defer wg.Done()
 	for message := range c.send {
-		err := wsConn.WriteMessage(websocket.TextMessage, message)
+		err := wsConn.WriteMessage(websocket.TextMessage, message.Data)
 		if err != nil {
 			break
 		}
@@ -52,7 +53,7 @@ func (wsh WsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Printf("error upgrading %s", err) */
 		return
 	}
-	c := &connection{send: make(chan []byte, 256), h: wsh.H}
+	c := &connection{send: make(chan HubMessage, 256), h: wsh.H}
 	c.h.addConnection(c)
 	defer c.h.removeConnection(c)
 	var wg sync.WaitGroup
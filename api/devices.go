@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/gorilla/mux"
+)
+
+// DeviceAPI represents the device API routes
+type DeviceAPI struct {
+	// Store is the open datastore
+	Store *data.Store
+
+	// Updated signals when a device has been added, updated or removed
+	Updated chan bool
+}
+
+// GetAllDevices gets all devices and returns them in JSON format
+func (d *DeviceAPI) GetAllDevices(rw http.ResponseWriter, req *http.Request) {
+
+	//	Connect to the datastore:
+	configDB := d.Store.Config
+
+	response, err := configDB.GetAllDevices()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetDevice gets a single device and returns it in JSON format
+func (d *DeviceAPI) GetDevice(rw http.ResponseWriter, req *http.Request) {
+
+	//	Connect to the datastore:
+	configDB := d.Store.Config
+
+	//	Get the device id from the request:
+	deviceID := mux.Vars(req)["id"]
+
+	//	See if we can find a device with that id:
+	response, err := configDB.GetDevice(deviceID)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	if response.ID == "" {
+		sendErrorResponse(rw, fmt.Errorf("Device %s not found", deviceID), http.StatusNotFound)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// AddDevice adds a new device and returns it in JSON format
+func (d *DeviceAPI) AddDevice(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := data.Device{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	New devices always get a new id:
+	request.ID = ""
+
+	d.saveDevice(rw, request)
+}
+
+// UpdateDevice updates an existing device and returns it in JSON format
+func (d *DeviceAPI) UpdateDevice(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := data.Device{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Get the config datastore:
+	configDB := d.Store.Config
+
+	//	Make sure the device exists:
+	deviceID := mux.Vars(req)["id"]
+	existing, err := configDB.GetDevice(deviceID)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	if existing.ID == "" {
+		sendErrorResponse(rw, fmt.Errorf("Device %s not found", deviceID), http.StatusNotFound)
+		return
+	}
+
+	//	The id comes from the route, and the running state
+	//	is tracked by the collector:
+	request.ID = existing.ID
+	request.Running = existing.Running
+
+	d.saveDevice(rw, request)
+}
+
+// RemoveDevice removes a single device
+func (d *DeviceAPI) RemoveDevice(rw http.ResponseWriter, req *http.Request) {
+
+	//	Get the config datastore:
+	configDB := d.Store.Config
+
+	//	Get the device id from the request:
+	deviceID := mux.Vars(req)["id"]
+
+	//	Send the request to the datastore and get a response:
+	err := configDB.RemoveDevice(deviceID)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	d.Updated <- true
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(fmt.Sprintf("Removed %s", deviceID))
+}
+
+// saveDevice validates and stores the device, then sends it back in JSON format
+func (d *DeviceAPI) saveDevice(rw http.ResponseWriter, device data.Device) {
+
+	//	Default to the monitor's own sensor:
+	if device.Type == "" {
+		device.Type = data.DeviceTypeAmon
+	}
+
+	if err := device.Validate(); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Get the config datastore:
+	configDB := d.Store.Config
+
+	//	Send the request to the datastore and get a response:
+	response, err := configDB.AddOrUpdateDevice(device)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	d.Updated <- true
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// GetTariff gets the electricity tariff and returns it in JSON format
+func (a *ActivityAPI) GetTariff(rw http.ResponseWriter, req *http.Request) {
+
+	//	Connect to the datastore:
+	configDB := a.Store.Config
+
+	response, err := configDB.GetTariff()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// SetTariff sets the electricity tariff and returns the new tariff in JSON format
+func (a *ActivityAPI) SetTariff(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := data.Tariff{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := request.Validate(); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Get the config datastore:
+	configDB := a.Store.Config
+
+	//	Send the request to the datastore and get a response:
+	response, err := configDB.SetTariff(request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetActivityStats gets energy use and cost per cycle, day and month for cycles
+// that started in a given time range
+func (a *ActivityAPI) GetActivityStats(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	The default request is this month:
+	now := time.Now()
+	starttime := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	endtime := now
+
+	//	Decode the POST body:
+	request := ActivityRequest{}
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Parse the dates from many different formats: https://github.com/araddon/dateparse
+	if t, err := dateparse.ParseAny(request.StartTime); err == nil {
+		starttime = t
+	}
+
+	if t, err := dateparse.ParseAny(request.EndTime); err == nil {
+		endtime = t
+	}
+
+	//	Get the datastores:
+	activityDB := a.Store.Activity
+	configDB := a.Store.Config
+
+	cycles, err := activityDB.GetCycles(request.DeviceID, starttime, endtime)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	tariff, err := configDB.GetTariff()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := data.Summarize(cycles, tariff)
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
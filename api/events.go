@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// SSEHandler streams hub events to clients using Server-Sent Events
+type SSEHandler struct {
+	H     *Hub
+	Store *data.Store
+}
+
+// How often to send a comment line to keep idle connections open
+var sseKeepAliveInterval = 15 * time.Second
+
+func (sh SSEHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	//	Make sure we can stream the response:
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		sendErrorResponse(rw, fmt.Errorf("Streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	//	See if the client is resuming.  Browsers send the header,
+	//	but some polyfills can only pass a query parameter:
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("lastEventId")
+	}
+
+	var lastEventTime time.Time
+	if lastEventID != "" {
+		t, err := time.Parse(time.RFC3339Nano, lastEventID)
+		if err != nil {
+			sendErrorResponse(rw, fmt.Errorf("Invalid Last-Event-ID: %v", lastEventID), http.StatusBadRequest)
+			return
+		}
+		lastEventTime = t
+	}
+
+	//	Register with the hub before replaying, so nothing gets lost
+	//	between the replay and the live stream.  Anything that happens in
+	//	between can come from both, so live events the replay already
+	//	sent get skipped below:
+	c := &connection{send: make(chan HubMessage, 256), h: sh.H}
+	c.h.addConnection(c)
+	defer c.h.removeConnection(c)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	//	Send any activity the client missed:
+	var replayedUntil time.Time
+	if !lastEventTime.IsZero() {
+		activityDB := sh.Store.Activity
+
+		configDB := sh.Store.Config
+
+		//	Look up the device names for the messages:
+		deviceNames := make(map[string]string)
+		if devices, err := configDB.GetAllDevices(); err == nil {
+			for _, device := range devices {
+				deviceNames[device.ID] = device.Name
+			}
+		}
+
+		missed, err := activityDB.GetRange("", lastEventTime, time.Now())
+		if err == nil {
+			for _, activity := range missed {
+				//	The range includes the last event the client got:
+				if !activity.Timestamp.After(lastEventTime) {
+					continue
+				}
+
+				if message := ActivityMessage(deviceNames[activity.DeviceID], activity); message != nil {
+					writeEvent(rw, activity.Timestamp, message)
+					if activity.Timestamp.After(replayedUntil) {
+						replayedUntil = activity.Timestamp
+					}
+				}
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	//	Stream events until the client goes away:
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+
+			//	Skip events the replay already sent:
+			if !replayedUntil.IsZero() && !message.Time.After(replayedUntil) {
+				continue
+			}
+
+			writeEvent(rw, message.Time, message.Data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keepalive\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a single SSE event.  The id is the event time, so
+// a reconnecting client can pass it back as Last-Event-ID
+func writeEvent(rw http.ResponseWriter, id time.Time, message []byte) {
+	fmt.Fprintf(rw, "id: %s\n", id.Format(time.RFC3339Nano))
+	for _, line := range strings.Split(string(message), "\n") {
+		fmt.Fprintf(rw, "data: %s\n", line)
+	}
+	fmt.Fprint(rw, "\n")
+}
+
+// ActivityMessage formats an activity for the given device the way the hub
+// broadcasts it.  Returns nil for activity types the hub doesn't broadcast
+func ActivityMessage(deviceName string, activity data.Activity) []byte {
+	if deviceName == "" {
+		deviceName = "Appliance"
+	}
+
+	switch activity.Type {
+	case data.ApplianceRunning:
+		return []byte(fmt.Sprintf("%s state: running", deviceName))
+	case data.ApplianceStopped:
+		return []byte(fmt.Sprintf("%s state: stopped", deviceName))
+	}
+
+	return nil
+}
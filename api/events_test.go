@@ -0,0 +1,105 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/api"
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+func TestSSEHandler_LastEventID_ReplaysMissedActivity(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store, err := data.OpenStore("testing.db", "testactivity.db", time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the store: %v", err)
+	}
+	defer store.Close()
+
+	seen := time.Now().Add(-1 * time.Minute)
+	missed := seen.Add(time.Millisecond)
+	live := time.Now().Add(1 * time.Second)
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: seen, Type: data.ApplianceRunning})
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: missed, Type: data.ApplianceStopped})
+
+	hub := api.NewHub()
+	handler := api.SSEHandler{H: hub, Store: store}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req = req.WithContext(ctx)
+	req.Header.Set("Last-Event-ID", seen.Format(time.RFC3339Nano))
+	rw := httptest.NewRecorder()
+
+	//	Act
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		hub.BroadcastActivity("Washer", data.Activity{DeviceID: "testdevice", Timestamp: live, Type: data.ApplianceRunning})
+	}()
+	handler.ServeHTTP(rw, req)
+	body := rw.Body.String()
+
+	//	Assert
+	if strings.Contains(body, "id: "+seen.Format(time.RFC3339Nano)+"\n") {
+		t.Errorf("ServeHTTP failed: Shouldn't have repeated the last event.  Got %v", body)
+	}
+
+	if !strings.Contains(body, "id: "+missed.Format(time.RFC3339Nano)+"\ndata: Appliance state: stopped\n") {
+		t.Errorf("ServeHTTP failed: Should have replayed the missed event.  Got %v", body)
+	}
+
+	if !strings.Contains(body, "id: "+live.Format(time.RFC3339Nano)+"\ndata: Washer state: running\n") {
+		t.Errorf("ServeHTTP failed: Live events should use the activity time as the id.  Got %v", body)
+	}
+}
+
+//	An activity that happens while a resuming client is being caught up comes
+//	from both the replay and the hub, but should only be sent once
+func TestSSEHandler_LastEventID_DoesntRepeatReplayedActivity(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store, err := data.OpenStore("testing.db", "testactivity.db", time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the store: %v", err)
+	}
+	defer store.Close()
+
+	seen := time.Now().Add(-1 * time.Minute)
+	during := data.Activity{DeviceID: "testdevice", Timestamp: time.Now(), Type: data.ApplianceStopped}
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: seen, Type: data.ApplianceRunning})
+	store.Activity.Add(during)
+
+	hub := api.NewHub()
+	handler := api.SSEHandler{H: hub, Store: store}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req = req.WithContext(ctx)
+	req.Header.Set("Last-Event-ID", seen.Format(time.RFC3339Nano))
+	rw := httptest.NewRecorder()
+
+	//	Act
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		hub.BroadcastActivity("Washer", during)
+	}()
+	handler.ServeHTTP(rw, req)
+	body := rw.Body.String()
+
+	//	Assert
+	if count := strings.Count(body, "id: "+during.Timestamp.Format(time.RFC3339Nano)+"\n"); count != 1 {
+		t.Errorf("ServeHTTP failed: Should have sent the activity once, but sent it %v times.  Got %v", count, body)
+	}
+}
@@ -3,8 +3,19 @@ package api
 import (
 	"sync"
 	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
 )
 
+// HubMessage is a message sent to every connection
+type HubMessage struct {
+	// Time is when the event happened.  Event stream clients get it as the
+	// event id, so they can resume from it
+	Time time.Time
+
+	Data []byte
+}
+
 // Hub is used to manage and coordinate websocket connections
 type Hub struct {
 	// the mutex to protect connections
@@ -14,7 +25,7 @@ type Hub struct {
 	connections map[*connection]struct{}
 
 	// Inbound messages from the connections.
-	Broadcast chan []byte
+	Broadcast chan HubMessage
 
 	logMx sync.RWMutex
 	log   [][]byte
@@ -24,7 +35,7 @@ type Hub struct {
 func NewHub() *Hub {
 	h := &Hub{
 		connectionsMx: sync.RWMutex{},
-		Broadcast:     make(chan []byte),
+		Broadcast:     make(chan HubMessage),
 		connections:   make(map[*connection]struct{}),
 	}
 
@@ -61,3 +72,11 @@ func (h *Hub) removeConnection(conn *connection) {
 		close(conn.send)
 	}
 }
+
+// BroadcastActivity sends an activity to every connection, if it's a type the
+// hub broadcasts.  The message time is the activity time
+func (h *Hub) BroadcastActivity(deviceName string, activity data.Activity) {
+	if message := ActivityMessage(deviceName, activity); message != nil {
+		h.Broadcast <- HubMessage{Time: activity.Timestamp, Data: message}
+	}
+}
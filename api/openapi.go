@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OpenAPIDocument is an OpenAPI 3 description of the API.  Only the parts of
+// the spec the API uses are included
+type OpenAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       OpenAPIInfo                            `json:"info"`
+	Servers    []OpenAPIServer                        `json:"servers"`
+	Security   []map[string][]string                  `json:"security"`
+	Paths      map[string]map[string]OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                      `json:"components"`
+}
+
+// OpenAPIInfo describes the API
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is the base url of the API
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIOperation describes a route
+type OpenAPIOperation struct {
+	Tags        []string                   `json:"tags"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody               `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+
+	// Security overrides the document security.  It's empty for public routes
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+// OpenAPIParameter describes a path or query parameter
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIBody describes a request body
+type OpenAPIBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes a response
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType describes the body for a content type
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema describes a JSON value
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPIComponents has the schemas and security schemes used by the routes
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+// OpenAPISecurityScheme describes a way to authenticate
+type OpenAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Matches path parameters, like {id}
+var pathParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+// The JSON content type
+const jsonContentType = "application/json"
+
+// GetOpenAPI gets the OpenAPI document for the API
+func (s *Server) GetOpenAPI(rw http.ResponseWriter, req *http.Request) {
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(NewOpenAPIDocument(s.Routes()))
+}
+
+// NewOpenAPIDocument builds the OpenAPI document for a route table
+func NewOpenAPIDocument(routes []Route) OpenAPIDocument {
+	schemas := schemaBuilder{schemas: map[string]*OpenAPISchema{}}
+	errorSchema := schemas.schema(reflect.TypeOf(ErrorResponse{}))
+
+	retval := OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: "appliance-monitor", Version: BuildVersion},
+		Servers: []OpenAPIServer{{URL: APIVersionPrefix}},
+		Security: []map[string][]string{
+			{"bearer": {}},
+			{"basic": {}},
+			{"session": {}},
+		},
+		Paths: map[string]map[string]OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: schemas.schemas,
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				"bearer":  {Type: "http", Scheme: "bearer"},
+				"basic":   {Type: "http", Scheme: "basic"},
+				"session": {Type: "apiKey", In: "cookie", Name: SessionCookie},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		operation := OpenAPIOperation{
+			Tags:    []string{route.Tag},
+			Summary: route.Summary,
+			Responses: map[string]OpenAPIResponse{
+				"default": {
+					Description: "Error",
+					Content:     map[string]OpenAPIMediaType{jsonContentType: {Schema: errorSchema}},
+				},
+			},
+		}
+
+		//	Document who can use the route:
+		req, _ := http.NewRequest(route.Method, route.Path, nil)
+		if scope := requiredScope(req); scope == "" {
+			operation.Security = &[]map[string][]string{}
+		} else {
+			operation.Description = "Needs " + scope + " access"
+		}
+
+		for _, match := range pathParameter.FindAllStringSubmatch(route.Path, -1) {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{Name: match[1], In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"}})
+		}
+
+		for _, name := range route.Query {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{Name: name, In: "query", Schema: &OpenAPISchema{Type: "string"}})
+		}
+
+		if route.Request != nil {
+			operation.RequestBody = &OpenAPIBody{
+				Required: true,
+				Content:  map[string]OpenAPIMediaType{jsonContentType: {Schema: schemas.schema(reflect.TypeOf(route.Request))}},
+			}
+		}
+
+		success := OpenAPIResponse{Description: "Success"}
+		switch {
+		case route.Response != nil:
+			success.Content = map[string]OpenAPIMediaType{jsonContentType: {Schema: schemas.schema(reflect.TypeOf(route.Response))}}
+		case route.ContentType != "":
+			success.Content = map[string]OpenAPIMediaType{route.ContentType: {Schema: &OpenAPISchema{Type: "string"}}}
+		}
+		operation.Responses["200"] = success
+
+		if retval.Paths[route.Path] == nil {
+			retval.Paths[route.Path] = map[string]OpenAPIOperation{}
+		}
+		retval.Paths[route.Path][strings.ToLower(route.Method)] = operation
+	}
+
+	return retval
+}
+
+// schemaBuilder creates schemas from Go types using their JSON tags.  Named
+// structs are added to the components and referenced
+type schemaBuilder struct {
+	schemas map[string]*OpenAPISchema
+}
+
+// The types that aren't described by their fields
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema gets the schema for a type
+func (b schemaBuilder) schema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &OpenAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+
+		//	Add it to the components the first time it's seen.  The
+		//	placeholder stops types that refer to themselves looping:
+		if _, found := b.schemas[t.Name()]; !found {
+			b.schemas[t.Name()] = &OpenAPISchema{}
+			*b.schemas[t.Name()] = *b.object(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	//	Anything goes:
+	return &OpenAPISchema{}
+}
+
+// object gets the schema for the fields of a struct.  Embedded structs
+// without a JSON name have their fields included, like encoding/json does
+func (b schemaBuilder) object(t reflect.Type) *OpenAPISchema {
+	retval := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embedded := range b.object(field.Type).Properties {
+				retval.Properties[embeddedName] = embedded
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		retval.Properties[name] = b.schema(field.Type)
+	}
+
+	return retval
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/network"
+)
+
+// The resets that can be confirmed
+const (
+	ResetNetworkName = "network"
+	ResetConfigName  = "config"
+)
+
+// ResetConfirmationTimeout is how long a reset confirmation can be used for
+var ResetConfirmationTimeout = 5 * time.Minute
+
+// ResetRequest describes a request to reset the network or config.  Without a
+// confirmation, nothing is reset -- a confirmation is sent back instead
+type ResetRequest struct {
+	// Confirmation is the confirmation from an earlier request
+	Confirmation string `json:"confirmation"`
+
+	// Activity indicates the activity should be removed too (config resets only)
+	Activity bool `json:"activity"`
+}
+
+// ResetConfirmation is sent back for a reset request without a confirmation.
+// It has to be sent back with the next request before it expires
+type ResetConfirmation struct {
+	Reset        string    `json:"reset"`
+	Confirmation string    `json:"confirmation"`
+	Expires      time.Time `json:"expires"`
+}
+
+// ResetNetwork removes the wifi networks, puts the network interfaces back on
+// DHCP and the host name back to the default, and reboots.  It needs a confirmation
+func (s *SystemAPI) ResetNetwork(rw http.ResponseWriter, req *http.Request) {
+	if _, ok := s.confirmReset(rw, req, ResetNetworkName); !ok {
+		return
+	}
+
+	//	Hold the reboot until the response has been sent:
+	reboot := make(chan bool, 1)
+	if err := network.ResetNetwork(reboot); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.respondThenReboot(rw, "Network reset.  Rebooting...", reboot)
+}
+
+// ResetConfig removes everything from the config database except the deviceID
+// and reboots.  If requested, the activity is removed too.  It needs a confirmation
+func (s *SystemAPI) ResetConfig(rw http.ResponseWriter, req *http.Request) {
+	request, ok := s.confirmReset(rw, req, ResetConfigName)
+	if !ok {
+		return
+	}
+
+	if err := s.Store.Reset(request.Activity); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Reset the config (activity removed: %v).  Requesting a reboot", request.Activity)
+
+	//	Restart with the empty config:
+	s.respondThenReboot(rw, "Config reset.  Rebooting...", nil)
+}
+
+// respondThenReboot sends the response and flushes it, then requests a
+// reboot, so the client hears back before the monitor goes away.  If reboot
+// is set, the reboot is only requested once something is sent on it
+func (s *SystemAPI) respondThenReboot(rw http.ResponseWriter, message string, reboot chan bool) {
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(message)
+
+	if flusher, ok := rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	go func() {
+		if reboot != nil {
+			<-reboot
+		}
+		s.Reboot <- true
+	}()
+}
+
+// confirmReset decodes a reset request and checks its confirmation.  If the
+// request doesn't have one, a new confirmation is sent back.  Returns true
+// if the reset should go ahead
+func (s *SystemAPI) confirmReset(rw http.ResponseWriter, req *http.Request, reset string) (ResetRequest, bool) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request.  An empty body asks for a confirmation:
+	request := ResetRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return request, false
+	}
+
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+
+	//	Forget confirmations that have expired:
+	now := time.Now()
+	for value, confirmation := range s.confirmations {
+		if now.After(confirmation.Expires) {
+			delete(s.confirmations, value)
+		}
+	}
+
+	if request.Confirmation == "" {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return request, false
+		}
+
+		confirmation := ResetConfirmation{
+			Reset:        reset,
+			Confirmation: hex.EncodeToString(secret),
+			Expires:      now.Add(ResetConfirmationTimeout),
+		}
+
+		if s.confirmations == nil {
+			s.confirmations = map[string]ResetConfirmation{}
+		}
+		s.confirmations[confirmation.Confirmation] = confirmation
+
+		//	Serialize to JSON & return the response:
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(rw).Encode(confirmation)
+		return request, false
+	}
+
+	//	Confirmations can only be used once, for the reset they were made for:
+	confirmation, found := s.confirmations[request.Confirmation]
+	delete(s.confirmations, request.Confirmation)
+
+	if !found || confirmation.Reset != reset {
+		sendErrorResponse(rw, errors.New("The confirmation is invalid or has expired.  Send the request without one to get a new confirmation"), http.StatusConflict)
+		return request, false
+	}
+
+	return request, true
+}
@@ -0,0 +1,53 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/api"
+)
+
+//	A network reset should send its response before asking for the reboot
+func TestResetNetwork_Confirmed_RespondsThenReboots(t *testing.T) {
+	//	Arrange
+	reboot := make(chan bool)
+	system := &api.SystemAPI{Reboot: reboot}
+
+	rw := httptest.NewRecorder()
+	system.ResetNetwork(rw, httptest.NewRequest("POST", "/v1/reset/network", strings.NewReader("")))
+
+	confirmation := api.ResetConfirmation{}
+	if err := json.NewDecoder(rw.Body).Decode(&confirmation); err != nil {
+		t.Fatalf("Couldn't get a confirmation: %v", err)
+	}
+
+	//	Act
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rw := httptest.NewRecorder()
+		system.ResetNetwork(rw, httptest.NewRequest("POST", "/v1/reset/network", strings.NewReader(`{"confirmation": "`+confirmation.Confirmation+`"}`)))
+		done <- rw
+	}()
+
+	//	Assert
+	select {
+	case rw := <-done:
+		if rw.Code != http.StatusOK || !rw.Flushed {
+			t.Errorf("ResetNetwork failed: Should have sent the response, but got %v", rw.Code)
+		}
+	case <-reboot:
+		t.Fatalf("ResetNetwork failed: Asked for the reboot before sending the response")
+	case <-time.After(time.Second):
+		t.Fatalf("ResetNetwork failed: Didn't send the response")
+	}
+
+	select {
+	case <-reboot:
+	case <-time.After(time.Second):
+		t.Errorf("ResetNetwork failed: Didn't ask for the reboot")
+	}
+}
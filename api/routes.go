@@ -2,9 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-
 	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/network"
+	"github.com/gorilla/mux"
 )
 
 var (
@@ -19,12 +23,167 @@ var (
 	ApplicationStartTime = time.Now()
 )
 
+// APIVersionPrefix is the path prefix for the current version of the API.  Every
+// route is also served without it, for older clients like the UI
+const APIVersionPrefix = "/v1"
+
 // ErrorResponse represents an API response
 type ErrorResponse struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 }
 
+// Route describes an API endpoint.  The route table is used both to set up
+// the router and to build the OpenAPI document
+type Route struct {
+	// Method is the HTTP method (GET / POST / DELETE)
+	Method string
+
+	// Path is the url path, without the version prefix.  Path parameters are
+	// in braces, like /devices/{id}
+	Path string
+
+	// Tag groups related routes in the OpenAPI document
+	Tag string
+
+	// Summary describes what the route does
+	Summary string
+
+	// Query lists the query parameters the route reads
+	Query []string
+
+	// Request is an example of the JSON request body, if there is one
+	Request interface{}
+
+	// Response is an example of the JSON response body, if there is one
+	Response interface{}
+
+	// ContentType is the content type of a response that isn't JSON
+	ContentType string
+
+	// Handler serves the route
+	Handler http.Handler
+}
+
+// Server has everything needed to serve the API routes
+type Server struct {
+	Activity      *ActivityAPI
+	Config        *ConfigAPI
+	Devices       *DeviceAPI
+	System        *SystemAPI
+	Auth          *AuthAPI
+	Subscriptions *SubscriptionAPI
+
+	// Hub is the hub used for websocket and server-sent event clients
+	Hub *Hub
+
+	// Store is the open datastore
+	Store *data.Store
+}
+
+// Routes gets the route table for the API.  More specific paths come before
+// paths with parameters, because the router takes the first match
+func (s *Server) Routes() []Route {
+	return []Route{
+		//	Activities
+		{Method: "GET", Path: "/activity", Tag: "activity", Summary: "Get all activity, or a page of activity", Query: []string{"device", "limit", "before", "after", "newestfirst"}, Response: []data.Activity{}, Handler: http.HandlerFunc(s.Activity.GetAllActivity)},
+		{Method: "POST", Path: "/activity", Tag: "activity", Summary: "Get activity in a time range", Request: ActivityRequest{}, Response: []data.Activity{}, Handler: http.HandlerFunc(s.Activity.GetActivityInRange)},
+		{Method: "DELETE", Path: "/activity", Tag: "activity", Summary: "Remove activity in a time range", Request: ActivityRequest{}, Response: "", Handler: http.HandlerFunc(s.Activity.DeleteActivityInRange)},
+		{Method: "POST", Path: "/activity/cycles", Tag: "activity", Summary: "Get the cycles that started in a time range", Request: ActivityRequest{}, Response: []data.Cycle{}, Handler: http.HandlerFunc(s.Activity.GetCyclesInRange)},
+		{Method: "GET", Path: "/activity/export", Tag: "activity", Summary: "Export activity and cycles as CSV, JSON Lines or iCalendar", Query: []string{"format", "device", "starttime", "endtime"}, ContentType: "text/csv", Handler: http.HandlerFunc(s.Activity.ExportActivity)},
+		{Method: "POST", Path: "/activity/import", Tag: "activity", Summary: "Import activity and cycles exported as CSV or JSON Lines", Query: []string{"format", "dryrun"}, Response: data.ImportResult{}, Handler: http.HandlerFunc(s.Activity.ImportActivity)},
+		{Method: "POST", Path: "/activity/stats", Tag: "activity", Summary: "Get energy use and cost for cycles that started in a time range", Request: ActivityRequest{}, Response: data.Stats{}, Handler: http.HandlerFunc(s.Activity.GetActivityStats)},
+
+		//	Energy
+		{Method: "GET", Path: "/tariff", Tag: "energy", Summary: "Get the electricity tariff", Response: data.Tariff{}, Handler: http.HandlerFunc(s.Activity.GetTariff)},
+		{Method: "POST", Path: "/tariff", Tag: "energy", Summary: "Set the electricity tariff", Request: data.Tariff{}, Response: data.Tariff{}, Handler: http.HandlerFunc(s.Activity.SetTariff)},
+
+		//	Config
+		{Method: "GET", Path: "/config", Tag: "config", Summary: "Get all config items", Response: []data.ConfigItem{}, Handler: http.HandlerFunc(s.Config.GetAllConfig)},
+		{Method: "POST", Path: "/config", Tag: "config", Summary: "Set many config items at once", Request: []data.ConfigItem{}, Response: []data.ConfigItem{}, Handler: http.HandlerFunc(s.Config.SetAllConfigItems)},
+		{Method: "GET", Path: "/config/schema", Tag: "config", Summary: "Get the known settings", Response: []data.Setting{}, Handler: http.HandlerFunc(s.Config.GetConfigSchema)},
+		{Method: "GET", Path: "/config/{name}", Tag: "config", Summary: "Get a config item", Response: data.ConfigItem{}, Handler: http.HandlerFunc(s.Config.GetConfigItem)},
+		{Method: "POST", Path: "/config/{name}", Tag: "config", Summary: "Set a config item", Request: data.ConfigItem{}, Response: data.ConfigItem{}, Handler: http.HandlerFunc(s.Config.SetConfigItem)},
+		{Method: "DELETE", Path: "/config/{name}", Tag: "config", Summary: "Remove a config item", Response: "", Handler: http.HandlerFunc(s.Config.RemoveConfigItem)},
+
+		//	Devices
+		{Method: "GET", Path: "/devices", Tag: "devices", Summary: "Get all devices", Response: []data.Device{}, Handler: http.HandlerFunc(s.Devices.GetAllDevices)},
+		{Method: "POST", Path: "/devices", Tag: "devices", Summary: "Add a device", Request: data.Device{}, Response: data.Device{}, Handler: http.HandlerFunc(s.Devices.AddDevice)},
+		{Method: "GET", Path: "/devices/{id}", Tag: "devices", Summary: "Get a device", Response: data.Device{}, Handler: http.HandlerFunc(s.Devices.GetDevice)},
+		{Method: "POST", Path: "/devices/{id}", Tag: "devices", Summary: "Update a device", Request: data.Device{}, Response: data.Device{}, Handler: http.HandlerFunc(s.Devices.UpdateDevice)},
+		{Method: "DELETE", Path: "/devices/{id}", Tag: "devices", Summary: "Remove a device", Response: "", Handler: http.HandlerFunc(s.Devices.RemoveDevice)},
+
+		//	System information
+		{Method: "GET", Path: "/system/state", Tag: "system", Summary: "Get the current running state of the app", Response: CurrentState{}, Handler: http.HandlerFunc(s.System.GetCurrentState)},
+		{Method: "GET", Path: "/system/wifi", Tag: "system", Summary: "Get the wifi networks that are set up.  Passphrases are redacted", Response: network.WifiConfig{}, Handler: http.HandlerFunc(s.System.GetWifi)},
+		{Method: "POST", Path: "/system/wifi", Tag: "system", Summary: "Update the wifi networks and reboot", Request: WifiUpdateRequest{}, Response: WifiUpdateResponse{}, Handler: http.HandlerFunc(s.System.UpdateWifi)},
+		{Method: "GET", Path: "/system/wifi/networks", Tag: "system", Summary: "Scan for wifi networks", Response: []network.WifiNetwork{}, Handler: http.HandlerFunc(s.System.GetWifiNetworks)},
+		{Method: "GET", Path: "/system/network", Tag: "system", Summary: "Get the addressing setup for the network interfaces", Response: network.NetworkConfig{}, Handler: http.HandlerFunc(s.System.GetNetwork)},
+		{Method: "POST", Path: "/system/network", Tag: "system", Summary: "Update the addressing setup for the network interfaces and reboot", Request: network.NetworkConfig{}, Response: NetworkUpdateResponse{}, Handler: http.HandlerFunc(s.System.UpdateNetwork)},
+		{Method: "GET", Path: "/system/backup", Tag: "system", Summary: "Download a backup of the databases", ContentType: "application/gzip", Handler: http.HandlerFunc(s.System.Backup)},
+		{Method: "POST", Path: "/system/restore", Tag: "system", Summary: "Restore a backup and reboot", Response: "", Handler: http.HandlerFunc(s.System.Restore)},
+
+		//	System resets
+		{Method: "POST", Path: "/reset/network", Tag: "system", Summary: "Remove the wifi networks, put the network interfaces back on DHCP, reset the host name and reboot.  Send the request without a confirmation to get one", Request: ResetRequest{}, Response: ResetConfirmation{}, Handler: http.HandlerFunc(s.System.ResetNetwork)},
+		{Method: "POST", Path: "/reset/config", Tag: "system", Summary: "Remove all config except the deviceID, and optionally the activity, and reboot.  Send the request without a confirmation to get one", Request: ResetRequest{}, Response: ResetConfirmation{}, Handler: http.HandlerFunc(s.System.ResetConfig)},
+
+		//	Authentication
+		{Method: "POST", Path: "/auth/setup", Tag: "auth", Summary: "Set the admin password the first time", Request: PasswordRequest{}, Response: "", Handler: http.HandlerFunc(s.Auth.Setup)},
+		{Method: "POST", Path: "/auth/login", Tag: "auth", Summary: "Log in to the UI.  The session is sent back as a cookie", Request: LoginRequest{}, Response: Principal{}, Handler: http.HandlerFunc(s.Auth.Login)},
+		{Method: "POST", Path: "/auth/logout", Tag: "auth", Summary: "Log out of the UI", Response: "", Handler: http.HandlerFunc(s.Auth.Logout)},
+		{Method: "GET", Path: "/auth/me", Tag: "auth", Summary: "Get who's logged in", Response: Principal{}, Handler: http.HandlerFunc(s.Auth.GetMe)},
+		{Method: "POST", Path: "/auth/me/password", Tag: "auth", Summary: "Change the password of the user that's logged in", Request: PasswordRequest{}, Response: "", Handler: http.HandlerFunc(s.Auth.ChangeMyPassword)},
+		{Method: "POST", Path: "/auth/password", Tag: "auth", Summary: "Change the admin password", Request: PasswordRequest{}, Response: "", Handler: http.HandlerFunc(s.Auth.ChangePassword)},
+		{Method: "GET", Path: "/auth/tokens", Tag: "auth", Summary: "Get all API tokens", Response: []data.APIToken{}, Handler: http.HandlerFunc(s.Auth.GetAllTokens)},
+		{Method: "POST", Path: "/auth/tokens", Tag: "auth", Summary: "Create an API token.  The token is only sent back once", Request: TokenRequest{}, Response: TokenResponse{}, Handler: http.HandlerFunc(s.Auth.CreateToken)},
+		{Method: "DELETE", Path: "/auth/tokens/{id}", Tag: "auth", Summary: "Remove an API token", Response: "", Handler: http.HandlerFunc(s.Auth.RemoveToken)},
+		{Method: "GET", Path: "/auth/users", Tag: "auth", Summary: "Get all users", Response: []data.User{}, Handler: http.HandlerFunc(s.Auth.GetAllUsers)},
+		{Method: "POST", Path: "/auth/users", Tag: "auth", Summary: "Add or update a user", Request: UserRequest{}, Response: data.User{}, Handler: http.HandlerFunc(s.Auth.SetUser)},
+		{Method: "DELETE", Path: "/auth/users/{username}", Tag: "auth", Summary: "Remove a user and end their sessions", Response: "", Handler: http.HandlerFunc(s.Auth.RemoveUser)},
+
+		//	Notification subscriptions
+		{Method: "GET", Path: "/subscribers", Tag: "notifications", Summary: "Get the subscribers you can manage", Response: []data.Subscriber{}, Handler: http.HandlerFunc(s.Subscriptions.GetAllSubscribers)},
+		{Method: "POST", Path: "/subscribers", Tag: "notifications", Summary: "Add or update a subscriber", Request: data.Subscriber{}, Response: data.Subscriber{}, Handler: http.HandlerFunc(s.Subscriptions.SetSubscriber)},
+		{Method: "GET", Path: "/subscribers/{id}", Tag: "notifications", Summary: "Get a subscriber", Response: data.Subscriber{}, Handler: http.HandlerFunc(s.Subscriptions.GetSubscriber)},
+		{Method: "DELETE", Path: "/subscribers/{id}", Tag: "notifications", Summary: "Remove a subscriber", Response: "", Handler: http.HandlerFunc(s.Subscriptions.RemoveSubscriber)},
+		{Method: "POST", Path: "/subscribers/{id}/test", Tag: "notifications", Summary: "Send a test notification to a subscriber", Response: "", Handler: http.HandlerFunc(s.Subscriptions.TestSubscriber)},
+
+		//	Live updates
+		{Method: "GET", Path: "/ws", Tag: "events", Summary: "Get activity as it happens over a websocket", Handler: WsHandler{H: s.Hub}},
+		{Method: "GET", Path: "/events", Tag: "events", Summary: "Get activity as it happens using server-sent events", ContentType: "text/event-stream", Handler: SSEHandler{H: s.Hub, Store: s.Store}},
+
+		//	This document
+		{Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "Get the OpenAPI document for the API", Response: map[string]interface{}{}, Handler: http.HandlerFunc(s.GetOpenAPI)},
+	}
+}
+
+// Router creates a router for the API routes.  Every route is served under
+// APIVersionPrefix and without it.  Errors from the router itself (unknown
+// paths and methods) are sent as an ErrorResponse, like every other error
+func (s *Server) Router() *mux.Router {
+	router := mux.NewRouter()
+
+	for _, route := range s.Routes() {
+		router.Handle(APIVersionPrefix+route.Path, route.Handler).Methods(route.Method)
+		router.Handle(route.Path, route.Handler).Methods(route.Method)
+	}
+
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+
+	return router
+}
+
+// notFound sends an error response for paths that don't exist
+func notFound(rw http.ResponseWriter, req *http.Request) {
+	sendErrorResponse(rw, errors.New("Not found: "+req.URL.Path), http.StatusNotFound)
+}
+
+// methodNotAllowed sends an error response for paths that don't support the method
+func methodNotAllowed(rw http.ResponseWriter, req *http.Request) {
+	sendErrorResponse(rw, errors.New(req.Method+" isn't supported for "+req.URL.Path), http.StatusMethodNotAllowed)
+}
+
 //	Used to send back an error:
 func sendErrorResponse(rw http.ResponseWriter, err error, code int) {
 	//	Our return value
@@ -32,8 +191,9 @@ func sendErrorResponse(rw http.ResponseWriter, err error, code int) {
 		Status:  code,
 		Message: "Error: " + err.Error()}
 
-	//	Serialize to JSON & return the response:
-	rw.WriteHeader(code)
+	//	Serialize to JSON & return the response.  Headers have to be
+	//	set before WriteHeader, or they're ignored:
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(code)
 	json.NewEncoder(rw).Encode(response)
 }
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/api"
+)
+
+//	The OpenAPI document should describe every route
+func TestOpenAPI_Routes_AllListed(t *testing.T) {
+	//	Arrange
+	server := &api.Server{}
+	req := httptest.NewRequest("GET", "/v1/openapi.json", nil)
+	rw := httptest.NewRecorder()
+
+	//	Act
+	server.Router().ServeHTTP(rw, req)
+	document := api.OpenAPIDocument{}
+	err := json.NewDecoder(rw.Body).Decode(&document)
+
+	//	Assert
+	if rw.Code != http.StatusOK || err != nil {
+		t.Fatalf("GetOpenAPI failed: Should have sent the document, but got %v / %v", rw.Code, err)
+	}
+
+	for _, route := range server.Routes() {
+		if _, found := document.Paths[route.Path][strings.ToLower(route.Method)]; !found {
+			t.Errorf("GetOpenAPI failed: %s %s isn't in the document", route.Method, route.Path)
+		}
+	}
+}
+
+//	Unknown paths and methods should get a JSON error, like every other error
+func TestRouter_UnknownPathAndMethod_SendErrorResponse(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"GET", "/v1/nothing", http.StatusNotFound},
+		{"GET", "/nothing", http.StatusNotFound},
+		{"PUT", "/v1/openapi.json", http.StatusMethodNotAllowed},
+		{"DELETE", "/openapi.json", http.StatusMethodNotAllowed},
+	}
+
+	server := &api.Server{}
+	router := server.Router()
+
+	for _, test := range tests {
+		//	Arrange
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rw := httptest.NewRecorder()
+
+		//	Act
+		router.ServeHTTP(rw, req)
+		response := api.ErrorResponse{}
+		err := json.NewDecoder(rw.Body).Decode(&response)
+
+		//	Assert
+		if rw.Code != test.want || response.Status != test.want {
+			t.Errorf("Router failed: %s %s should get %v, but got %v / %+v", test.method, test.path, test.want, rw.Code, response)
+		}
+
+		if err != nil || !strings.HasPrefix(rw.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("Router failed: %s %s should get a JSON error, but got %v / %s", test.method, test.path, err, rw.Header().Get("Content-Type"))
+		}
+	}
+}
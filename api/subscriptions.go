@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/notify"
+	"github.com/gorilla/mux"
+)
+
+// SubscriptionAPI represents the notification subscription API routes
+type SubscriptionAPI struct {
+	// Store is the open datastore
+	Store *data.Store
+}
+
+// GetAllSubscribers gets the subscribers and returns them in JSON format.
+// Operators and admins see everyone.  Other users only see their own
+func (s *SubscriptionAPI) GetAllSubscribers(rw http.ResponseWriter, req *http.Request) {
+	subscribers, err := s.Store.Config.GetAllSubscribers()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	principal := CurrentPrincipal(req)
+	response := []data.Subscriber{}
+	for _, subscriber := range subscribers {
+		if canManageSubscriber(principal, subscriber) {
+			response = append(response, subscriber)
+		}
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetSubscriber gets a single subscriber and returns it in JSON format
+func (s *SubscriptionAPI) GetSubscriber(rw http.ResponseWriter, req *http.Request) {
+	subscriber, ok := s.findSubscriber(rw, req)
+	if !ok {
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(subscriber)
+}
+
+// SetSubscriber adds or updates a subscriber and returns it in JSON format.
+// Users who aren't operators or admins can only manage their own subscriptions,
+// and can't add webhooks
+func (s *SubscriptionAPI) SetSubscriber(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := data.Subscriber{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	configDB := s.Store.Config
+	principal := CurrentPrincipal(req)
+
+	//	Subscriptions for people without operator access are their own:
+	if !data.ScopeAllows(principal.Scope, data.ScopeWrite) {
+		if principal.Username == "" {
+			sendErrorResponse(rw, errors.New("This needs write access"), http.StatusForbidden)
+			return
+		}
+		request.Username = principal.Username
+
+		//	Webhooks can post to any address the monitor can reach, so
+		//	they're only for operators:
+		if request.Channel == data.ChannelWebhook {
+			sendErrorResponse(rw, errors.New("Webhook subscribers need write access"), http.StatusForbidden)
+			return
+		}
+	}
+
+	//	Make sure we're not taking over someone else's subscription:
+	if request.ID != "" {
+		existing, err := configDB.GetSubscriber(request.ID)
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+
+		if existing.ID == "" || !canManageSubscriber(principal, existing) {
+			sendErrorResponse(rw, errors.New("Subscriber not found: "+request.ID), http.StatusNotFound)
+			return
+		}
+	}
+
+	//	Linked accounts have to exist:
+	if request.Username != "" && request.Username != data.AdminUsername {
+		user, err := configDB.GetUser(request.Username)
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+
+		if user.Username == "" {
+			sendErrorResponse(rw, errors.New("Unknown user: "+request.Username), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := configDB.AddOrUpdateSubscriber(request)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// RemoveSubscriber removes a subscriber
+func (s *SubscriptionAPI) RemoveSubscriber(rw http.ResponseWriter, req *http.Request) {
+	subscriber, ok := s.findSubscriber(rw, req)
+	if !ok {
+		return
+	}
+
+	if err := s.Store.Config.RemoveSubscriber(subscriber.ID); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(fmt.Sprintf("Removed %s", subscriber.ID))
+}
+
+// TestSubscriber sends a test notification to a subscriber, ignoring their
+// quiet hours, so they can check it arrives
+func (s *SubscriptionAPI) TestSubscriber(rw http.ResponseWriter, req *http.Request) {
+	subscriber, ok := s.findSubscriber(rw, req)
+	if !ok {
+		return
+	}
+
+	message := notify.Message{
+		Event:     "test",
+		Text:      fmt.Sprintf("Test notification for %s", subscriber.Name),
+		Timestamp: time.Now(),
+	}
+
+	if err := notify.SendTo(s.Store.Config, subscriber.Channel, subscriber.Target, message); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadGateway)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode("Sent")
+}
+
+// findSubscriber gets the subscriber in the request url.  If it can't be found,
+// or belongs to someone else, sends an error response and returns false
+func (s *SubscriptionAPI) findSubscriber(rw http.ResponseWriter, req *http.Request) (data.Subscriber, bool) {
+	id := mux.Vars(req)["id"]
+
+	subscriber, err := s.Store.Config.GetSubscriber(id)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return subscriber, false
+	}
+
+	if subscriber.ID == "" || !canManageSubscriber(CurrentPrincipal(req), subscriber) {
+		sendErrorResponse(rw, errors.New("Subscriber not found: "+id), http.StatusNotFound)
+		return subscriber, false
+	}
+
+	return subscriber, true
+}
+
+// canManageSubscriber returns true if the principal can see and change the subscriber
+func canManageSubscriber(principal Principal, subscriber data.Subscriber) bool {
+	if data.ScopeAllows(principal.Scope, data.ScopeWrite) {
+		return true
+	}
+
+	return principal.Username != "" && principal.Username == subscriber.Username
+}
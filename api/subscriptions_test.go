@@ -0,0 +1,61 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/api"
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	Viewers can add their own subscribers, but not webhooks
+func TestSetSubscriber_ViewerWebhook_Forbidden(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store, err := data.OpenStore("testing.db", "testactivity.db", time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the store: %v", err)
+	}
+	defer store.Close()
+
+	store.Config.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, "sams password")
+	store.Config.AddOrUpdateUser(data.User{Username: "olly", Role: data.RoleOperator}, "ollys password")
+
+	server := &api.Server{Subscriptions: &api.SubscriptionAPI{Store: store}, Store: store}
+	handler := api.Authenticator{Store: store}.Handler(server.Router())
+
+	send := func(username, password, body string) int {
+		req := httptest.NewRequest("POST", "/v1/subscribers", strings.NewReader(body))
+		req.SetBasicAuth(username, password)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	webhook := `{"name": "LAN", "channel": "webhook", "target": "http://192.168.1.1/admin"}`
+	email := `{"name": "Sam", "channel": "email", "target": "sam@example.com"}`
+
+	//	Act
+	viewerWebhook := send("sam", "sams password", webhook)
+	viewerEmail := send("sam", "sams password", email)
+	operatorWebhook := send("olly", "ollys password", webhook)
+
+	//	Assert
+	if viewerWebhook != http.StatusForbidden {
+		t.Errorf("SetSubscriber failed: A viewer shouldn't be able to add a webhook, but got %v", viewerWebhook)
+	}
+
+	if viewerEmail != http.StatusOK {
+		t.Errorf("SetSubscriber failed: A viewer should be able to add their own email subscriber, but got %v", viewerEmail)
+	}
+
+	if operatorWebhook != http.StatusOK {
+		t.Errorf("SetSubscriber failed: An operator should be able to add a webhook, but got %v", operatorWebhook)
+	}
+}
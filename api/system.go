@@ -2,30 +2,52 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/danesparza/appliance-monitor/data"
 	"github.com/danesparza/appliance-monitor/network"
-	"github.com/spf13/viper"
 )
 
 // SystemAPI represents the system API routes
 type SystemAPI struct {
+	// Store is the open datastore
+	Store *data.Store
+
 	// Reboot signals when the machine should be rebooted
 	Reboot chan bool
+
+	// confirmations are the reset confirmations that haven't been used yet
+	confirmations map[string]ResetConfirmation
+	confirmMu     sync.Mutex
 }
 
 // CurrentState describes the current running state of the application
 type CurrentState struct {
-	ServerStartTime    time.Time `json:"starttime"`
-	ApplicationVersion string    `json:"appversion"`
-	DeviceRunning      bool      `json:"devicerunning"`
-	DeviceID           string    `json:"deviceId"`
+	ServerStartTime    time.Time     `json:"starttime"`
+	ApplicationVersion string        `json:"appversion"`
+	DeviceRunning      bool          `json:"devicerunning"`
+	DeviceID           string        `json:"deviceId"`
+	Devices            []data.Device `json:"devices"`
+
+	// Provisioning indicates the monitor is broadcasting its setup network
+	Provisioning bool `json:"provisioning"`
+
+	// NetworkChange is the last wifi or network change and whether it was
+	// verified or rolled back
+	NetworkChange *network.NetworkChange `json:"networkchange,omitempty"`
 }
 
-// WifiUpdateRequest describes the request to update the Wifi credentials
+// WifiUpdateRequest describes the request to update the wifi setup.  Send the
+// networks to join, or just an SSID and passphrase to join a single WPA2 network
 type WifiUpdateRequest struct {
+	network.WifiConfig
 	SSID       string `json:"ssid"`
 	Passphrase string `json:"passphrase"`
 }
@@ -36,18 +58,23 @@ type WifiUpdateResponse struct {
 	Description string `json:"description"`
 }
 
+// NetworkUpdateResponse describes the response to update the network interfaces
+type NetworkUpdateResponse struct {
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
 // GetCurrentState gets the current running state of the application
 func (s *SystemAPI) GetCurrentState(rw http.ResponseWriter, req *http.Request) {
 
-	//	Find out if the device is currently running:
-	activityDB := data.ActivityDB{
-		Database: viper.GetString("datastore.activity")}
-	latestActivity, _ := activityDB.GetLatestActivity()
-
 	//	Get config information:
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := s.Store.Config
 	deviceID, _ := configDB.Get("deviceID")
+	devices, _ := configDB.GetAllDevices()
+
+	//	Find out if the monitor's own device is currently running:
+	activityDB := s.Store.Activity
+	latestActivity, _ := activityDB.GetLatestActivity(deviceID.Value)
 
 	//	Create a CurrentState type:
 	currentState := CurrentState{
@@ -55,6 +82,14 @@ func (s *SystemAPI) GetCurrentState(rw http.ResponseWriter, req *http.Request) {
 		DeviceRunning:      latestActivity.Type == data.ApplianceRunning,
 		ApplicationVersion: BuildVersion,
 		DeviceID:           deviceID.Value,
+		Devices:            devices,
+		Provisioning:       network.Provisioning(),
+	}
+
+	if change, err := network.LastNetworkChange(); err != nil {
+		log.Printf("[WARN] Problem getting the last network change: %v", err)
+	} else if change.Kind != "" {
+		currentState.NetworkChange = &change
 	}
 
 	//	Serialize to JSON & return the response:
@@ -62,8 +97,39 @@ func (s *SystemAPI) GetCurrentState(rw http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(rw).Encode(currentState)
 }
 
-// UpdateWifi updates the wifi credentials for the machine
+// GetWifiNetworks scans for wifi networks and returns them in JSON format,
+// strongest first
+func (s *SystemAPI) GetWifiNetworks(rw http.ResponseWriter, req *http.Request) {
+	response, err := network.ScanWifi()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// GetWifi gets the wifi setup and returns it in JSON format.  Passphrases are redacted
+func (s *SystemAPI) GetWifi(rw http.ResponseWriter, req *http.Request) {
+	response, err := network.GetWifiConfig()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response.Redacted())
+}
+
+// UpdateWifi updates the wifi setup for the machine and reboots.  Networks
+// that are already set up can be sent with their passphrase redacted to keep it.
+// The outcome of the change is in the current state after the reboot
 func (s *SystemAPI) UpdateWifi(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
 
 	//	Decode the request if it was a POST:
 	request := WifiUpdateRequest{}
@@ -73,9 +139,37 @@ func (s *SystemAPI) UpdateWifi(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	//	Send the request to the wifi helper:
+	config := request.WifiConfig
+	if len(config.Networks) == 0 && request.SSID != "" {
+		config.Networks = []network.WifiNetworkConfig{{SSID: request.SSID, Passphrase: request.Passphrase}}
+	}
+
+	if len(config.Networks) == 0 {
+		sendErrorResponse(rw, errors.New("Send at least one wifi network.  To remove them all, use POST /reset/network"), http.StatusBadRequest)
+		return
+	}
+
+	//	Keep the passphrases we weren't sent:
+	current, err := network.GetWifiConfig()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+	config = config.Merge(current)
+
+	if _, err := network.FormatWifiConfig(config); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Send the request to the wifi helper.  If the monitor can't connect
+	//	after the reboot, the change is rolled back:
 	response := WifiUpdateResponse{Status: 200, Description: "Successful.  Rebooting..."}
-	err = network.UpdateWifiCredentials(request.SSID, request.Passphrase, s.Reboot)
+	err = network.UpdateWifiConfig(config, s.Reboot)
+	if err == network.ErrChangePending {
+		sendErrorResponse(rw, err, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		sendErrorResponse(rw, err, http.StatusInternalServerError)
 		return
@@ -85,3 +179,118 @@ func (s *SystemAPI) UpdateWifi(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(rw).Encode(response)
 }
+
+// GetNetwork gets the addressing setup for the network interfaces and returns
+// it in JSON format
+func (s *SystemAPI) GetNetwork(rw http.ResponseWriter, req *http.Request) {
+	response, err := network.GetNetworkConfig()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// UpdateNetwork updates the addressing setup for the network interfaces and
+// reboots.  Like wifi changes, it's rolled back if the monitor can't connect
+// after the reboot
+func (s *SystemAPI) UpdateNetwork(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request if it was a POST:
+	config := network.NetworkConfig{}
+	err := json.NewDecoder(req.Body).Decode(&config)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(config.Interfaces) == 0 {
+		sendErrorResponse(rw, errors.New("Send at least one network interface.  To put them all back on DHCP, use POST /reset/network"), http.StatusBadRequest)
+		return
+	}
+
+	//	Check the setup against the service that will use it:
+	current, err := network.GetNetworkConfig()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+	config.Backend = current.Backend
+
+	if err := network.ValidateNetworkConfig(config); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Send the request to the network helper:
+	response := NetworkUpdateResponse{Status: 200, Description: "Successful.  Rebooting..."}
+	err = network.UpdateNetworkConfig(config, s.Reboot)
+	if err == network.ErrChangePending {
+		sendErrorResponse(rw, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// maxRestoreSize is the largest backup that can be uploaded
+const maxRestoreSize = 256 << 20
+
+// Backup streams a snapshot of the config and activity databases as a tar.gz archive
+func (s *SystemAPI) Backup(rw http.ResponseWriter, req *http.Request) {
+	filename := fmt.Sprintf("appliance-monitor-%s.tar.gz", time.Now().Format("20060102-150405"))
+
+	rw.Header().Set("Content-Type", "application/gzip")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	//	Once we've started streaming, it's too late to send an error response:
+	if err := s.Store.Backup(rw); err != nil {
+		log.Printf("[ERROR] Problem creating backup: %v", err)
+	}
+}
+
+// Restore replaces the config and activity databases with an uploaded backup
+// and reboots.  The backup can be sent as the request body, or as the 'backup'
+// file in a multipart form
+func (s *SystemAPI) Restore(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+	req.Body = http.MaxBytesReader(rw, req.Body, maxRestoreSize)
+
+	//	Find the upload:
+	var backup io.Reader = req.Body
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := req.FormFile("backup")
+		if err != nil {
+			sendErrorResponse(rw, err, http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		backup = file
+	}
+
+	if err := s.Store.Restore(backup); err != nil {
+		code := http.StatusInternalServerError
+		if _, ok := err.(data.BackupError); ok {
+			code = http.StatusBadRequest
+		}
+		sendErrorResponse(rw, err, code)
+		return
+	}
+
+	log.Println("[INFO] Restored a backup.  Requesting a reboot")
+
+	//	Restart with the restored data:
+	s.respondThenReboot(rw, "Restored.  Rebooting...", nil)
+}
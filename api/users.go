@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/gorilla/mux"
+)
+
+// LoginRequest describes a request to log in to the UI
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// UserRequest describes a request to add or update a user.  If Password is
+// blank, an existing user keeps their password
+type UserRequest struct {
+	data.User
+	Password string `json:"password"`
+}
+
+// Login checks a username and password and starts a UI session.  The session
+// is sent back as a cookie
+func (a *AuthAPI) Login(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := LoginRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	configDB := a.Store.Config
+
+	user, err := checkUserPassword(configDB, req, request.Username, request.Password)
+	if err == data.ErrInvalidCredentials {
+		sendErrorResponse(rw, err, http.StatusUnauthorized)
+		return
+	}
+	if backoff, ok := err.(backoffError); ok {
+		sendBackoffResponse(rw, backoff)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := startSession(rw, req, configDB, user.Username); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(userPrincipal(user))
+}
+
+// Logout ends the UI session
+func (a *AuthAPI) Logout(rw http.ResponseWriter, req *http.Request) {
+	if cookie, err := req.Cookie(SessionCookie); err == nil {
+		if err := a.Store.Config.RemoveSession(cookie.Value); err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(rw, &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1})
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode("Logged out")
+}
+
+// GetMe gets who's logged in and returns it in JSON format
+func (a *AuthAPI) GetMe(rw http.ResponseWriter, req *http.Request) {
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(CurrentPrincipal(req))
+}
+
+// ChangeMyPassword changes the password of the user that's logged in
+func (a *AuthAPI) ChangeMyPassword(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := PasswordRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	configDB := a.Store.Config
+	principal := CurrentPrincipal(req)
+
+	var err error
+	switch principal.Username {
+	case "":
+		sendErrorResponse(rw, errors.New("API tokens don't have a password"), http.StatusBadRequest)
+		return
+	case data.AdminUsername:
+		err = configDB.SetAdminPassword(request.Password)
+	default:
+		var user data.User
+		if user, err = configDB.GetUser(principal.Username); err == nil {
+			_, err = configDB.AddOrUpdateUser(user, request.Password)
+		}
+	}
+
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Changing the password ended the user's sessions.  If they're
+	//	using one, start a new one so they stay logged in:
+	if _, err := req.Cookie(SessionCookie); err == nil {
+		if err := startSession(rw, req, configDB, principal.Username); err != nil {
+			sendErrorResponse(rw, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode("Password changed")
+}
+
+// startSession creates a UI session for the user and sets the session cookie
+func startSession(rw http.ResponseWriter, req *http.Request, configDB *data.ConfigDB, username string) error {
+	value, session, err := configDB.CreateSession(username)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  session.Expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return nil
+}
+
+// GetAllUsers gets all users and returns them in JSON format
+func (a *AuthAPI) GetAllUsers(rw http.ResponseWriter, req *http.Request) {
+	response, err := a.Store.Config.GetAllUsers()
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// SetUser adds or updates a user and returns the user in JSON format
+func (a *AuthAPI) SetUser(rw http.ResponseWriter, req *http.Request) {
+	//	req.Body is a ReadCloser -- we need to remember to close it:
+	defer req.Body.Close()
+
+	//	Decode the request:
+	request := UserRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	response, err := a.Store.Config.AddOrUpdateUser(request.User, request.Password)
+	if err != nil {
+		sendErrorResponse(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(response)
+}
+
+// RemoveUser removes a user and ends their sessions
+func (a *AuthAPI) RemoveUser(rw http.ResponseWriter, req *http.Request) {
+	//	Get the username from the request:
+	username := mux.Vars(req)["username"]
+
+	if err := a.Store.Config.RemoveUser(username); err != nil {
+		sendErrorResponse(rw, err, http.StatusInternalServerError)
+		return
+	}
+
+	//	Serialize to JSON & return the response:
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(fmt.Sprintf("Removed %s", username))
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var backupOutput string
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Backs up the config and activity databases",
+	Long: `Writes a snapshot of the config and activity databases as a tar.gz 
+archive.  The server can't be running at the same time -- use 
+GET /system/backup on a running server instead.
+
+Example: 
+
+appliance-monitor backup -o backup.tar.gz`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		var output io.Writer = os.Stdout
+		if backupOutput != "" {
+			file, err := os.Create(backupOutput)
+			if err != nil {
+				log.Fatalf("[ERROR] %v", err)
+			}
+			defer file.Close()
+			output = file
+		}
+
+		if err := store.Backup(output); err != nil {
+			log.Fatalf("[ERROR] Problem creating backup: %v", err)
+		}
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [backup.tar.gz]",
+	Short: "Restores the config and activity databases from a backup",
+	Long: `Replaces the config and activity databases with the ones in a backup 
+created with the backup command or GET /system/backup.  The backup is 
+checked before anything is replaced.  The server can't be running at 
+the same time -- use POST /system/restore on a running server instead.
+
+Example: 
+
+appliance-monitor restore backup.tar.gz`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer file.Close()
+
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		if err := store.Restore(file); err != nil {
+			log.Fatalf("[ERROR] Problem restoring backup: %v", err)
+		}
+
+		log.Println("[INFO] Restored")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	RootCmd.AddCommand(restoreCmd)
+
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "file to write the backup to (default is stdout)")
+}
@@ -16,20 +16,28 @@ server:
   bind: "127.0.0.1"
   port: 3030
   allowed-origins: "*"
+  public-read: false
 settings:
   name: "appliance-monitor"
   monitorwindow: 120
+  provisiontimeout: 10
+  retentiondays: 365
+  retentionmaxentries: 10000
 `)
 
 var jsonDefault = []byte(`{
 	"server": {
 		"bind": "127.0.0.1",
 		"port": 3030,
-		"allowed-origins": "*"
+		"allowed-origins": "*",
+		"public-read": false
 	},
 	"settings": {
 		"name": "appliance-monitor",
-		"monitorwindow": 120
+		"monitorwindow": 120,
+		"provisiontimeout": 10,
+		"retentiondays": 365,
+		"retentionmaxentries": 10000
 	}
 }`)
 
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/danesparza/appliance-monitor/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportDevice string
+	exportStart  string
+	exportEnd    string
+	exportOutput string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports activity and cycles",
+	Long: `Exports activity and cycles as CSV, JSON Lines, or an iCalendar 
+feed with an event for each cycle.  The server can't be running at the 
+same time -- use GET /activity/export on a running server instead.
+
+Example: 
+
+appliance-monitor export --format ics --start 2017-01-01 -o history.ics`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, ok := export.ContentTypes[exportFormat]; !ok {
+			log.Fatalf("[ERROR] Unknown export format: %s", exportFormat)
+		}
+
+		//	Parse the dates from many different formats: https://github.com/araddon/dateparse
+		start := time.Time{}
+		if exportStart != "" {
+			t, err := dateparse.ParseAny(exportStart)
+			if err != nil {
+				log.Fatalf("[ERROR] Invalid start: %v", exportStart)
+			}
+			start = t
+		}
+
+		end := time.Now()
+		if exportEnd != "" {
+			t, err := dateparse.ParseAny(exportEnd)
+			if err != nil {
+				log.Fatalf("[ERROR] Invalid end: %v", exportEnd)
+			}
+			end = t
+		}
+
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		response, err := export.Load(store, exportDevice, start, end)
+		if err != nil {
+			log.Fatalf("[ERROR] Problem getting activity: %v", err)
+		}
+
+		var output io.Writer = os.Stdout
+		if exportOutput != "" {
+			file, err := os.Create(exportOutput)
+			if err != nil {
+				log.Fatalf("[ERROR] %v", err)
+			}
+			defer file.Close()
+			output = file
+		}
+
+		if err := export.Write(output, exportFormat, response); err != nil {
+			log.Fatalf("[ERROR] Problem exporting activity: %v", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", export.FormatCSV, "export format: csv, jsonl or ics")
+	exportCmd.Flags().StringVarP(&exportDevice, "device", "d", "", "only export this device (default is all devices)")
+	exportCmd.Flags().StringVar(&exportStart, "start", "", "only export activity from this time on")
+	exportCmd.Flags().StringVar(&exportEnd, "end", "", "only export activity up to this time (default is now)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "file to write the export to (default is stdout)")
+}
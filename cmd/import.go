@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danesparza/appliance-monitor/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat string
+	importDryRun bool
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Imports activity and cycles",
+	Long: `Imports activity and cycles from a CSV or JSON Lines file created by 
+the export command.  Activity the monitor already has (the same device 
+and time) is skipped.  The server can't be running at the same time -- 
+use POST /activity/import on a running server instead.
+
+Example: 
+
+appliance-monitor import --dry-run history.csv`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		//	Use the file extension if the format isn't given:
+		format := importFormat
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(args[0]), ".")
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer file.Close()
+
+		records, err := export.Read(file, format)
+		if err != nil {
+			log.Fatalf("[ERROR] Problem reading %s: %v", args[0], err)
+		}
+
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		result, err := store.Activity.Import(records.Activities, records.Cycles, importDryRun)
+		if err != nil {
+			log.Fatalf("[ERROR] Problem importing: %v", err)
+		}
+
+		if importDryRun {
+			fmt.Println("Dry run: nothing was imported")
+		}
+		fmt.Printf("Activity: %v new, %v duplicates\n", result.Activities, result.DuplicateActivities)
+		fmt.Printf("Cycles: %v new, %v duplicates\n", result.Cycles, result.DuplicateCycles)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", "", "file format: csv or jsonl (default is the file extension)")
+	importCmd.Flags().BoolVarP(&importDryRun, "dry-run", "n", false, "Report what would be imported without importing it")
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrades the databases to the current schema",
+	Long: `Migrations normally run when the server starts.  Use this to see 
+which migrations a database needs, or to run them by hand.  The server 
+can't be running at the same time.
+
+Example: 
+
+appliance-monitor migrate --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		configVersion, activityVersion, err := store.SchemaVersions()
+		if err != nil {
+			log.Fatalf("[ERROR] Problem getting the schema versions: %v", err)
+		}
+		fmt.Printf("Config database is schema version %v\n", configVersion)
+		fmt.Printf("Activity database is schema version %v\n", activityVersion)
+
+		steps, err := store.Migrate(migrateDryRun)
+		for _, step := range steps {
+			fmt.Printf("%s database version %v: %s\n", step.Database, step.Version, step.Description)
+		}
+
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+
+		switch {
+		case len(steps) == 0:
+			fmt.Println("Nothing to migrate")
+		case migrateDryRun:
+			fmt.Println("Dry run: the migrations succeeded, but nothing was changed")
+		default:
+			fmt.Println("Migrated")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().BoolVarP(&migrateDryRun, "dry-run", "n", false, "Run the migrations, then roll them back")
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// passwordCmd represents the password command
+var passwordCmd = &cobra.Command{
+	Use:   "password",
+	Short: "Sets the admin password",
+	Long: `Sets the admin password used to log in to the API.  The new password 
+is read from stdin.  Use this if the password has been forgotten.  The 
+server can't be running at the same time -- use POST /auth/password on 
+a running server instead.
+
+Example: 
+
+appliance-monitor password`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		defer store.Close()
+
+		fmt.Fprint(os.Stderr, "New admin password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.Fatalf("[ERROR] Problem reading the password: %v", err)
+		}
+
+		if err := store.Config.SetAdminPassword(strings.TrimRight(password, "\r\n")); err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+
+		log.Println("[INFO] Admin password set")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(passwordCmd)
+}
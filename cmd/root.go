@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/danesparza/appliance-monitor/data"
 	"github.com/hashicorp/logutils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -59,8 +60,10 @@ func initConfig() {
 	viper.SetDefault("server.port", "3000")
 	viper.SetDefault("server.bind", "")
 	viper.SetDefault("server.allowed-origins", "*")
+	viper.SetDefault("server.public-read", false)
 	viper.SetDefault("datastore.config", "config.db")
 	viper.SetDefault("datastore.activity", "activity.db")
+	viper.SetDefault("datastore.timeout", "5s")
 
 	viper.SetConfigName("config") // name of config file (without extension)
 	viper.AddConfigPath("$HOME")  // adding home directory as first search path
@@ -77,3 +80,14 @@ func initConfig() {
 		ProblemWithConfigFile = true
 	}
 }
+
+// openStore opens the config and activity databases
+func openStore() (*data.Store, error) {
+	log.Printf("[INFO] Config database: %s\n", viper.GetString("datastore.config"))
+	log.Printf("[INFO] Activities database: %s\n", viper.GetString("datastore.activity"))
+
+	return data.OpenStore(
+		viper.GetString("datastore.config"),
+		viper.GetString("datastore.activity"),
+		viper.GetDuration("datastore.timeout"))
+}
@@ -1,11 +1,8 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,10 +12,10 @@ import (
 	"github.com/danesparza/appliance-monitor/api"
 	"github.com/danesparza/appliance-monitor/data"
 	"github.com/danesparza/appliance-monitor/network"
+	"github.com/danesparza/appliance-monitor/retention"
 	"github.com/danesparza/appliance-monitor/sensordata"
 	"github.com/danesparza/appliance-monitor/system"
 	"github.com/danesparza/appliance-monitor/zeroconf"
-	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"github.com/rs/xid"
 	"github.com/spf13/cobra"
@@ -50,9 +47,9 @@ func start(cmd *cobra.Command, args []string) {
 
 	//	Trap program exit appropriately
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigch := make(chan os.Signal, 2)
 	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
-	go handleSignals(ctx, sigch, cancel)
 
 	//	Start the reboot helper
 	systemapi := &api.SystemAPI{Reboot: make(chan bool)}
@@ -60,7 +57,7 @@ func start(cmd *cobra.Command, args []string) {
 
 	//	See if we need to reset the host name and reboot:
 	name, _ := os.Hostname()
-	properhostname := fmt.Sprintf("%s-%s", "am", getMacAddr())
+	properhostname := network.DefaultHostname()
 
 	if name != properhostname {
 		err := network.ResetHostname(properhostname, systemapi.Reboot)
@@ -70,9 +67,36 @@ func start(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	//	Open the datastores.  They stay open until we shut down:
+	store, err := openStore()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return
+	}
+	defer store.Close()
+	go handleSignals(ctx, sigch, cancel, store)
+
+	//	Bring the datastores up to date.  If they're from a newer
+	//	version of the app, don't touch them:
+	steps, err := store.Migrate(false)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return
+	}
+
+	for _, step := range steps {
+		log.Printf("[INFO] Migrated the %s database to version %v: %s", step.Database, step.Version, step.Description)
+	}
+
+	//	Secrets in the config file aren't encrypted:
+	for _, setting := range data.Settings {
+		if setting.Secret && viper.IsSet("settings."+setting.Name) {
+			log.Printf("[WARN] %s is set in plaintext in the config file.  Set it with the config API instead, so it's encrypted, and remove it from the config file", setting.Name)
+		}
+	}
+
 	//	Get a reference to the config database
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
+	configDB := store.Config
 
 	//	Get the configured deviceId
 	deviceID, err := configDB.Get("deviceID")
@@ -96,40 +120,51 @@ func start(cmd *cobra.Command, args []string) {
 	//	Emit our deviceID:
 	log.Printf("[INFO] Using deviceID: %s\n", deviceID.Value)
 
-	//	Create a router and setup our REST endpoints...
-	Router := mux.NewRouter()
-
-	//	Setup our routes
-	Router.HandleFunc("/", api.ShowUI)
-
-	//	Activities
-	Router.HandleFunc("/activity", api.GetAllActivity).Methods("GET")
-	Router.HandleFunc("/activity", api.GetActivityInRange).Methods("POST")
-
-	//	Config
-	configapi := &api.ConfigAPI{Updated: make(chan bool)}
-	Router.HandleFunc("/config", configapi.GetAllConfig).Methods("GET")
-	Router.HandleFunc("/config", configapi.SetAllConfigItems).Methods("POST")
-	Router.HandleFunc("/config/{name}", configapi.GetConfigItem).Methods("GET")
-	Router.HandleFunc("/config/{name}", configapi.SetConfigItem).Methods("POST")
-	Router.HandleFunc("/config/{name}", configapi.RemoveConfigItem).Methods("DELETE")
+	//	If the monitor's own sensor isn't set up as a device yet, add it:
+	device, err := configDB.GetDevice(deviceID.Value)
+	if err != nil {
+		log.Printf("[ERROR] Problem getting device: %v", err)
+		return
+	}
 
-	//	System information
-	Router.HandleFunc("/system/state", systemapi.GetCurrentState).Methods("GET")
-	Router.HandleFunc("/system/wifi", systemapi.UpdateWifi).Methods("POST")
+	if device.ID == "" {
+		appName, _ := configDB.Get("name")
+		configDB.AddOrUpdateDevice(sensordata.DefaultDevice(deviceID.Value, appName.Value))
+	}
 
-	//	System resets
-	Router.HandleFunc("/reset/network", nil)
-	Router.HandleFunc("/reset/config", nil)
+	//	Setup our REST endpoints.  They're all under /v1, and
+	//	unversioned for older clients like the UI:
+	systemapi.Store = store
+	server := &api.Server{
+		Activity:      &api.ActivityAPI{Store: store},
+		Config:        &api.ConfigAPI{Store: store, Updated: make(chan bool)},
+		Devices:       &api.DeviceAPI{Store: store, Updated: make(chan bool)},
+		System:        systemapi,
+		Auth:          &api.AuthAPI{Store: store},
+		Subscriptions: &api.SubscriptionAPI{Store: store},
+		Hub:           sensordata.WsHub,
+		Store:         store,
+	}
+	Router := server.Router()
 
-	//	Websocket connections
-	Router.Handle("/ws", api.WsHandler{H: sensordata.WsHub})
+	//	The UI lives at the root:
+	Router.HandleFunc("/", api.ShowUI)
 
 	//	Start the collection process
-	go sensordata.CollectAndProcess(ctx)
+	go sensordata.CollectAndProcess(ctx, store, server.Devices.Updated)
 
 	//	Start the zeroconf server
-	go zeroconf.Serve(ctx, configapi.Updated)
+	go zeroconf.Serve(ctx, store.Config, server.Config.Updated)
+
+	//	Start pruning old activity
+	go retention.Serve(ctx, store)
+
+	//	Make sure the last network change worked, then broadcast the
+	//	setup network if the wifi isn't set up
+	go func() {
+		network.VerifyNetworkChange(ctx, systemapi.Reboot)
+		network.ServeProvisioning(ctx, store.Config, viper.GetInt("server.port"), systemapi.Reboot)
+	}()
 
 	//	If we don't have a UI directory specified...
 	if viper.GetString("server.ui-dir") == "" {
@@ -149,13 +184,34 @@ func start(cmd *cobra.Command, args []string) {
 		Router.PathPrefix("/ui").Handler(http.StripPrefix("/ui", http.FileServer(http.Dir(viper.GetString("server.ui-dir")))))
 	}
 
-	//	Setup the CORS options:
+	//	Check credentials on everything:
+	if hasPassword, _ := configDB.HasAdminPassword(); !hasPassword {
+		log.Println("[WARN] The admin password hasn't been set.  Set it with POST /auth/setup or the password command")
+	}
+
+	authenticator := api.Authenticator{Store: store, PublicRead: viper.GetBool("server.public-read")}
+	if authenticator.PublicRead {
+		log.Println("[INFO] Read-only routes are public")
+	}
+
+	//	Send browsers on the setup network to the UI:
+	captivePortal := api.CaptivePortal{
+		Active:  network.Provisioning,
+		Address: network.AccessPointAddress,
+		Hosts:   []string{properhostname, properhostname + ".local"},
+	}
+
+	//	Setup the CORS options.  Tokens go in the Authorization header, so
+	//	cookies are only allowed for specific origins -- browsers refuse them with '*':
+	allowedOrigins := strings.Split(viper.GetString("server.allowed-origins"), ",")
 	log.Printf("[INFO] Allowed CORS origins: %s\n", viper.GetString("server.allowed-origins"))
 
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   strings.Split(viper.GetString("server.allowed-origins"), ","),
-		AllowCredentials: true,
-	}).Handler(Router)
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: viper.GetString("server.allowed-origins") != "*",
+	}).Handler(captivePortal.Handler(authenticator.Handler(Router)))
 
 	//	Format the bound interface:
 	formattedInterface := viper.GetString("server.bind")
@@ -195,7 +251,7 @@ func init() {
 
 }
 
-func handleSignals(ctx context.Context, sigch <-chan os.Signal, cancel context.CancelFunc) {
+func handleSignals(ctx context.Context, sigch <-chan os.Signal, cancel context.CancelFunc, store *data.Store) {
 	select {
 	case <-ctx.Done():
 	case sig := <-sigch:
@@ -207,25 +263,11 @@ func handleSignals(ctx context.Context, sigch <-chan os.Signal, cancel context.C
 		}
 		log.Println("[INFO] Shutting down ...")
 		cancel()
-		os.Exit(0)
-	}
-}
 
-// getMacAddr gets the MAC hardware
-// address of the host machine
-func getMacAddr() (addr string) {
-	interfaces, err := net.Interfaces()
-
-	if err == nil {
-		for _, i := range interfaces {
-			if i.Flags&net.FlagUp != 0 && bytes.Compare(i.HardwareAddr, nil) != 0 {
-				// Don't use random as we have a real address
-				addr = strings.Replace(i.HardwareAddr.String(), ":", "", -1)
-				addr = addr[6:len(addr)]
-				break
-			}
+		//	Let any database writes finish before we go:
+		if err := store.Close(); err != nil {
+			log.Printf("[ERROR] Problem closing the datastores: %v", err)
 		}
+		os.Exit(0)
 	}
-
-	return
 }
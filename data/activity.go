@@ -2,7 +2,14 @@ package data
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -25,10 +32,39 @@ const (
 	AppStarted
 )
 
+// eventTypeNames are the names used for event types in exports
+var eventTypeNames = map[EventType]string{
+	ApplianceUknownState: "unknown",
+	ApplianceRunning:     "running",
+	ApplianceStopped:     "stopped",
+	AppStarted:           "appstarted",
+}
+
+// String gets the name of the event type
+func (e EventType) String() string {
+	if name, ok := eventTypeNames[e]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(e))
+}
+
+// ParseEventType gets the event type with the given name
+func ParseEventType(name string) (EventType, error) {
+	for eventType, eventName := range eventTypeNames {
+		if strings.EqualFold(name, eventName) {
+			return eventType, nil
+		}
+	}
+
+	return ApplianceUknownState, fmt.Errorf("Unknown event type: %s", name)
+}
+
 // Activity represents a single activity event
 type Activity struct {
 	Timestamp time.Time `json:"timestamp"`
 	Type      EventType `json:"eventtype"`
+	DeviceID  string    `json:"deviceId"`
 }
 
 // CloudActivity represents a single activity event in the cloud
@@ -38,27 +74,55 @@ type CloudActivity struct {
 	DeviceID  string    `json:"deviceId"`
 }
 
-// ActivityDB is the BoltDB database for activity information
+// Cycle represents a single run of a device, from when it started to when it stopped
+type Cycle struct {
+	DeviceID  string    `json:"deviceId"`
+	StartTime time.Time `json:"starttime"`
+	EndTime   time.Time `json:"endtime"`
+
+	// EnergyWh is the energy used during the cycle, in watt-hours.  It's measured
+	// for devices that can measure power, and estimated for the others
+	EnergyWh float64 `json:"energywh"`
+
+	// Cost is the cost of the energy used during the cycle, using the tariff
+	// at the time the cycle was recorded
+	Cost float64 `json:"cost"`
+}
+
+// timeKeySize is the size of an activity or cycle key
+const timeKeySize = 16
+
+// The range of times that can be stored in a key
+var (
+	minKeyTime = time.Unix(0, math.MinInt64)
+	maxKeyTime = time.Unix(0, math.MaxInt64)
+)
+
+// ActivityDB is the BoltDB database for activity information.  Activities
+// and cycles are kept in a separate bucket for each device.  Open it once
+// with OpenActivityDB and share it -- BoltDB locks the database file
 type ActivityDB struct {
-	Database string
+	db      *bolt.DB
+	path    string
+	timeout time.Duration
+
+	//	Compact swaps out the database file, so it locks everything else out
+	mu sync.RWMutex
 }
 
 // Add inserts or updates activities
-func (store ActivityDB) Add(activityItem Activity) (Activity, error) {
-
+func (store *ActivityDB) Add(activityItem Activity) (Activity, error) {
 	//	Our return item:
 	retval := Activity{}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
+	//	If there is no device, throw an error:
+	if strings.TrimSpace(activityItem.DeviceID) == "" {
+		return retval, errors.New("Activity device id can't be blank")
 	}
 
 	//	Update the database:
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("activities"))
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := createDeviceBucket(tx, "activities", activityItem.DeviceID)
 		if err != nil {
 			return err
 		}
@@ -74,8 +138,14 @@ func (store ActivityDB) Add(activityItem Activity) (Activity, error) {
 			return err
 		}
 
-		//	Store it, with the 'name' as the key:
-		return b.Put([]byte(activityItem.Timestamp.Format(time.RFC3339)), encoded)
+		//	Store it, keyed by time.  The sequence keeps items
+		//	with the same timestamp from overwriting each other:
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return b.Put(timeKey(activityItem.Timestamp, seq), encoded)
 	})
 
 	//	Set our return item:
@@ -84,73 +154,90 @@ func (store ActivityDB) Add(activityItem Activity) (Activity, error) {
 	return retval, err
 }
 
-// GetRange gets all activities in a given range
-func (store ActivityDB) GetRange(startDate, endDate time.Time) ([]Activity, error) {
+// GetRange gets all activities in a given range for a device.  If deviceID
+// is blank, gets activities for all devices
+func (store *ActivityDB) GetRange(deviceID string, startDate, endDate time.Time) ([]Activity, error) {
 	retval := []Activity{}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
 	//	Get the items in the given range:
-	err = db.View(func(tx *bolt.Tx) error {
+	err := store.view(func(tx *bolt.Tx) error {
 
-		b := tx.Bucket([]byte("activities"))
-		if b == nil {
-			return nil
-		}
+		// Format our timespan:
+		min, max := rangeKeys(startDate, endDate)
 
-		c := b.Cursor()
+		for _, b := range deviceBuckets(tx, "activities", deviceID) {
+			c := b.Cursor()
 
-		// Format our timespan:
-		min := []byte(startDate.Format(time.RFC3339))
-		max := []byte(endDate.Format(time.RFC3339))
+			// Iterate over the timespan
+			for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
 
-		// Iterate over the timespan
-		for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+				//	Unmarshal data into our config item
+				activity := Activity{}
+				if err := json.Unmarshal(v, &activity); err != nil {
+					return err
+				}
 
-			//	Unmarshal data into our config item
-			activity := Activity{}
-			if err := json.Unmarshal(v, &activity); err != nil {
-				return err
+				//	Add to the return slice:
+				retval = append(retval, activity)
 			}
-
-			//	Add to the return slice:
-			retval = append(retval, activity)
 		}
 
 		return nil
 	})
 
 	//	Return our slice:
+	sortActivities(retval)
 	return retval, err
 }
 
-// GetAllActivity returns all activity
-func (store ActivityDB) GetAllActivity() ([]Activity, error) {
+// GetAllActivity returns all activity for a device.  If deviceID
+// is blank, returns activity for all devices
+func (store *ActivityDB) GetAllActivity(deviceID string) ([]Activity, error) {
 	retval := []Activity{}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
 	//	Get all the items:
-	err = db.View(func(tx *bolt.Tx) error {
+	err := store.view(func(tx *bolt.Tx) error {
 
-		b := tx.Bucket([]byte("activities"))
-		if b == nil {
-			return nil
+		for _, b := range deviceBuckets(tx, "activities", deviceID) {
+			c := b.Cursor()
+
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+
+				//	Unmarshal data into our config item
+				activity := Activity{}
+				if err := json.Unmarshal(v, &activity); err != nil {
+					return err
+				}
+
+				//	Add to the return slice:
+				retval = append(retval, activity)
+			}
 		}
 
-		c := b.Cursor()
+		return nil
+	})
 
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+	//	Return our slice:
+	sortActivities(retval)
+	return retval, err
+}
+
+// GetLatestActivity returns the most recent activity for a device (or an empty
+// Activity if no activity found).  If deviceID is blank, returns the most
+// recent activity for any device
+func (store *ActivityDB) GetLatestActivity(deviceID string) (Activity, error) {
+	retval := Activity{}
+
+	//	Get all the items:
+	err := store.view(func(tx *bolt.Tx) error {
+
+		for _, b := range deviceBuckets(tx, "activities", deviceID) {
+
+			//	Get the last item:
+			_, v := b.Cursor().Last()
+			if v == nil {
+				continue
+			}
 
 			//	Unmarshal data into our config item
 			activity := Activity{}
@@ -158,90 +245,275 @@ func (store ActivityDB) GetAllActivity() ([]Activity, error) {
 				return err
 			}
 
-			//	Add to the return slice:
-			retval = append(retval, activity)
+			//	Keep the most recent one:
+			if activity.Timestamp.After(retval.Timestamp) {
+				retval = activity
+			}
 		}
 
 		return nil
 	})
 
-	//	Return our slice:
-	return retval, nil
+	//	Return our item:
+	return retval, err
 }
 
-// GetLatestActivity returns the most recent activity (or an empty Activity if no activity found)
-func (store ActivityDB) GetLatestActivity() (Activity, error) {
-	retval := Activity{}
+// DeleteRange removes all activities in a given range for a device.  If
+// deviceID is blank, removes activities for all devices
+func (store *ActivityDB) DeleteRange(deviceID string, startDate, endDate time.Time) error {
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
+	//	Get the items in the given range:
+	err := store.update(func(tx *bolt.Tx) error {
 
-	//	Get all the items:
-	err = db.View(func(tx *bolt.Tx) error {
+		// Format our timespan:
+		min, max := rangeKeys(startDate, endDate)
 
-		b := tx.Bucket([]byte("activities"))
-		if b == nil {
-			return nil
+		for _, b := range deviceBuckets(tx, "activities", deviceID) {
+
+			//	Find the keys in the timespan.  Deleting while we iterate
+			//	would move the cursor out from under us:
+			keys := [][]byte{}
+			c := b.Cursor()
+			for k, _ := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, _ = c.Next() {
+				keys = append(keys, k)
+			}
+
+			//	Delete the keys:
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
 		}
 
-		//	Get the last item:
-		_, v := b.Cursor().Last()
+		return nil
+	})
+
+	//	Return
+	return err
+}
+
+// AddCycle inserts a device cycle
+func (store *ActivityDB) AddCycle(cycle Cycle) (Cycle, error) {
 
-		//	Unmarshal data into our config item
-		if err := json.Unmarshal(v, &retval); err != nil {
+	//	If there is no device, throw an error:
+	if strings.TrimSpace(cycle.DeviceID) == "" {
+		return cycle, errors.New("Cycle device id can't be blank")
+	}
+
+	//	Update the database:
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := createDeviceBucket(tx, "cycles", cycle.DeviceID)
+		if err != nil {
+			return err
+		}
+
+		//	Serialize to JSON format
+		encoded, err := json.Marshal(cycle)
+		if err != nil {
+			return err
+		}
+
+		//	Store it, keyed by the start time:
+		seq, err := b.NextSequence()
+		if err != nil {
 			return err
 		}
 
+		return b.Put(timeKey(cycle.StartTime, seq), encoded)
+	})
+
+	return cycle, err
+}
+
+// GetCycles gets all cycles that started in a given range for a device.  If
+// deviceID is blank, gets cycles for all devices
+func (store *ActivityDB) GetCycles(deviceID string, startDate, endDate time.Time) ([]Cycle, error) {
+	retval := []Cycle{}
+
+	//	Get the items in the given range:
+	err := store.view(func(tx *bolt.Tx) error {
+
+		// Format our timespan:
+		min, max := rangeKeys(startDate, endDate)
+
+		for _, b := range deviceBuckets(tx, "cycles", deviceID) {
+			c := b.Cursor()
+
+			// Iterate over the timespan
+			for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+
+				//	Unmarshal data into our cycle
+				cycle := Cycle{}
+				if err := json.Unmarshal(v, &cycle); err != nil {
+					return err
+				}
+
+				//	Add to the return slice:
+				retval = append(retval, cycle)
+			}
+		}
+
 		return nil
 	})
 
-	//	Return our slice:
-	return retval, nil
+	//	Return our slice, oldest first:
+	sort.SliceStable(retval, func(i, j int) bool {
+		return retval[i].StartTime.Before(retval[j].StartTime)
+	})
+
+	return retval, err
+}
+
+// timeKey creates a key that sorts by time: the UTC time in nanoseconds, then
+// a sequence number to keep items with the same time apart.  Both are big-endian
+func timeKey(when time.Time, seq uint64) []byte {
+	key := make([]byte, timeKeySize)
+	binary.BigEndian.PutUint64(key, keyTime(when))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
 }
 
-// DeleteRange removes all activities in a given range
-func (store ActivityDB) DeleteRange(startDate, endDate time.Time) error {
+// rangeKeys gets the first and last possible keys for a time range
+func rangeKeys(startDate, endDate time.Time) ([]byte, []byte) {
+	return timeKey(startDate, 0), timeKey(endDate, math.MaxUint64)
+}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return err
+// keyTime converts a time to nanoseconds that sort as unsigned numbers.  Times
+// that can't be represented in nanoseconds are clamped
+func keyTime(when time.Time) uint64 {
+	switch {
+	case when.Before(minKeyTime):
+		return 0
+	case when.After(maxKeyTime):
+		return math.MaxUint64
 	}
 
-	//	Get the items in the given range:
-	err = db.Update(func(tx *bolt.Tx) error {
+	//	Flip the sign bit so times before 1970 sort first:
+	return uint64(when.UnixNano()) ^ (1 << 63)
+}
+
+// GetDeviceIDs gets the ids of all devices that have activity
+func (store *ActivityDB) GetDeviceIDs() ([]string, error) {
+	retval := []string{}
 
+	err := store.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("activities"))
 		if b == nil {
 			return nil
 		}
 
+		//	Device buckets have a nil value:
 		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil {
+				retval = append(retval, string(k))
+			}
+		}
 
-		// Format our timespan:
-		min := []byte(startDate.Format(time.RFC3339))
-		max := []byte(endDate.Format(time.RFC3339))
+		return nil
+	})
 
-		// Iterate over the timespan
-		for k, _ := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, _ = c.Next() {
+	return retval, err
+}
 
-			//	Delete the key:
-			delerr := b.Delete(k)
+// NewestTimestamp gets the timestamp of the nth newest activity for a device
+// (1 is the newest).  If the device has fewer activities, returns a zero time
+func (store *ActivityDB) NewestTimestamp(deviceID string, n int) (time.Time, error) {
+	retval := time.Time{}
 
-			//	If we have an error, return early and with the error
-			if delerr != nil {
-				return err
-			}
+	//	If there is no device, throw an error:
+	if strings.TrimSpace(deviceID) == "" {
+		return retval, errors.New("Device id can't be blank")
+	}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		buckets := deviceBuckets(tx, "activities", deviceID)
+		if len(buckets) == 0 || n < 1 {
+			return nil
+		}
+
+		//	Walk back from the newest:
+		c := buckets[0].Cursor()
+		k, v := c.Last()
+		for i := 1; k != nil && i < n; i++ {
+			k, v = c.Prev()
+		}
+
+		if k == nil {
+			return nil
+		}
+
+		activity := Activity{}
+		if err := json.Unmarshal(v, &activity); err != nil {
+			return err
 		}
 
+		retval = activity.Timestamp
 		return nil
 	})
 
-	//	Return
-	return nil
+	return retval, err
+}
+
+// view runs a read-only transaction
+func (store *ActivityDB) view(fn func(*bolt.Tx) error) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.db.View(fn)
+}
+
+// update runs a read-write transaction
+func (store *ActivityDB) update(fn func(*bolt.Tx) error) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.db.Update(fn)
+}
+
+// createDeviceBucket gets the bucket for a device, creating it if it doesn't exist
+func createDeviceBucket(tx *bolt.Tx, name, deviceID string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.CreateBucketIfNotExists([]byte(deviceID))
+}
+
+// deviceBuckets gets the bucket for a device.  If deviceID is blank,
+// gets the buckets for all devices
+func deviceBuckets(tx *bolt.Tx, name, deviceID string) []*bolt.Bucket {
+	retval := []*bolt.Bucket{}
+
+	b := tx.Bucket([]byte(name))
+	if b == nil {
+		return retval
+	}
+
+	//	If we have a device, just get its bucket:
+	if deviceID != "" {
+		if db := b.Bucket([]byte(deviceID)); db != nil {
+			retval = append(retval, db)
+		}
+		return retval
+	}
+
+	//	Otherwise, get all the nested buckets:
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			retval = append(retval, b.Bucket(k))
+		}
+	}
+
+	return retval
+}
+
+// sortActivities sorts activities from oldest to newest
+func sortActivities(activities []Activity) {
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Timestamp.Before(activities[j].Timestamp)
+	})
 }
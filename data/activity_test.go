@@ -22,20 +22,22 @@ func TestActivity_Database_ShouldNotExistYet(t *testing.T) {
 	}
 }
 
-func TestActivity_Init_Successful(t *testing.T) {
+func TestActivity_Open_Successful(t *testing.T) {
 	//	Arrange
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ConfigDB{
-		Database: filename}
-
 	//	Act
-	db.InitStore()
+	db, err := data.OpenActivityDB(filename, time.Second)
 
 	//	Assert
+	if err != nil {
+		t.Fatalf("Open failed: Should have opened the database without error: %v", err)
+	}
+	defer db.Close()
+
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		t.Errorf("Init failed: Activity db file %s was not created", filename)
+		t.Errorf("Open failed: Activity db file %s was not created", filename)
 	}
 }
 
@@ -44,11 +46,15 @@ func TestActivity_Set_Successful(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	ct1 := data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now(),
 		Type:      data.ApplianceRunning}
 
@@ -70,13 +76,16 @@ func TestActivity_GetRange_NoItems_NoErrors(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	No items are in the database!
 
 	//	Act
-	response, err := db.GetRange(time.Now().Add(-10*time.Minute), time.Now())
+	response, err := db.GetRange("", time.Now().Add(-10*time.Minute), time.Now())
 
 	//	Assert
 	if err != nil {
@@ -93,32 +102,40 @@ func TestActivity_GetRange_ItemsInRange_ReturnsItems(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-1 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-2 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-3 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-4 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-5 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	//	Act
-	response, err := db.GetRange(time.Now().Add(-4*time.Minute-10*time.Second), time.Now())
+	response, err := db.GetRange("", time.Now().Add(-4*time.Minute-10*time.Second), time.Now())
 
 	//	Assert
 	if err != nil {
@@ -135,32 +152,40 @@ func TestActivity_GetAllActivity_ItemsInDB_ReturnsItems(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-1 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-2 * time.Minute),
 		Type:      data.ApplianceRunning})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-3 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-4 * time.Minute),
 		Type:      data.ApplianceRunning})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-5 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	//	Act
-	response, err := db.GetAllActivity()
+	response, err := db.GetAllActivity("")
 
 	//	Assert
 	if err != nil {
@@ -177,34 +202,42 @@ func TestActivity_DeleteRange_ItemsInRange_DeletesItems(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-1 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-2 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-3 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-4 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-5 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	//	Act
-	response1, err1 := db.GetRange(time.Now().Add(-10*time.Minute), time.Now())
-	errDel := db.DeleteRange(time.Now().Add(-10*time.Minute), time.Now().Add(-4*time.Minute))
-	response2, err2 := db.GetRange(time.Now().Add(-10*time.Minute), time.Now())
+	response1, err1 := db.GetRange("", time.Now().Add(-10*time.Minute), time.Now())
+	errDel := db.DeleteRange("", time.Now().Add(-10*time.Minute), time.Now().Add(-4*time.Minute))
+	response2, err2 := db.GetRange("", time.Now().Add(-10*time.Minute), time.Now())
 
 	//	Assert
 	if err1 != nil {
@@ -233,13 +266,16 @@ func TestActivity_GetLatestActivity_NoItems_NoErrors(t *testing.T) {
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	No activities added
 
 	//	Act
-	response, err := db.GetLatestActivity()
+	response, err := db.GetLatestActivity("")
 
 	//	Assert
 	if err != nil {
@@ -256,32 +292,40 @@ func TestActivity_GetLatestActivity_ItemsInDB_ReturnsMostRecentItem(t *testing.T
 	filename := "testactivity.db"
 	defer os.Remove(filename)
 
-	db := data.ActivityDB{
-		Database: filename}
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-1 * time.Minute),
 		Type:      data.ApplianceRunning})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-2 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-3 * time.Minute),
 		Type:      data.ApplianceRunning})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-4 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	db.Add(data.Activity{
+		DeviceID:  "testdevice",
 		Timestamp: time.Now().Add(-5 * time.Minute),
 		Type:      data.ApplianceStopped})
 
 	//	Act
-	response, err := db.GetLatestActivity()
+	response, err := db.GetLatestActivity("")
 
 	//	Assert
 	if err != nil {
@@ -292,3 +336,268 @@ func TestActivity_GetLatestActivity_ItemsInDB_ReturnsMostRecentItem(t *testing.T
 		t.Errorf("Get latest failed: Should have returned most recent item.  Instead, got %v / %v", response.Timestamp, response.Type)
 	}
 }
+
+func TestActivity_Add_NoDeviceID_NotSuccessful(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	_, err = db.Add(data.Activity{
+		Timestamp: time.Now(),
+		Type:      data.ApplianceRunning})
+
+	//	Assert
+	if err == nil {
+		t.Errorf("Add failed: Should have thrown an error about no device id")
+	}
+}
+
+func TestActivity_GetRange_MultipleDevices_ReturnsItemsForDevice(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.Add(data.Activity{
+		DeviceID:  "washer",
+		Timestamp: time.Now().Add(-1 * time.Minute),
+		Type:      data.ApplianceStopped})
+
+	db.Add(data.Activity{
+		DeviceID:  "dryer",
+		Timestamp: time.Now().Add(-2 * time.Minute),
+		Type:      data.ApplianceStopped})
+
+	db.Add(data.Activity{
+		DeviceID:  "washer",
+		Timestamp: time.Now().Add(-3 * time.Minute),
+		Type:      data.ApplianceRunning})
+
+	//	Act
+	washer, err1 := db.GetRange("washer", time.Now().Add(-10*time.Minute), time.Now())
+	all, err2 := db.GetRange("", time.Now().Add(-10*time.Minute), time.Now())
+
+	//	Assert
+	if err1 != nil || err2 != nil {
+		t.Errorf("Get range failed: Should have gotten the ranges without error: %v / %v", err1, err2)
+	}
+
+	if len(washer) != 2 {
+		t.Errorf("Get range failed: Should have gotten 2 items for the device.  Instead, got %v", len(washer))
+	}
+
+	for _, activity := range washer {
+		if activity.DeviceID != "washer" {
+			t.Errorf("Get range failed: Should only have gotten items for the device.  Got %+v", activity)
+		}
+	}
+
+	if len(all) != 3 {
+		t.Errorf("Get range failed: Should have gotten 3 items for all devices.  Instead, got %v", len(all))
+	}
+
+	//	Items for all devices should still be in order:
+	for i := 1; i < len(all); i++ {
+		if all[i].Timestamp.Before(all[i-1].Timestamp) {
+			t.Errorf("Get range failed: Items should be sorted oldest first.  Got %+v", all)
+		}
+	}
+}
+
+func TestActivity_GetLatestActivity_MultipleDevices_ReturnsMostRecentItemForDevice(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.Add(data.Activity{
+		DeviceID:  "washer",
+		Timestamp: time.Now().Add(-1 * time.Minute),
+		Type:      data.ApplianceRunning})
+
+	db.Add(data.Activity{
+		DeviceID:  "dryer",
+		Timestamp: time.Now().Add(-2 * time.Minute),
+		Type:      data.ApplianceStopped})
+
+	//	Act
+	dryer, err1 := db.GetLatestActivity("dryer")
+	latest, err2 := db.GetLatestActivity("")
+
+	//	Assert
+	if err1 != nil || err2 != nil {
+		t.Errorf("Get latest failed: Should have gotten the items without error: %v / %v", err1, err2)
+	}
+
+	if dryer.DeviceID != "dryer" || dryer.Type != data.ApplianceStopped {
+		t.Errorf("Get latest failed: Should have returned most recent item for the device.  Instead, got %+v", dryer)
+	}
+
+	if latest.DeviceID != "washer" {
+		t.Errorf("Get latest failed: Should have returned most recent item for any device.  Instead, got %+v", latest)
+	}
+}
+
+func TestActivity_AddCycle_ThenGetCycles_ReturnsItemsForDevice(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.AddCycle(data.Cycle{
+		DeviceID:  "washer",
+		StartTime: time.Now().Add(-60 * time.Minute),
+		EndTime:   time.Now().Add(-20 * time.Minute)})
+
+	db.AddCycle(data.Cycle{
+		DeviceID:  "dryer",
+		StartTime: time.Now().Add(-15 * time.Minute),
+		EndTime:   time.Now().Add(-5 * time.Minute)})
+
+	//	Act
+	washer, err1 := db.GetCycles("washer", time.Now().Add(-2*time.Hour), time.Now())
+	all, err2 := db.GetCycles("", time.Now().Add(-2*time.Hour), time.Now())
+
+	//	Assert
+	if err1 != nil || err2 != nil {
+		t.Errorf("GetCycles failed: Should have gotten the cycles without error: %v / %v", err1, err2)
+	}
+
+	if len(washer) != 1 || washer[0].DeviceID != "washer" {
+		t.Errorf("GetCycles failed: Should have gotten 1 cycle for the device.  Instead, got %+v", washer)
+	}
+
+	if len(all) != 2 {
+		t.Errorf("GetCycles failed: Should have gotten 2 cycles for all devices.  Instead, got %v", len(all))
+	}
+}
+
+func TestActivity_Add_SameSecond_KeepsAllItemsInOrder(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().Truncate(time.Second)
+
+	//	Act
+	db.Add(data.Activity{DeviceID: "testdevice", Timestamp: now.Add(200 * time.Millisecond), Type: data.ApplianceStopped})
+	db.Add(data.Activity{DeviceID: "testdevice", Timestamp: now.Add(100 * time.Millisecond), Type: data.ApplianceRunning})
+	db.Add(data.Activity{DeviceID: "testdevice", Timestamp: now.Add(200 * time.Millisecond), Type: data.ApplianceRunning})
+	response, err := db.GetRange("testdevice", now, now.Add(time.Second))
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Add failed: Should have gotten the items without error: %v", err)
+	}
+
+	if len(response) != 3 {
+		t.Fatalf("Add failed: Items in the same second shouldn't overwrite each other.  Expected 3 items, got %v", len(response))
+	}
+
+	if response[0].Type != data.ApplianceRunning || response[1].Type != data.ApplianceStopped {
+		t.Errorf("Add failed: Items should be in time order, then the order they were added.  Got %+v", response)
+	}
+}
+
+func TestActivity_GetRange_DifferentTimeZones_ReturnsItemsInRange(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	eastern := time.FixedZone("EST", -5*60*60)
+	when := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	//	The same instant, stored with a different zone:
+	db.Add(data.Activity{DeviceID: "testdevice", Timestamp: when.In(eastern), Type: data.ApplianceRunning})
+
+	//	Act
+	inRange, err1 := db.GetRange("testdevice", when.Add(-1*time.Minute), when.Add(time.Minute))
+	outOfRange, err2 := db.GetRange("testdevice", when.Add(-6*time.Hour), when.Add(-4*time.Hour))
+
+	//	Assert
+	if err1 != nil || err2 != nil {
+		t.Errorf("Get range failed: Should have gotten the items without error: %v / %v", err1, err2)
+	}
+
+	if len(inRange) != 1 {
+		t.Errorf("Get range failed: Should have found the item regardless of zone.  Got %v items", len(inRange))
+	}
+
+	if len(outOfRange) != 0 {
+		t.Errorf("Get range failed: Shouldn't have matched the local time of the item.  Got %v items", len(outOfRange))
+	}
+}
+
+func TestActivity_Compact_AfterDelete_KeepsItemsAndShrinks(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < 2000; i++ {
+		db.Add(data.Activity{DeviceID: "testdevice", Timestamp: now.Add(time.Duration(-i) * time.Second), Type: data.ApplianceRunning})
+	}
+	db.DeleteRange("testdevice", now.Add(-2*time.Hour), now.Add(-1*time.Minute))
+
+	//	Act
+	before, after, err := db.Compact()
+	response, _ := db.GetAllActivity("testdevice")
+	_, addErr := db.Add(data.Activity{DeviceID: "testdevice", Type: data.ApplianceStopped})
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Compact failed: Should have compacted without error: %v", err)
+	}
+
+	if after >= before {
+		t.Errorf("Compact failed: Should have made the file smaller.  Went from %v to %v bytes", before, after)
+	}
+
+	if len(response) != 60 {
+		t.Errorf("Compact failed: Should have kept the 60 remaining items.  Instead, got %v", len(response))
+	}
+
+	if addErr != nil {
+		t.Errorf("Compact failed: Should still be able to add activity: %v", addErr)
+	}
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/rs/xid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The scopes an API token can have.  Each scope includes the ones before it
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// MinPasswordLength is the shortest password allowed
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when a password or token doesn't check out
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+
+	// ErrAdminPasswordSet is returned when setting up an admin password that's already set
+	ErrAdminPasswordSet = errors.New("The admin password has already been set")
+
+	// scopeLevels ranks the scopes
+	scopeLevels = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+)
+
+// APIToken is a bearer token used to call the API.  Only a hash of the
+// token is stored -- the token itself is only shown when it's created
+type APIToken struct {
+	// ID is the unique token identifier.  It's also the first part of the token
+	ID string `json:"id"`
+
+	// Name describes what the token is for
+	Name string `json:"name"`
+
+	// Scope is what the token is allowed to do (read / write / admin)
+	Scope string `json:"scope"`
+
+	// Hash is the SHA-256 hash of the secret part of the token
+	Hash string `json:"hash,omitempty"`
+
+	// Created is when the token was created
+	Created time.Time `json:"created"`
+}
+
+// ValidScope returns true if the scope is one we know about
+func ValidScope(scope string) bool {
+	_, found := scopeLevels[scope]
+	return found
+}
+
+// ScopeAllows returns true if the scope has at least the needed access
+func ScopeAllows(scope, needed string) bool {
+	return ValidScope(scope) && scopeLevels[scope] >= scopeLevels[needed]
+}
+
+// HasAdminPassword returns true if the admin password has been set
+func (store *ConfigDB) HasAdminPassword() (bool, error) {
+	hash, err := store.adminPasswordHash()
+	return len(hash) > 0, err
+}
+
+// SetAdminPassword sets the admin password, and ends the admin's sessions
+func (store *ConfigDB) SetAdminPassword(password string) error {
+	return store.setAdminPassword(password, false)
+}
+
+// SetupAdminPassword sets the admin password on first run.  Returns
+// ErrAdminPasswordSet if it's already been set
+func (store *ConfigDB) SetupAdminPassword(password string) error {
+	return store.setAdminPassword(password, true)
+}
+
+// setAdminPassword sets the admin password.  If firstRun is set, it's only
+// set if there isn't one yet -- checked in the same transaction, so two
+// first run requests can't both set it
+func (store *ConfigDB) setAdminPassword(password string, firstRun bool) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("The password needs to be at least %v characters", MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("auth"))
+		if err != nil {
+			return err
+		}
+
+		if firstRun && len(b.Get([]byte("adminpassword"))) > 0 {
+			return ErrAdminPasswordSet
+		}
+
+		if err := b.Put([]byte("adminpassword"), hash); err != nil {
+			return err
+		}
+
+		//	A new password ends the sessions logged in with the old one:
+		return removeSessions(tx, func(s Session) bool { return s.Username == AdminUsername })
+	})
+}
+
+// CheckAdminPassword returns ErrInvalidCredentials if the password isn't the admin password
+func (store *ConfigDB) CheckAdminPassword(password string) error {
+	hash, err := store.adminPasswordHash()
+	if err != nil {
+		return err
+	}
+
+	if len(hash) == 0 || bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// GetAllTokens gets all API tokens.  The hashes aren't included
+func (store *ConfigDB) GetAllTokens() ([]APIToken, error) {
+	//	Our return item
+	retval := []APIToken{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("tokens"))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			token := APIToken{}
+			if err := json.Unmarshal(v, &token); err != nil {
+				return err
+			}
+
+			token.Hash = ""
+			retval = append(retval, token)
+			return nil
+		})
+	})
+
+	return retval, err
+}
+
+// CreateToken creates an API token and returns it, along with the token
+// value to send in the Authorization header.  The value can't be retrieved later
+func (store *ConfigDB) CreateToken(name, scope string) (APIToken, string, error) {
+	//	Our return item:
+	retval := APIToken{Name: name, Scope: scope}
+
+	if strings.TrimSpace(name) == "" {
+		return retval, "", errors.New("Token name can't be blank")
+	}
+
+	if !ValidScope(scope) {
+		return retval, "", fmt.Errorf("Unknown scope: %s", scope)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return retval, "", err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	retval.ID = xid.New().String()
+	retval.Hash = hashTokenSecret(encodedSecret)
+	retval.Created = time.Now()
+
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("tokens"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(retval)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(retval.ID), encoded)
+	})
+
+	retval.Hash = ""
+	return retval, retval.ID + "." + encodedSecret, err
+}
+
+// CheckToken finds the API token for a token value.  Returns ErrInvalidCredentials
+// if it isn't a valid token
+func (store *ConfigDB) CheckToken(value string) (APIToken, error) {
+	//	Our return item:
+	retval := APIToken{}
+
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return retval, ErrInvalidCredentials
+	}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("tokens"))
+		if b == nil {
+			return ErrInvalidCredentials
+		}
+
+		tokenBytes := b.Get([]byte(parts[0]))
+		if len(tokenBytes) == 0 {
+			return ErrInvalidCredentials
+		}
+
+		return json.Unmarshal(tokenBytes, &retval)
+	})
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(retval.Hash), []byte(hashTokenSecret(parts[1]))) != 1 {
+		return APIToken{}, ErrInvalidCredentials
+	}
+
+	retval.Hash = ""
+	return retval, nil
+}
+
+// RemoveToken removes an API token
+func (store *ConfigDB) RemoveToken(id string) error {
+	//	If there is no token id, throw an error:
+	if strings.TrimSpace(id) == "" {
+		return errors.New("Token id can't be blank")
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("tokens"))
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(id))
+	})
+}
+
+// adminPasswordHash gets the bcrypt hash of the admin password
+func (store *ConfigDB) adminPasswordHash() ([]byte, error) {
+	var retval []byte
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("auth"))
+		if b != nil {
+			retval = append(retval, b.Get([]byte("adminpassword"))...)
+		}
+
+		return nil
+	})
+
+	return retval, err
+}
+
+// hashTokenSecret hashes the secret part of a token.  Tokens are random, so
+// a fast hash is fine
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package data_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	The admin password should check out once it's set, and nothing else should
+func TestAuth_SetAdminPassword_ThenCheck_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	before, _ := db.HasAdminPassword()
+	err = db.SetAdminPassword("correct horse")
+	after, _ := db.HasAdminPassword()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("SetAdminPassword failed: Should have set the password without error: %v", err)
+	}
+
+	if before || !after {
+		t.Errorf("HasAdminPassword failed: Expected false before and true after, but got %v and %v", before, after)
+	}
+
+	if err := db.CheckAdminPassword("correct horse"); err != nil {
+		t.Errorf("CheckAdminPassword failed: The right password should check out: %v", err)
+	}
+
+	if err := db.CheckAdminPassword("battery staple"); err != data.ErrInvalidCredentials {
+		t.Errorf("CheckAdminPassword failed: The wrong password should be invalid, but got %v", err)
+	}
+}
+
+func TestAuth_SetAdminPassword_TooShort_NotSuccessful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	err = db.SetAdminPassword("short")
+
+	//	Assert
+	if err == nil {
+		t.Errorf("SetAdminPassword failed: Should have thrown an error about the password length")
+	}
+}
+
+//	Only one of several first run requests should get to set the admin password
+func TestAuth_SetupAdminPassword_Concurrent_OnlyOneSucceeds(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	results := make(chan error, 5)
+
+	//	Act
+	for i := 0; i < cap(results); i++ {
+		go func(i int) {
+			results <- db.SetupAdminPassword(fmt.Sprintf("password number %v", i))
+		}(i)
+	}
+
+	//	Assert
+	succeeded := 0
+	for i := 0; i < cap(results); i++ {
+		switch err := <-results; err {
+		case nil:
+			succeeded++
+		case data.ErrAdminPasswordSet:
+		default:
+			t.Errorf("SetupAdminPassword failed: Unexpected error %v", err)
+		}
+	}
+
+	if succeeded != 1 {
+		t.Errorf("SetupAdminPassword failed: Only one request should have set the password, but %v did", succeeded)
+	}
+}
+
+//	A token should check out until it's removed
+func TestAuth_CreateToken_ThenCheckAndRemove_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	token, value, err := db.CreateToken("dashboard", data.ScopeRead)
+	checked, checkErr := db.CheckToken(value)
+	_, wrongErr := db.CheckToken(token.ID + ".notthesecret")
+	tokens, _ := db.GetAllTokens()
+	db.RemoveToken(token.ID)
+	_, removedErr := db.CheckToken(value)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("CreateToken failed: Should have created the token without error: %v", err)
+	}
+
+	if checkErr != nil || checked.ID != token.ID || checked.Scope != data.ScopeRead {
+		t.Errorf("CheckToken failed: Should have found the token, but got %+v / %v", checked, checkErr)
+	}
+
+	if wrongErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckToken failed: The wrong secret should be invalid, but got %v", wrongErr)
+	}
+
+	if len(tokens) != 1 || tokens[0].Hash != "" {
+		t.Errorf("GetAllTokens failed: Should have listed the token without its hash, but got %+v", tokens)
+	}
+
+	if removedErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckToken failed: A removed token should be invalid, but got %v", removedErr)
+	}
+}
+
+func TestAuth_ScopeAllows_HigherScopesIncludeLower(t *testing.T) {
+	//	Arrange
+	tests := []struct {
+		scope, needed string
+		expected      bool
+	}{
+		{data.ScopeAdmin, data.ScopeWrite, true},
+		{data.ScopeWrite, data.ScopeRead, true},
+		{data.ScopeRead, data.ScopeRead, true},
+		{data.ScopeRead, data.ScopeWrite, false},
+		{data.ScopeWrite, data.ScopeAdmin, false},
+		{"bogus", data.ScopeRead, false},
+	}
+
+	for _, test := range tests {
+		//	Act
+		response := data.ScopeAllows(test.scope, test.needed)
+
+		//	Assert
+		if response != test.expected {
+			t.Errorf("ScopeAllows failed: Expected %v for %s needing %s", test.expected, test.scope, test.needed)
+		}
+	}
+}
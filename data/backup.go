@@ -0,0 +1,252 @@
+package data
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// The names of the database files in a backup archive
+const (
+	configBackupName   = "config.db"
+	activityBackupName = "activity.db"
+)
+
+// BackupError is returned when a backup archive can't be restored
+type BackupError struct {
+	Message string
+}
+
+func (e BackupError) Error() string {
+	return e.Message
+}
+
+// Backup writes a snapshot of both databases to w as a tar.gz archive.  The
+// snapshot is taken inside read transactions, so it's consistent even while
+// the app keeps running.  The device key for secret settings isn't included,
+// so secrets only survive a restore on the same device
+func (s *Store) Backup(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	err := s.Config.view(func(configTx *bolt.Tx) error {
+		return s.Activity.view(func(activityTx *bolt.Tx) error {
+			if err := writeBackupFile(archive, configBackupName, configTx); err != nil {
+				return err
+			}
+
+			return writeBackupFile(archive, activityBackupName, activityTx)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// Restore replaces both databases with the ones in a tar.gz archive created by
+// Backup.  The archive is checked before anything is replaced, and each file
+// is swapped in with a rename.  If the activity can't be swapped in, the old
+// config is put back.  The app should be restarted afterwards
+func (s *Store) Restore(r io.Reader) error {
+	configPath := s.Config.path + ".restore"
+	activityPath := s.Activity.path + ".restore"
+	defer os.Remove(configPath)
+	defer os.Remove(activityPath)
+
+	//	Unpack the archive next to the databases, so the rename is atomic:
+	err := extractBackup(r, map[string]string{
+		configBackupName:   configPath,
+		activityBackupName: activityPath,
+	})
+	if err != nil {
+		return err
+	}
+
+	//	Make sure the files are databases we can use:
+	if err := checkBackupFile(configBackupName, configPath, configMigrations); err != nil {
+		return err
+	}
+
+	if err := checkBackupFile(activityBackupName, activityPath, activityMigrations); err != nil {
+		return err
+	}
+
+	//	Keep a copy of the current config, so it can be put back if the
+	//	activity can't be swapped in:
+	previousPath := s.Config.path + ".previous"
+	defer os.Remove(previousPath)
+
+	err = s.Config.view(func(tx *bolt.Tx) error {
+		return tx.CopyFile(previousPath, 0600)
+	})
+	if err != nil {
+		return err
+	}
+
+	//	Swap them in:
+	if err := s.Config.swap(configPath); err != nil {
+		return err
+	}
+
+	if err := s.Activity.swap(activityPath); err != nil {
+		if restoreErr := s.Config.swap(previousPath); restoreErr != nil {
+			return fmt.Errorf("%v.  Putting the old config back also failed: %v", err, restoreErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// swap replaces the config database with the file at newPath
+func (store *ConfigDB) swap(newPath string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	db, err := swapFile(store.db, store.path, newPath, store.timeout)
+	if db != nil {
+		store.db = db
+	}
+
+	return err
+}
+
+// swap replaces the activity database with the file at newPath
+func (store *ActivityDB) swap(newPath string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	db, err := swapFile(store.db, store.path, newPath, store.timeout)
+	if db != nil {
+		store.db = db
+	}
+
+	return err
+}
+
+// writeBackupFile adds a database to the archive
+func writeBackupFile(archive *tar.Writer, name string, tx *bolt.Tx) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     tx.Size(),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := tx.WriteTo(archive)
+	return err
+}
+
+// extractBackup unpacks the database files in an archive to the given paths.
+// Anything else in the archive is an error
+func extractBackup(r io.Reader, paths map[string]string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return BackupError{"The backup isn't a tar.gz archive"}
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	found := map[string]bool{}
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return BackupError{fmt.Sprintf("Problem reading the backup: %v", err)}
+		}
+
+		path, ok := paths[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg || found[header.Name] {
+			return BackupError{fmt.Sprintf("Unexpected file in the backup: %s", header.Name)}
+		}
+
+		if err := extractFile(archive, path); err != nil {
+			return err
+		}
+		found[header.Name] = true
+	}
+
+	for name := range paths {
+		if !found[name] {
+			return BackupError{fmt.Sprintf("The backup is missing %s", name)}
+		}
+	}
+
+	return nil
+}
+
+// extractFile writes the current archive entry to a file
+func extractFile(archive *tar.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, archive); err != nil {
+		file.Close()
+		return BackupError{fmt.Sprintf("Problem reading the backup: %v", err)}
+	}
+
+	//	Make sure it's on the card before we swap it in:
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// checkBackupFile makes sure a database from a backup is intact and isn't
+// from a newer version of the app
+func checkBackupFile(name, path string, migrations []Migration) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return BackupError{fmt.Sprintf("%s in the backup isn't a valid database: %v", name, err)}
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		//	Read all the problems, so the check finishes before the transaction does:
+		var damage error
+		for err := range tx.Check() {
+			if damage == nil {
+				damage = err
+			}
+		}
+
+		if damage != nil {
+			return BackupError{fmt.Sprintf("%s in the backup is damaged: %v", name, damage)}
+		}
+
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return BackupError{fmt.Sprintf("%s in the backup has an invalid schema version: %v", name, err)}
+		}
+
+		latest := migrations[len(migrations)-1].Version
+		if version > latest {
+			return BackupError{fmt.Sprintf("%s in the backup is schema version %v, but this version of the app only understands up to version %v", name, version, latest)}
+		}
+
+		return nil
+	})
+}
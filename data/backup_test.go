@@ -0,0 +1,73 @@
+package data_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+func TestBackup_ThenRestore_ReturnsBackedUpData(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	store.Config.Set(data.ConfigItem{Name: "name", Value: "washer"})
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: time.Now().Add(-1 * time.Minute), Type: data.ApplianceRunning})
+
+	backup := bytes.Buffer{}
+	if err := store.Backup(&backup); err != nil {
+		t.Fatalf("Backup failed: Should have created the backup without error: %v", err)
+	}
+
+	//	Change things after the backup:
+	store.Config.Set(data.ConfigItem{Name: "name", Value: "dryer"})
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Type: data.ApplianceStopped})
+
+	//	Act
+	err := store.Restore(&backup)
+	name, _ := store.Config.Get("name")
+	activity, _ := store.Activity.GetAllActivity("testdevice")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Restore failed: Should have restored without error: %v", err)
+	}
+
+	if name.Value != "washer" {
+		t.Errorf("Restore failed: Should have restored the config.  Got name %v", name.Value)
+	}
+
+	if len(activity) != 1 {
+		t.Errorf("Restore failed: Should have restored the activity.  Got %v items", len(activity))
+	}
+}
+
+func TestRestore_InvalidArchive_LeavesDataAlone(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	store.Config.Set(data.ConfigItem{Name: "name", Value: "washer"})
+
+	//	Act
+	err := store.Restore(bytes.NewBufferString("not a backup"))
+	name, _ := store.Config.Get("name")
+
+	//	Assert
+	if _, ok := err.(data.BackupError); !ok {
+		t.Errorf("Restore failed: Should have rejected the archive.  Got %v", err)
+	}
+
+	if name.Value != "washer" {
+		t.Errorf("Restore failed: Shouldn't have changed the config.  Got name %v", name.Value)
+	}
+}
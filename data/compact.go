@@ -0,0 +1,115 @@
+package data
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+)
+
+// FreeSpace gets how many bytes of the activity database file are unused, and
+// the size of the file.  BoltDB reuses free space but never gives it back
+func (store *ActivityDB) FreeSpace() (int64, int64, error) {
+	var free, size int64
+
+	err := store.view(func(tx *bolt.Tx) error {
+		free = int64(store.db.Stats().FreeAlloc)
+		size = tx.Size()
+		return nil
+	})
+
+	return free, size, err
+}
+
+// Compact copies the activity database into a new file without the free space,
+// and swaps it in for the old one.  Activity can't be read or written while it
+// runs.  Returns the size of the file before and after
+func (store *ActivityDB) Compact() (int64, int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	before, err := fileSize(store.path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	//	Copy everything into a new file:
+	compactPath := store.path + ".compact"
+	os.Remove(compactPath)
+
+	compacted, err := bolt.Open(compactPath, 0600, &bolt.Options{Timeout: store.timeout})
+	if err != nil {
+		return before, before, err
+	}
+
+	if err := copyDB(store.db, compacted); err != nil {
+		compacted.Close()
+		os.Remove(compactPath)
+		return before, before, fmt.Errorf("Problem copying the database: %v", err)
+	}
+
+	if err := compacted.Close(); err != nil {
+		os.Remove(compactPath)
+		return before, before, err
+	}
+
+	//	Swap the new file in:
+	db, err := swapFile(store.db, store.path, compactPath, store.timeout)
+	if db != nil {
+		store.db = db
+	}
+	if err != nil {
+		os.Remove(compactPath)
+		return before, before, err
+	}
+
+	after, err := fileSize(store.path)
+	return before, after, err
+}
+
+// copyDB copies all the buckets in one database to another
+func copyDB(src, dst *bolt.DB) error {
+	return src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+
+				return copyBucket(b, dstBucket)
+			})
+		})
+	})
+}
+
+// copyBucket copies the items, nested buckets and sequence of a bucket
+func copyBucket(src, dst *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		//	Nested buckets have a nil value:
+		if v == nil {
+			nested, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+
+			return copyBucket(src.Bucket(k), nested)
+		}
+
+		return dst.Put(k, v)
+	})
+}
+
+// fileSize gets the size of a file
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/xid"
@@ -15,11 +17,30 @@ import (
 
 const (
 	configPrefix = "settings"
+
+	// DeviceTypeAmon is the vibration sensor attached to the appliance monitor itself
+	DeviceTypeAmon = "amon"
+
+	// DeviceTypeHS110 is a TP-Link HS110 smart plug
+	DeviceTypeHS110 = "hs110"
 )
 
-// ConfigDB is the BoltDB database for config information
+// ConfigDB is the BoltDB database for config information.  Open it once
+// with OpenConfigDB and share it -- BoltDB locks the database file
 type ConfigDB struct {
-	Database string
+	db      *bolt.DB
+	path    string
+	timeout time.Duration
+
+	//	Restore swaps out the database file, so it locks everything else out
+	mu sync.RWMutex
+
+	//	The device-local key for secret settings, once it's been loaded
+	key   []byte
+	keyMu sync.Mutex
+
+	//	unsavedKey keeps a new key in memory only, during a dry run
+	unsavedKey bool
 }
 
 // ConfigItem represents a configuration item
@@ -46,12 +67,21 @@ type Device struct {
 	MinimumMonitorTime time.Duration `json:"minimum_monitor_time"`
 
 	// Threshold is the value that must be crossed (after the MinimumMonitorTime time)
-	// before the device latches to the 'on' or 'off' state
+	// before the device latches to the 'on' or 'off' state.  For hs110 devices,
+	// this is the power draw in watts
 	Threshold int `json:"monitor_threshold"`
 
 	// IPAddress is the network address for the device
 	IPAddress string `json:"ipaddress"`
 
+	// EstimatedWatts is the typical power draw of the appliance while it's running.
+	// It's used to estimate energy use for devices that can't measure power
+	EstimatedWatts float64 `json:"estimatedwatts"`
+
+	// I2CBus is the I2C bus the device's sensor is attached to (amon devices only).
+	// Zero means the default bus
+	I2CBus int `json:"i2cbus"`
+
 	// Running indicates whether the device is currently running (operating) or not
 	Running bool `json:"running"`
 
@@ -59,29 +89,49 @@ type Device struct {
 	LastUpdated time.Time `sql:"updated" json:"updated"`
 }
 
-// InitStore initializes the database
-func (store ConfigDB) InitStore() error {
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
+// Validate checks that the device has everything it needs to be monitored
+func (device Device) Validate() error {
+	if strings.TrimSpace(device.Name) == "" {
+		return errors.New("Device name can't be blank")
+	}
 
-	return err
+	switch device.Type {
+	case DeviceTypeAmon:
+	case DeviceTypeHS110:
+		//	Smart plugs are polled over the network, so we need to know where they are:
+		if net.ParseIP(device.IPAddress) == nil {
+			return fmt.Errorf("Device type %s needs a valid IP address", device.Type)
+		}
+	default:
+		return fmt.Errorf("Unknown device type: %s", device.Type)
+	}
+
+	if device.MinimumMonitorTime < 0 {
+		return errors.New("Minimum monitor time can't be negative")
+	}
+
+	if device.Threshold < 0 {
+		return errors.New("Monitor threshold can't be negative")
+	}
+
+	if device.EstimatedWatts < 0 {
+		return errors.New("Estimated watts can't be negative")
+	}
+
+	if device.I2CBus < 0 {
+		return errors.New("I2C bus can't be negative")
+	}
+
+	return nil
 }
 
 // GetAllDevices gets all devices in the system
-func (store ConfigDB) GetAllDevices() ([]Device, error) {
+func (store *ConfigDB) GetAllDevices() ([]Device, error) {
 	//	Our return item
 	retval := []Device{}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
 	//	Get all the items:
-	err = db.View(func(tx *bolt.Tx) error {
+	err := store.view(func(tx *bolt.Tx) error {
 
 		b := tx.Bucket([]byte("devices"))
 		if b == nil {
@@ -107,9 +157,36 @@ func (store ConfigDB) GetAllDevices() ([]Device, error) {
 	return retval, err
 }
 
-// AddOrUpdateDevice adds a device to the system
-func (store ConfigDB) AddOrUpdateDevice(device Device) (Device, error) {
+// GetDevice gets a single device.  If the device can't be found,
+// returns an empty device
+func (store *ConfigDB) GetDevice(id string) (Device, error) {
+	//	Our return item
+	retval := Device{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		//	Get the item from the bucket
+		b := tx.Bucket([]byte("devices"))
+
+		if b != nil {
+			deviceBytes := b.Get([]byte(id))
+
+			//	Need to make sure we got something back here before we try to unmarshal
+			if len(deviceBytes) > 0 {
+				//	Unmarshal data into our device
+				if err := json.Unmarshal(deviceBytes, &retval); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
 
+	return retval, err
+}
+
+// AddOrUpdateDevice adds a device to the system
+func (store *ConfigDB) AddOrUpdateDevice(device Device) (Device, error) {
 	//	Our return item:
 	retval := device
 
@@ -118,15 +195,8 @@ func (store ConfigDB) AddOrUpdateDevice(device Device) (Device, error) {
 		return retval, errors.New("Device name can't be blank")
 	}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
 	//	Update the database:
-	err = db.Update(func(tx *bolt.Tx) error {
+	err := store.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("devices"))
 		if err != nil {
 			return err
@@ -155,9 +225,30 @@ func (store ConfigDB) AddOrUpdateDevice(device Device) (Device, error) {
 	return retval, err
 }
 
-// Set inserts or updates the config item
-func (store ConfigDB) Set(configItem ConfigItem) (ConfigItem, error) {
+// RemoveDevice removes a device from the system
+func (store *ConfigDB) RemoveDevice(id string) error {
+
+	//	If there is no device id, throw an error:
+	if strings.TrimSpace(id) == "" {
+		return errors.New("Device id can't be blank")
+	}
+
+	//	Update the database:
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("devices"))
+		if err != nil {
+			return err
+		}
+
+		//	Remove the item:
+		return b.Delete([]byte(id))
+	})
+
+	return err
+}
 
+// Set inserts or updates the config item.  Secrets are encrypted before they're stored
+func (store *ConfigDB) Set(configItem ConfigItem) (ConfigItem, error) {
 	//	Our return item:
 	retval := configItem
 
@@ -166,15 +257,18 @@ func (store ConfigDB) Set(configItem ConfigItem) (ConfigItem, error) {
 		return retval, errors.New("Config name can't be blank")
 	}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
+	//	Encrypt secrets:
+	storedValue := retval.Value
+	if IsSecret(retval.Name) {
+		encrypted, err := store.encryptValue(retval.Name, retval.Value)
+		if err != nil {
+			return retval, err
+		}
+		storedValue = encrypted
 	}
 
 	//	Update the database:
-	err = db.Update(func(tx *bolt.Tx) error {
+	err := store.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("configItems"))
 		if err != nil {
 			return err
@@ -192,7 +286,9 @@ func (store ConfigDB) Set(configItem ConfigItem) (ConfigItem, error) {
 		retval.LastUpdated = time.Now()
 
 		//	Serialize to JSON format
-		encoded, err := json.Marshal(retval)
+		stored := retval
+		stored.Value = storedValue
+		encoded, err := json.Marshal(stored)
 		if err != nil {
 			return err
 		}
@@ -205,22 +301,15 @@ func (store ConfigDB) Set(configItem ConfigItem) (ConfigItem, error) {
 }
 
 // Remove removes the config item
-func (store ConfigDB) Remove(configName string) error {
+func (store *ConfigDB) Remove(configName string) error {
 
 	//	If there is no config name, throw an error:
 	if strings.TrimSpace(configName) == "" {
 		return errors.New("Config name can't be blank")
 	}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return err
-	}
-
 	//	Update the database:
-	err = db.Update(func(tx *bolt.Tx) error {
+	err := store.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("configItems"))
 		if err != nil {
 			return err
@@ -233,8 +322,9 @@ func (store ConfigDB) Remove(configName string) error {
 	return err
 }
 
-// Get fetches a config item
-func (store ConfigDB) Get(configName string) (ConfigItem, error) {
+// Get fetches a config item.  If it hasn't been set in the database or the
+// config file, the default from the schema is used
+func (store *ConfigDB) Get(configName string) (ConfigItem, error) {
 	//	Our return item:
 	retval := ConfigItem{}
 
@@ -246,14 +336,7 @@ func (store ConfigDB) Get(configName string) (ConfigItem, error) {
 		retval.Value = viperConfigValue
 	}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
-	err = db.View(func(tx *bolt.Tx) error {
+	err := store.view(func(tx *bolt.Tx) error {
 		//	Get the item from the bucket
 		b := tx.Bucket([]byte("configItems"))
 
@@ -263,21 +346,28 @@ func (store ConfigDB) Get(configName string) (ConfigItem, error) {
 			//	Need to make sure we got something back here before we try to unmarshal
 			if len(configBytes) > 0 {
 				//	Unmarshal data into our config item
-				if err := json.Unmarshal(configBytes, &retval); err != nil {
+				configItem, err := store.readConfigItem(configBytes)
+				if err != nil {
 					return err
 				}
+				retval = configItem
 			}
 		}
 
 		return nil
 	})
 
-	//	If we found an item, use that .. otherwise, use the default
+	//	If we didn't find a value, use the schema default
+	if setting, found := LookupSetting(configName); found && retval.Value == "" && setting.Default != "" {
+		retval.Name = configName
+		retval.Value = setting.Default
+	}
+
 	return retval, err
 }
 
 // GetAll gets all config items in the system
-func (store ConfigDB) GetAll() ([]ConfigItem, error) {
+func (store *ConfigDB) GetAll() ([]ConfigItem, error) {
 	//	Our return item:
 	retval := []ConfigItem{}
 
@@ -295,15 +385,8 @@ func (store ConfigDB) GetAll() ([]ConfigItem, error) {
 		}
 	}
 
-	//	Open the database:
-	db, err := bolt.Open(store.Database, 0600, nil)
-	defer db.Close()
-	if err != nil {
-		return retval, err
-	}
-
 	//	Get all the items:
-	err = db.View(func(tx *bolt.Tx) error {
+	err := store.view(func(tx *bolt.Tx) error {
 
 		b := tx.Bucket([]byte("configItems"))
 		if b == nil {
@@ -314,8 +397,8 @@ func (store ConfigDB) GetAll() ([]ConfigItem, error) {
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			//	Unmarshal data into our config item
-			configItem := ConfigItem{}
-			if err := json.Unmarshal(v, &configItem); err != nil {
+			configItem, err := store.readConfigItem(v)
+			if err != nil {
 				return err
 			}
 
@@ -350,3 +433,19 @@ func (store ConfigDB) GetAll() ([]ConfigItem, error) {
 	//	Return our slice:
 	return retval, err
 }
+
+// view runs a read-only transaction
+func (store *ConfigDB) view(fn func(*bolt.Tx) error) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.db.View(fn)
+}
+
+// update runs a read-write transaction
+func (store *ConfigDB) update(fn func(*bolt.Tx) error) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.db.Update(fn)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"testing"
+	"time"
 
 	"fmt"
 
@@ -24,22 +25,45 @@ func TestConfig_Database_ShouldNotExistYet(t *testing.T) {
 	}
 }
 
-//	Init should create a new BoltDB file
-func TestConfig_Init_Successful(t *testing.T) {
+//	Open should create a new BoltDB file
+func TestConfig_Open_Successful(t *testing.T) {
 	//	Arrange
 	filename := "testing.db"
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
-
 	//	Act
-	db.InitStore()
+	db, err := data.OpenConfigDB(filename, time.Second)
 
 	//	Assert
+	if err != nil {
+		t.Fatalf("Open failed: Should have opened the database without error: %v", err)
+	}
+	defer db.Close()
+
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		t.Errorf("Init failed: Config db file %s was not created", filename)
+		t.Errorf("Open failed: Config db file %s was not created", filename)
+	}
+}
+
+//	Open should give up if something else has the database open
+func TestConfig_Open_AlreadyOpen_TimesOut(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	_, err = data.OpenConfigDB(filename, 100*time.Millisecond)
+
+	//	Assert
+	if err == nil {
+		t.Errorf("Open failed: Should have timed out waiting for the database lock")
 	}
 }
 
@@ -50,8 +74,11 @@ func TestConfig_Get_ItemDoesntExist_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	queryName := "bogusItem"
 	expectedValue := ""
@@ -85,8 +112,11 @@ settings:
 `)
 	viper.ReadConfig(bytes.NewBuffer(yamlConfig)) // Read in the defaults from the config file
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	queryName := "itemwithdefault"
 	expectedValue := "thedefault"
@@ -120,8 +150,11 @@ settings:
 `)
 	viper.ReadConfig(bytes.NewBuffer(yamlConfig)) // Read in the defaults from the config file
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	db.Set(data.ConfigItem{
 		Name:  "itemwithdefault",
@@ -143,6 +176,35 @@ settings:
 	}
 }
 
+//	Config get should fall back to the schema default if the item isn't set anywhere
+func TestConfig_Get_ItemNotSetButInSchema_ReturnsSchemaDefault(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer viper.Reset()
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	queryName := "retentiondays"
+	expectedValue := "365"
+
+	//	Act
+	response, err := db.Get(queryName)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Get failed: Should have returned the schema default without error: %s", err)
+	}
+
+	if expectedValue != response.Value {
+		t.Errorf("Get failed: Should have returned '%v' instead of the value '%s'", expectedValue, response.Value)
+	}
+}
+
 //	Config set with no config name shouldn't work
 func TestConfig_Set_NoName_NotSuccessful(t *testing.T) {
 	//	Arrange
@@ -150,8 +212,11 @@ func TestConfig_Set_NoName_NotSuccessful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	ct1 := data.ConfigItem{
@@ -159,7 +224,7 @@ func TestConfig_Set_NoName_NotSuccessful(t *testing.T) {
 		Value: "Value1"}
 
 	//	Act
-	_, err := db.Set(ct1)
+	_, err = db.Set(ct1)
 
 	//	Assert
 	if err == nil {
@@ -174,8 +239,11 @@ func TestConfig_Set_ValidName_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	ct1 := data.ConfigItem{
@@ -207,8 +275,11 @@ func TestConfig_Set_ThenGet_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	ct1 := data.ConfigItem{
@@ -247,8 +318,11 @@ func TestConfig_GetAll_NoItems_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	NO ITEMS STORED
 
@@ -271,8 +345,11 @@ func TestConfig_GetAll_WithItems_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	maxItems := 20
@@ -311,8 +388,11 @@ settings:
 `)
 	viper.ReadConfig(bytes.NewBuffer(yamlConfig)) // Read in the defaults from the config file
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	expectedCount := 3
 
@@ -346,8 +426,11 @@ settings:
 `)
 	viper.ReadConfig(bytes.NewBuffer(yamlConfig)) // Read in the defaults from the config file
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	db.Set(data.ConfigItem{
 		Name:  "itemwithdefault",
@@ -395,8 +478,11 @@ func TestConfig_Set_ThenRemove_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try storing some config items:
 	ct1 := data.ConfigItem{
@@ -453,13 +539,16 @@ func TestConfig_Remove_ItemDoesntExist_NoErrors(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	NO VALUES
 
 	//	Act
-	err := db.Remove("somebogusname")
+	err = db.Remove("somebogusname")
 	if err != nil {
 		t.Errorf("Set then remove failed: Should have removed a config item without error: %s", err)
 	}
@@ -470,8 +559,11 @@ func TestConfig_GetAllDevices_NoItems_Successful(t *testing.T) {
 	filename := "testing.db"
 	defer os.Remove(filename)
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	NO ITEMS STORED
 
@@ -494,8 +586,11 @@ func TestConfig_GetAllDevices_WithItems_Successful(t *testing.T) {
 	defer os.Remove(filename)
 	defer viper.Reset()
 
-	db := data.ConfigDB{
-		Database: filename}
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
 
 	//	Try adding some devices:
 	db.AddOrUpdateDevice(data.Device{
@@ -528,3 +623,154 @@ func TestConfig_GetAllDevices_WithItems_Successful(t *testing.T) {
 		t.Errorf("GetAllDevices failed: Should have returned %d config items but returned %v instead", numberOfItems, len(response))
 	}
 }
+
+func TestConfig_GetDevice_ItemDoesntExist_ReturnsEmptyDevice(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	NO ITEMS STORED
+
+	//	Act
+	response, err := db.GetDevice("bogusid")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetDevice failed: Should have returned an empty device without error: %s", err)
+	}
+
+	if response.ID != "" {
+		t.Errorf("GetDevice failed: Shouldn't have returned the device %+v", response)
+	}
+}
+
+func TestConfig_AddOrUpdateDevice_ThenGetDevice_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	device, _ := db.AddOrUpdateDevice(data.Device{
+		Name:      "Unit test 1",
+		Type:      data.DeviceTypeHS110,
+		IPAddress: "192.168.1.99",
+	})
+
+	//	Act
+	response, err := db.GetDevice(device.ID)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("GetDevice failed: Should have returned the device without error: %s", err)
+	}
+
+	if response.ID != device.ID || response.Name != device.Name || response.IPAddress != device.IPAddress {
+		t.Errorf("GetDevice failed: Should have returned %+v but returned %+v instead", device, response)
+	}
+}
+
+func TestConfig_RemoveDevice_ThenGetAllDevices_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	device1, _ := db.AddOrUpdateDevice(data.Device{
+		Name: "Unit test 1",
+		Type: data.DeviceTypeAmon,
+	})
+
+	db.AddOrUpdateDevice(data.Device{
+		Name: "Unit test 2",
+		Type: data.DeviceTypeAmon,
+	})
+
+	//	Act
+	err = db.RemoveDevice(device1.ID)
+	response, _ := db.GetAllDevices()
+
+	//	Assert
+	if err != nil {
+		t.Errorf("RemoveDevice failed: Should have removed the device without error: %s", err)
+	}
+
+	if len(response) != 1 || response[0].ID == device1.ID {
+		t.Errorf("RemoveDevice failed: Should have 1 other device left.  Instead, got %+v", response)
+	}
+}
+
+func TestConfig_RemoveDevice_NoID_NotSuccessful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	err = db.RemoveDevice("")
+
+	//	Assert
+	if err == nil {
+		t.Errorf("RemoveDevice failed: Should have thrown an error about no device id")
+	}
+}
+
+func TestConfig_DeviceValidate_InvalidDevices_ReturnsErrors(t *testing.T) {
+	//	Arrange
+	devices := []data.Device{
+		{Name: "", Type: data.DeviceTypeAmon},
+		{Name: "Washer", Type: "bogustype"},
+		{Name: "Washer", Type: data.DeviceTypeHS110},
+		{Name: "Washer", Type: data.DeviceTypeHS110, IPAddress: "not an ip"},
+		{Name: "Washer", Type: data.DeviceTypeAmon, Threshold: -1},
+		{Name: "Washer", Type: data.DeviceTypeAmon, MinimumMonitorTime: -1},
+	}
+
+	for _, device := range devices {
+		//	Act
+		err := device.Validate()
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Validate failed: Should have returned an error for device %+v", device)
+		}
+	}
+}
+
+func TestConfig_DeviceValidate_ValidDevices_NoErrors(t *testing.T) {
+	//	Arrange
+	devices := []data.Device{
+		{Name: "Washer", Type: data.DeviceTypeAmon, Threshold: 8},
+		{Name: "Dryer", Type: data.DeviceTypeHS110, IPAddress: "192.168.1.99"},
+	}
+
+	for _, device := range devices {
+		//	Act
+		err := device.Validate()
+
+		//	Assert
+		if err != nil {
+			t.Errorf("Validate failed: Should not have returned an error for device %+v: %v", device, err)
+		}
+	}
+}
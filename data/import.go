@@ -0,0 +1,110 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// ImportResult describes what an import added, or would add for a dry run
+type ImportResult struct {
+	Activities          int  `json:"activities"`
+	Cycles              int  `json:"cycles"`
+	DuplicateActivities int  `json:"duplicateactivities"`
+	DuplicateCycles     int  `json:"duplicatecycles"`
+	DryRun              bool `json:"dryrun"`
+}
+
+// Import adds activities and cycles that aren't already stored.  An activity is
+// a duplicate if its device already has activity at the same time, and a cycle
+// is a duplicate if its device already has a cycle that started at the same time.
+// Everything is imported in a single transaction.  If dryRun is set, nothing is
+// stored, but the result says what would have been
+func (store *ActivityDB) Import(activities []Activity, cycles []Cycle, dryRun bool) (ImportResult, error) {
+	retval := ImportResult{DryRun: dryRun}
+
+	//	Make sure everything can be stored before we start:
+	for i, activity := range activities {
+		if strings.TrimSpace(activity.DeviceID) == "" || activity.Timestamp.IsZero() {
+			return retval, fmt.Errorf("Activity %v needs a device id and timestamp", i+1)
+		}
+	}
+
+	for i, cycle := range cycles {
+		if strings.TrimSpace(cycle.DeviceID) == "" || cycle.StartTime.IsZero() {
+			return retval, fmt.Errorf("Cycle %v needs a device id and start time", i+1)
+		}
+	}
+
+	err := store.update(func(tx *bolt.Tx) error {
+		for _, activity := range activities {
+			added, err := importItem(tx, "activities", activity.DeviceID, activity.Timestamp, activity)
+			if err != nil {
+				return err
+			}
+
+			if added {
+				retval.Activities++
+			} else {
+				retval.DuplicateActivities++
+			}
+		}
+
+		for _, cycle := range cycles {
+			added, err := importItem(tx, "cycles", cycle.DeviceID, cycle.StartTime, cycle)
+			if err != nil {
+				return err
+			}
+
+			if added {
+				retval.Cycles++
+			} else {
+				retval.DuplicateCycles++
+			}
+		}
+
+		//	Returning an error rolls everything back:
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	if err == errDryRun {
+		err = nil
+	}
+
+	return retval, err
+}
+
+// importItem stores an item unless its device already has one at the same time.
+// Returns true if it was stored
+func importItem(tx *bolt.Tx, name, deviceID string, when time.Time, item interface{}) (bool, error) {
+	b, err := createDeviceBucket(tx, name, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	//	Look for anything at the same time.  The sequence doesn't matter:
+	key := timeKey(when, 0)
+	if k, _ := b.Cursor().Seek(key); k != nil && bytes.Equal(k[:8], key[:8]) {
+		return false, nil
+	}
+
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return false, err
+	}
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return false, err
+	}
+
+	return true, b.Put(timeKey(when, seq), encoded)
+}
@@ -0,0 +1,84 @@
+package data_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+func TestActivity_Import_Duplicates_SkipsThem(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	when := time.Now().Add(-1 * time.Hour)
+	db.Add(data.Activity{DeviceID: "washer", Timestamp: when, Type: data.ApplianceRunning})
+
+	activities := []data.Activity{
+		{DeviceID: "washer", Timestamp: when, Type: data.ApplianceRunning},
+		{DeviceID: "dryer", Timestamp: when, Type: data.ApplianceRunning},
+		{DeviceID: "washer", Timestamp: when.Add(time.Minute), Type: data.ApplianceStopped},
+		{DeviceID: "washer", Timestamp: when.Add(time.Minute), Type: data.ApplianceStopped},
+	}
+	cycles := []data.Cycle{
+		{DeviceID: "washer", StartTime: when, EndTime: when.Add(time.Minute)},
+	}
+
+	//	Act
+	result, err := db.Import(activities, cycles, false)
+	washer, _ := db.GetAllActivity("washer")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Import failed: Should have imported without error: %v", err)
+	}
+
+	if result.Activities != 2 || result.DuplicateActivities != 2 || result.Cycles != 1 {
+		t.Errorf("Import failed: Got the wrong result: %+v", result)
+	}
+
+	if len(washer) != 2 {
+		t.Errorf("Import failed: Should have 2 items for the device.  Got %v", len(washer))
+	}
+}
+
+func TestActivity_Import_DryRun_StoresNothing(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	activities := []data.Activity{
+		{DeviceID: "washer", Timestamp: time.Now().Add(-1 * time.Hour), Type: data.ApplianceRunning},
+	}
+
+	//	Act
+	result, err := db.Import(activities, nil, true)
+	response, _ := db.GetAllActivity("")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Import failed: Should have done a dry run without error: %v", err)
+	}
+
+	if result.Activities != 1 || !result.DryRun {
+		t.Errorf("Import failed: Should have reported what would be imported.  Got %+v", result)
+	}
+
+	if len(response) != 0 {
+		t.Errorf("Import failed: A dry run shouldn't store anything.  Got %v items", len(response))
+	}
+}
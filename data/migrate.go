@@ -0,0 +1,308 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Migration changes the layout of a database from one schema version to the next
+type Migration struct {
+	// Version is the schema version the migration upgrades the database to
+	Version int
+
+	// Description says what the migration does
+	Description string
+
+	// apply does the work, inside the same transaction that records the new version
+	apply func(s *Store, tx *bolt.Tx) error
+}
+
+// MigrationStep is a migration that was (or would be) run on one of the databases
+type MigrationStep struct {
+	Database    string `json:"database"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// configMigrations are the config database migrations, in order.  Only ever add to the end
+var configMigrations = []Migration{
+	{Version: 1, Description: "Start tracking the schema version", apply: noChange},
+	{Version: 2, Description: "Encrypt secret settings stored in plaintext", apply: encryptSecrets},
+}
+
+// activityMigrations are the activity database migrations, in order.  Only ever add to the end
+var activityMigrations = []Migration{
+	{Version: 1, Description: "Move activity stored before devices were tracked to the monitor's own device", apply: moveToMonitorDevice},
+	{Version: 2, Description: "Key activity and cycles by UTC nanoseconds instead of text timestamps", apply: rekeyByTime},
+}
+
+// errDryRun rolls back a dry run
+var errDryRun = errors.New("Dry run")
+
+// Migrate brings both databases up to the schema versions this version of the
+// app uses, and returns the migrations that were run.  Each database is migrated
+// in a single transaction, so it's either fully migrated or left alone.  If dryRun
+// is set, the migrations are run and then rolled back.  If a database has a newer
+// schema than this version of the app knows about, returns an error
+func (s *Store) Migrate(dryRun bool) ([]MigrationStep, error) {
+	retval := []MigrationStep{}
+
+	//	Encrypting secrets can create the secret key.  A dry run is rolled
+	//	back, so it shouldn't leave one behind:
+	if dryRun {
+		defer s.Config.holdSecretKey()()
+	}
+
+	//	Config goes first -- activity migrations can depend on it:
+	steps, err := s.migrate("config", s.Config.db, configMigrations, dryRun)
+	retval = append(retval, steps...)
+	if err != nil {
+		return retval, err
+	}
+
+	steps, err = s.migrate("activity", s.Activity.db, activityMigrations, dryRun)
+	retval = append(retval, steps...)
+
+	return retval, err
+}
+
+// SchemaVersions gets the schema versions of the config and activity databases
+func (s *Store) SchemaVersions() (int, int, error) {
+	var configVersion, activityVersion int
+
+	err := s.Config.db.View(func(tx *bolt.Tx) error {
+		var err error
+		configVersion, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return configVersion, activityVersion, err
+	}
+
+	err = s.Activity.db.View(func(tx *bolt.Tx) error {
+		var err error
+		activityVersion, err = schemaVersion(tx)
+		return err
+	})
+
+	return configVersion, activityVersion, err
+}
+
+// migrate runs the migrations a database needs
+func (s *Store) migrate(name string, db *bolt.DB, migrations []Migration, dryRun bool) ([]MigrationStep, error) {
+	retval := []MigrationStep{}
+	latest := migrations[len(migrations)-1].Version
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		current, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		//	Don't touch a database from the future:
+		if current > latest {
+			return fmt.Errorf("The %s database is schema version %v, but this version of the app only understands up to version %v.  Please upgrade the app", name, current, latest)
+		}
+
+		//	Run the migrations we haven't run yet:
+		for _, m := range migrations {
+			if m.Version <= current {
+				continue
+			}
+
+			if err := m.apply(s, tx); err != nil {
+				return fmt.Errorf("Problem migrating the %s database to version %v (%s): %v", name, m.Version, m.Description, err)
+			}
+
+			retval = append(retval, MigrationStep{Database: name, Version: m.Version, Description: m.Description})
+		}
+
+		if current == latest {
+			return nil
+		}
+
+		if err := setSchemaVersion(tx, latest); err != nil {
+			return err
+		}
+
+		//	Returning an error rolls everything back:
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	if err == errDryRun {
+		err = nil
+	}
+
+	return retval, err
+}
+
+// schemaVersion gets the schema version from the metadata bucket.  Databases
+// from before the schema was tracked are version 0
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket([]byte("metadata"))
+	if b == nil {
+		return 0, nil
+	}
+
+	v := b.Get([]byte("schemaversion"))
+	if v == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(v))
+}
+
+// setSchemaVersion records the schema version in the metadata bucket
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte("metadata"))
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte("schemaversion"), []byte(strconv.Itoa(version)))
+}
+
+// noChange is a migration that only records the schema version
+func noChange(s *Store, tx *bolt.Tx) error {
+	return nil
+}
+
+// moveToMonitorDevice moves activities that were stored before activity was
+// tracked per device into the bucket for the monitor's own device
+func moveToMonitorDevice(s *Store, tx *bolt.Tx) error {
+	b := tx.Bucket([]byte("activities"))
+	if b == nil {
+		return nil
+	}
+
+	//	Find the old activities.  Device buckets have a nil value:
+	keys := [][]byte{}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+
+	//	If there is nothing to migrate, we're done:
+	if len(keys) == 0 {
+		return nil
+	}
+
+	deviceID, err := s.Config.Get("deviceID")
+	if err != nil {
+		return err
+	}
+
+	if deviceID.Value == "" {
+		return errors.New("The monitor doesn't have a device id to move activity to")
+	}
+
+	deviceBucket, err := b.CreateBucketIfNotExists([]byte(deviceID.Value))
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		activity := Activity{}
+		if err := json.Unmarshal(b.Get(k), &activity); err != nil {
+			return err
+		}
+		activity.DeviceID = deviceID.Value
+
+		encoded, err := json.Marshal(activity)
+		if err != nil {
+			return err
+		}
+
+		seq, err := deviceBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceBucket.Put(timeKey(activity.Timestamp, seq), encoded); err != nil {
+			return err
+		}
+
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rekeyByTime re-keys activities and cycles that were stored with the old
+// text keys, which only had one-second resolution
+func rekeyByTime(s *Store, tx *bolt.Tx) error {
+	for _, b := range deviceBuckets(tx, "activities", "") {
+		err := rekey(b, func(v []byte) (time.Time, error) {
+			activity := Activity{}
+			err := json.Unmarshal(v, &activity)
+			return activity.Timestamp, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, b := range deviceBuckets(tx, "cycles", "") {
+		err := rekey(b, func(v []byte) (time.Time, error) {
+			cycle := Cycle{}
+			err := json.Unmarshal(v, &cycle)
+			return cycle.StartTime, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rekey moves the items in a bucket that have old text keys to time keys.
+// The time for each item is taken from its value, which has full resolution
+func rekey(b *bolt.Bucket, itemTime func(v []byte) (time.Time, error)) error {
+
+	//	Find the old keys.  Time keys are always the same size:
+	keys := [][]byte{}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil && len(k) != timeKeySize {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		v := append([]byte{}, b.Get(k)...)
+
+		when, err := itemTime(v)
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(timeKey(when, seq), v); err != nil {
+			return err
+		}
+
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package data_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	createOldDatabase creates a database file and lets the test fill it in
+//	the way an older version of the app would have
+func createOldDatabase(t *testing.T, filename string, fill func(tx *bolt.Tx) error) {
+	boltdb, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create the old database: %v", err)
+	}
+	defer boltdb.Close()
+
+	if err := boltdb.Update(fill); err != nil {
+		t.Fatalf("Couldn't fill the old database: %v", err)
+	}
+}
+
+//	openTestStore opens a store using the test database files
+func openTestStore(t *testing.T) *data.Store {
+	store, err := data.OpenStore("testing.db", "testactivity.db", time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the store: %v", err)
+	}
+
+	return store
+}
+
+func TestMigrate_NewDatabases_RecordsLatestVersions(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	//	Act
+	_, err := store.Migrate(false)
+	configVersion, activityVersion, _ := store.SchemaVersions()
+	steps, _ := store.Migrate(false)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Migrate failed: Should have migrated without error: %v", err)
+	}
+
+	if configVersion == 0 || activityVersion == 0 {
+		t.Errorf("Migrate failed: Should have recorded the schema versions.  Got %v / %v", configVersion, activityVersion)
+	}
+
+	if len(steps) != 0 {
+		t.Errorf("Migrate failed: Shouldn't have run anything the second time.  Ran %+v", steps)
+	}
+}
+
+func TestMigrate_NewerDatabase_ReturnsError(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	createOldDatabase(t, "testactivity.db", func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("metadata"))
+		return b.Put([]byte("schemaversion"), []byte("1000"))
+	})
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	//	Act
+	_, err := store.Migrate(false)
+
+	//	Assert
+	if err == nil {
+		t.Errorf("Migrate failed: Should have refused to touch a database from a newer version")
+	}
+}
+
+func TestMigrate_OldActivity_MovesItemsToDevice(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	//	Store some activity the way it was stored before devices:
+	createOldDatabase(t, "testactivity.db", func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("activities"))
+		for i := 1; i <= 3; i++ {
+			ts := time.Now().Add(time.Duration(-i) * time.Minute)
+			encoded, _ := json.Marshal(map[string]interface{}{"timestamp": ts, "eventtype": data.ApplianceStopped})
+			b.Put([]byte(ts.Format(time.RFC3339)), encoded)
+		}
+		return nil
+	})
+
+	store := openTestStore(t)
+	defer store.Close()
+	store.Config.Set(data.ConfigItem{Name: "deviceID", Value: "monitor"})
+
+	//	Act
+	_, err := store.Migrate(false)
+	response, _ := store.Activity.GetAllActivity("monitor")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Migrate failed: Should have migrated without error: %v", err)
+	}
+
+	if len(response) != 3 {
+		t.Errorf("Migrate failed: Should have moved 3 items to the device.  Instead, got %v", len(response))
+	}
+
+	for _, activity := range response {
+		if activity.DeviceID != "monitor" {
+			t.Errorf("Migrate failed: Should have set the device id.  Got %+v", activity)
+		}
+	}
+}
+
+func TestMigrate_OldKeys_KeepsItemsAndRanges(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	//	Store some activity with the old one-second keys:
+	now := time.Now().Truncate(time.Second)
+	createOldDatabase(t, "testactivity.db", func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("activities"))
+		device, _ := b.CreateBucketIfNotExists([]byte("testdevice"))
+		for i := 1; i <= 3; i++ {
+			activity := data.Activity{DeviceID: "testdevice", Timestamp: now.Add(time.Duration(-i) * time.Minute), Type: data.ApplianceRunning}
+			encoded, _ := json.Marshal(activity)
+			device.Put([]byte(activity.Timestamp.Format(time.RFC3339)), encoded)
+		}
+
+		b, _ = tx.CreateBucketIfNotExists([]byte("cycles"))
+		device, _ = b.CreateBucketIfNotExists([]byte("testdevice"))
+		cycle := data.Cycle{DeviceID: "testdevice", StartTime: now.Add(-3 * time.Minute), EndTime: now.Add(-1 * time.Minute)}
+		encoded, _ := json.Marshal(cycle)
+		return device.Put([]byte(cycle.StartTime.Format(time.RFC3339)), encoded)
+	})
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	//	Act
+	_, err := store.Migrate(false)
+	activities, _ := store.Activity.GetRange("testdevice", now.Add(-150*time.Second), now)
+	cycles, _ := store.Activity.GetCycles("testdevice", now.Add(-5*time.Minute), now)
+	latest, _ := store.Activity.GetLatestActivity("testdevice")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Migrate failed: Should have migrated without error: %v", err)
+	}
+
+	if len(activities) != 2 {
+		t.Errorf("Migrate failed: Should have found 2 items in range after migrating.  Instead, got %v", len(activities))
+	}
+
+	if len(cycles) != 1 {
+		t.Errorf("Migrate failed: Should have found 1 cycle after migrating.  Instead, got %v", len(cycles))
+	}
+
+	if !latest.Timestamp.Equal(now.Add(-1 * time.Minute)) {
+		t.Errorf("Migrate failed: Should have returned the most recent item.  Instead, got %+v", latest)
+	}
+}
+
+func TestMigrate_DryRun_ReportsStepsWithoutChanges(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	//	Act
+	steps, err := store.Migrate(true)
+	configVersion, activityVersion, _ := store.SchemaVersions()
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Migrate failed: Should have done a dry run without error: %v", err)
+	}
+
+	if len(steps) == 0 {
+		t.Errorf("Migrate failed: Should have reported the migrations a new database needs")
+	}
+
+	if configVersion != 0 || activityVersion != 0 {
+		t.Errorf("Migrate failed: A dry run shouldn't change the schema versions.  Got %v / %v", configVersion, activityVersion)
+	}
+}
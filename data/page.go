@@ -0,0 +1,272 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// DefaultPageSize is the number of activities in a page if no limit is given
+	DefaultPageSize = 100
+
+	// MaxPageSize is the most activities a page can have
+	MaxPageSize = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned when a page cursor can't be read
+	ErrInvalidCursor = errors.New("Invalid cursor")
+
+	// ErrBeforeAndAfter is returned when a page is asked for with both a before and after cursor
+	ErrBeforeAndAfter = errors.New("Only one of before or after can be used")
+)
+
+// PageRequest describes a page of activity to get
+type PageRequest struct {
+	// DeviceID is the device to get activity for.  If blank, gets activity for all devices
+	DeviceID string
+
+	// StartTime and EndTime limit the page to a time range.  Zero times aren't limited
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Before gets the activity before this cursor
+	Before string
+
+	// After gets the activity after this cursor
+	After string
+
+	// Limit is the most activities to get
+	Limit int
+
+	// NewestFirst sorts the page from newest to oldest
+	NewestFirst bool
+}
+
+// ActivityPage is one page of activity
+type ActivityPage struct {
+	// Items are the activities in the page
+	Items []Activity `json:"items"`
+
+	// First is the cursor for the first item in the page.  Blank if the page is empty
+	First string `json:"first"`
+
+	// Last is the cursor for the last item in the page.  Blank if the page is empty
+	Last string `json:"last"`
+
+	// More indicates there is more activity past the end of the page
+	More bool `json:"more"`
+}
+
+// pageItem is an activity along with where it's stored
+type pageItem struct {
+	key      []byte
+	deviceID string
+	activity Activity
+}
+
+// GetPage gets a page of activity.  Pass the First or Last cursor from
+// one page as Before or After to get the page next to it
+func (store *ActivityDB) GetPage(request PageRequest) (ActivityPage, error) {
+	retval := ActivityPage{Items: []Activity{}}
+
+	if request.Before != "" && request.After != "" {
+		return retval, ErrBeforeAndAfter
+	}
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	//	Find the range to look in:
+	min, max := rangeKeys(request.StartTime, request.EndTime)
+	if request.EndTime.IsZero() {
+		max = timeKey(maxKeyTime, math.MaxUint64)
+	}
+
+	//	Walk backwards when we want the items just before a point:
+	descending := request.Before != "" || (request.NewestFirst && request.After == "")
+
+	var cursor *pageItem
+	for _, value := range []string{request.Before, request.After} {
+		if value == "" {
+			continue
+		}
+
+		decoded, err := decodeCursor(value)
+		if err != nil {
+			return retval, err
+		}
+		cursor = &decoded
+	}
+
+	items := []pageItem{}
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("activities"))
+		if b == nil {
+			return nil
+		}
+
+		for _, deviceID := range pageDevices(b, request.DeviceID) {
+			found, err := pageBucket(b.Bucket([]byte(deviceID)), deviceID, min, max, cursor, descending, limit+1)
+			if err != nil {
+				return err
+			}
+			items = append(items, found...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return retval, err
+	}
+
+	//	Keep the items closest to where we started:
+	sort.SliceStable(items, func(i, j int) bool {
+		if descending {
+			return comparePageItems(items[i], items[j]) > 0
+		}
+		return comparePageItems(items[i], items[j]) < 0
+	})
+
+	if len(items) > limit {
+		items = items[:limit]
+		retval.More = true
+	}
+
+	//	Put them in the order that was asked for:
+	if descending != request.NewestFirst {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	for _, item := range items {
+		retval.Items = append(retval.Items, item.activity)
+	}
+
+	if len(items) > 0 {
+		retval.First = encodeCursor(items[0])
+		retval.Last = encodeCursor(items[len(items)-1])
+	}
+
+	return retval, nil
+}
+
+// pageDevices gets the devices to page through
+func pageDevices(b *bolt.Bucket, deviceID string) []string {
+	if deviceID != "" {
+		return []string{deviceID}
+	}
+
+	retval := []string{}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			retval = append(retval, string(k))
+		}
+	}
+
+	return retval
+}
+
+// pageBucket gets up to count items from a device bucket, between min and max
+// and past the cursor, walking in the given direction
+func pageBucket(b *bolt.Bucket, deviceID string, min, max []byte, cursor *pageItem, descending bool, count int) ([]pageItem, error) {
+	retval := []pageItem{}
+	if b == nil {
+		return retval, nil
+	}
+
+	c := b.Cursor()
+
+	//	Find where to start:
+	var k, v []byte
+	if descending {
+		start := max
+		if cursor != nil && bytes.Compare(cursor.key, start) < 0 {
+			start = cursor.key
+		}
+
+		k, v = c.Seek(start)
+		if k == nil {
+			k, v = c.Last()
+		} else if bytes.Compare(k, start) > 0 {
+			k, v = c.Prev()
+		}
+	} else {
+		start := min
+		if cursor != nil && bytes.Compare(cursor.key, start) > 0 {
+			start = cursor.key
+		}
+
+		k, v = c.Seek(start)
+	}
+
+	for ; k != nil && len(retval) < count; k, v = step(c, descending) {
+		if bytes.Compare(k, min) < 0 || bytes.Compare(k, max) > 0 {
+			break
+		}
+
+		item := pageItem{key: append([]byte{}, k...), deviceID: deviceID}
+
+		//	Skip the cursor itself (and anything on the wrong side of it):
+		if cursor != nil {
+			order := comparePageItems(item, *cursor)
+			if (descending && order >= 0) || (!descending && order <= 0) {
+				continue
+			}
+		}
+
+		if err := json.Unmarshal(v, &item.activity); err != nil {
+			return retval, err
+		}
+
+		retval = append(retval, item)
+	}
+
+	return retval, nil
+}
+
+// step moves a cursor one item in the given direction
+func step(c *bolt.Cursor, descending bool) ([]byte, []byte) {
+	if descending {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// comparePageItems orders items by time, then by device
+func comparePageItems(a, b pageItem) int {
+	if order := bytes.Compare(a.key, b.key); order != 0 {
+		return order
+	}
+
+	return bytes.Compare([]byte(a.deviceID), []byte(b.deviceID))
+}
+
+// encodeCursor creates a cursor for an item: its key followed by its device id
+func encodeCursor(item pageItem) string {
+	return base64.RawURLEncoding.EncodeToString(append(append([]byte{}, item.key...), item.deviceID...))
+}
+
+// decodeCursor reads a cursor created by encodeCursor
+func decodeCursor(value string) (pageItem, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) < timeKeySize {
+		return pageItem{}, ErrInvalidCursor
+	}
+
+	return pageItem{key: decoded[:timeKeySize], deviceID: string(decoded[timeKeySize:])}, nil
+}
@@ -0,0 +1,114 @@
+package data_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	addTestActivity adds activity for a device, one minute apart, ending a minute ago
+func addTestActivity(db *data.ActivityDB, deviceID string, count int, now time.Time) {
+	for i := count; i >= 1; i-- {
+		db.Add(data.Activity{DeviceID: deviceID, Timestamp: now.Add(time.Duration(-i) * time.Minute), Type: data.ApplianceRunning})
+	}
+}
+
+func TestActivity_GetPage_OldestFirst_PagesThroughAllItems(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	addTestActivity(db, "testdevice", 5, now)
+
+	//	Act
+	first, err1 := db.GetPage(data.PageRequest{DeviceID: "testdevice", Limit: 2})
+	second, err2 := db.GetPage(data.PageRequest{DeviceID: "testdevice", Limit: 2, After: first.Last})
+	third, err3 := db.GetPage(data.PageRequest{DeviceID: "testdevice", Limit: 2, After: second.Last})
+
+	//	Assert
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("GetPage failed: Should have gotten the pages without error: %v / %v / %v", err1, err2, err3)
+	}
+
+	if len(first.Items) != 2 || !first.More || !first.Items[0].Timestamp.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("GetPage failed: First page should have the 2 oldest items and more to come.  Got %+v", first)
+	}
+
+	if len(second.Items) != 2 || !second.Items[0].Timestamp.Equal(now.Add(-3*time.Minute)) {
+		t.Errorf("GetPage failed: Second page should start after the first.  Got %+v", second)
+	}
+
+	if len(third.Items) != 1 || third.More {
+		t.Errorf("GetPage failed: Third page should have the last item and no more.  Got %+v", third)
+	}
+}
+
+func TestActivity_GetPage_NewestFirst_PagesBackwards(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	addTestActivity(db, "washer", 3, now)
+	addTestActivity(db, "dryer", 3, now.Add(-30*time.Second))
+
+	//	Act
+	first, err1 := db.GetPage(data.PageRequest{Limit: 4, NewestFirst: true})
+	second, err2 := db.GetPage(data.PageRequest{Limit: 4, NewestFirst: true, Before: first.Last})
+	back, err3 := db.GetPage(data.PageRequest{Limit: 4, NewestFirst: true, After: second.First})
+
+	//	Assert
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("GetPage failed: Should have gotten the pages without error: %v / %v / %v", err1, err2, err3)
+	}
+
+	all := append(first.Items, second.Items...)
+	if len(all) != 6 || second.More {
+		t.Fatalf("GetPage failed: Should have gotten all 6 items across both pages.  Got %v", len(all))
+	}
+
+	for i := 1; i < len(all); i++ {
+		if all[i].Timestamp.After(all[i-1].Timestamp) {
+			t.Errorf("GetPage failed: Items should be newest first.  Got %+v", all)
+		}
+	}
+
+	if len(back.Items) != 4 || !back.Items[0].Timestamp.Equal(first.Items[0].Timestamp) {
+		t.Errorf("GetPage failed: Paging back should return the first page.  Got %+v", back)
+	}
+}
+
+func TestActivity_GetPage_InvalidCursor_ReturnsError(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	_, err = db.GetPage(data.PageRequest{After: "bogus"})
+
+	//	Assert
+	if err != data.ErrInvalidCursor {
+		t.Errorf("GetPage failed: Should have returned an invalid cursor error.  Got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// Reset removes everything from the config database except the deviceID, so
+// the monitor starts over like it's new: no settings, devices, users, tokens or
+// admin password.  The schema version is kept, so migrations aren't run again
+func (store *ConfigDB) Reset() error {
+	return store.update(func(tx *bolt.Tx) error {
+		//	Hang on to the deviceID as it's stored:
+		var deviceID []byte
+		if b := tx.Bucket([]byte("configItems")); b != nil {
+			if v := b.Get([]byte("deviceID")); v != nil {
+				deviceID = append([]byte{}, v...)
+			}
+		}
+
+		if err := removeBuckets(tx); err != nil {
+			return err
+		}
+
+		if deviceID == nil {
+			return nil
+		}
+
+		b, err := tx.CreateBucket([]byte("configItems"))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte("deviceID"), deviceID)
+	})
+}
+
+// Reset removes all activity and cycles from the activity database
+func (store *ActivityDB) Reset() error {
+	return store.update(removeBuckets)
+}
+
+// Reset resets the config database and, if activity is set, the activity
+// database too
+func (s *Store) Reset(activity bool) error {
+	if err := s.Config.Reset(); err != nil {
+		return err
+	}
+
+	if !activity {
+		return nil
+	}
+
+	return s.Activity.Reset()
+}
+
+// removeBuckets removes every bucket except the metadata bucket
+func removeBuckets(tx *bolt.Tx) error {
+	names := [][]byte{}
+	err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if string(name) != "metadata" {
+			names = append(names, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package data_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+func TestReset_Config_KeepsOnlyDeviceID(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	if _, err := store.Migrate(false); err != nil {
+		t.Fatalf("Couldn't migrate the store: %v", err)
+	}
+
+	store.Config.Set(data.ConfigItem{Name: "deviceID", Value: "testdevice"})
+	store.Config.Set(data.ConfigItem{Name: "name", Value: "washer"})
+	store.Config.AddOrUpdateDevice(data.Device{ID: "testdevice", Name: "Washer"})
+	store.Config.SetAdminPassword("testpassword")
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: time.Now().Add(-1 * time.Minute), Type: data.ApplianceRunning})
+
+	//	Act
+	err := store.Reset(false)
+	deviceID, _ := store.Config.Get("deviceID")
+	name, _ := store.Config.Get("name")
+	devices, _ := store.Config.GetAllDevices()
+	hasPassword, _ := store.Config.HasAdminPassword()
+	activity, _ := store.Activity.GetAllActivity("testdevice")
+	configVersion, _, _ := store.SchemaVersions()
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Reset failed: Should have reset without error: %v", err)
+	}
+
+	if deviceID.Value != "testdevice" {
+		t.Errorf("Reset failed: Should have kept the deviceID.  Got %v", deviceID.Value)
+	}
+
+	if name.Value != "appliance-monitor" {
+		t.Errorf("Reset failed: Should have removed the name setting.  Got %v", name.Value)
+	}
+
+	if len(devices) != 0 {
+		t.Errorf("Reset failed: Should have removed the devices.  Got %v", len(devices))
+	}
+
+	if hasPassword {
+		t.Errorf("Reset failed: Should have removed the admin password")
+	}
+
+	if len(activity) != 1 {
+		t.Errorf("Reset failed: Shouldn't have removed the activity.  Got %v items", len(activity))
+	}
+
+	if configVersion == 0 {
+		t.Errorf("Reset failed: Should have kept the schema version")
+	}
+}
+
+func TestReset_WithActivity_RemovesActivity(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testactivity.db")
+
+	store := openTestStore(t)
+	defer store.Close()
+
+	store.Activity.Add(data.Activity{DeviceID: "testdevice", Timestamp: time.Now().Add(-1 * time.Minute), Type: data.ApplianceRunning})
+	store.Activity.AddCycle(data.Cycle{DeviceID: "testdevice", StartTime: time.Now().Add(-1 * time.Hour), EndTime: time.Now()})
+
+	//	Act
+	err := store.Reset(true)
+	activity, _ := store.Activity.GetAllActivity("testdevice")
+	cycles, _ := store.Activity.GetCycles("testdevice", time.Time{}, time.Now())
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Reset failed: Should have reset without error: %v", err)
+	}
+
+	if len(activity) != 0 {
+		t.Errorf("Reset failed: Should have removed the activity.  Got %v items", len(activity))
+	}
+
+	if len(cycles) != 0 {
+		t.Errorf("Reset failed: Should have removed the cycles.  Got %v", len(cycles))
+	}
+}
@@ -0,0 +1,224 @@
+package data
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// The types of value a setting can hold
+const (
+	SettingString   = "string"
+	SettingInt      = "int"
+	SettingBool     = "bool"
+	SettingURL      = "url"
+	SettingTemplate = "template"
+)
+
+// CustomSettingPrefix is the prefix for settings that aren't in the schema.
+// They're stored as-is, without any validation
+const CustomSettingPrefix = "custom."
+
+// Setting describes a known config item
+type Setting struct {
+	// Name is the config item name
+	Name string `json:"name"`
+
+	// Type is the type of value the setting holds (string / int / bool / url / template)
+	Type string `json:"type"`
+
+	// Default is the value used when the setting hasn't been set
+	Default string `json:"default"`
+
+	// Min is the smallest allowed value (int settings only)
+	Min *int `json:"min,omitempty"`
+
+	// Max is the largest allowed value (int settings only)
+	Max *int `json:"max,omitempty"`
+
+	// Secret indicates the setting holds a credential
+	Secret bool `json:"secret"`
+
+	// ReadOnly indicates the setting is managed by the monitor, and can't be
+	// changed through the API
+	ReadOnly bool `json:"readonly"`
+
+	// Description explains what the setting does
+	Description string `json:"description"`
+}
+
+// Settings is the schema of known config items
+var Settings = []Setting{
+	{
+		Name:        "deviceID",
+		Type:        SettingString,
+		ReadOnly:    true,
+		Description: "The unique id for this appliance monitor.  It's generated the first time the app starts",
+	},
+	{
+		Name:        "name",
+		Type:        SettingString,
+		Default:     "appliance-monitor",
+		Description: "The name this appliance monitor advertises on the local network",
+	},
+	{
+		Name:        "influxserver",
+		Type:        SettingURL,
+		Description: "The InfluxDB server that gets sensor data for debugging, like http://chile.lan:8086",
+	},
+	{
+		Name:        "pushoverapikey",
+		Type:        SettingString,
+		Secret:      true,
+		Description: "The Pushover application API token used to send notifications",
+	},
+	{
+		Name:        "pushoverrecipient",
+		Type:        SettingString,
+		Description: "The Pushover user or group key that gets notifications",
+	},
+	{
+		Name:        "smtpserver",
+		Type:        SettingString,
+		Description: "The mail server (host:port) used to send email notifications, like smtp.gmail.com:587",
+	},
+	{
+		Name:        "smtpusername",
+		Type:        SettingString,
+		Description: "The user name for the mail server.  If it's blank, mail is sent without logging in",
+	},
+	{
+		Name:        "smtppassword",
+		Type:        SettingString,
+		Secret:      true,
+		Description: "The password for the mail server",
+	},
+	{
+		Name:        "smtpfrom",
+		Type:        SettingString,
+		Default:     "appliance-monitor@localhost",
+		Description: "The address email notifications are sent from",
+	},
+	{
+		Name:        "notificationtemplate",
+		Type:        SettingTemplate,
+		Description: "The Go template for the message sent when a cycle finishes.  If it's blank, a built-in message is used",
+	},
+	{
+		Name:        "monitorwindow",
+		Type:        SettingInt,
+		Default:     "120",
+		Min:         bound(1),
+		Max:         bound(3600),
+		Description: "Deprecated: each device has its own minimum monitor time",
+	},
+	{
+		Name:        "provisiontimeout",
+		Type:        SettingInt,
+		Default:     "10",
+		Min:         bound(0),
+		Max:         bound(1440),
+		Description: "How many minutes the wifi can be disconnected before the monitor broadcasts its setup network.  0 only does it when no wifi networks are set up",
+	},
+	{
+		Name:        "retentiondays",
+		Type:        SettingInt,
+		Default:     "365",
+		Min:         bound(0),
+		Max:         bound(36500),
+		Description: "How many days of activity are kept.  0 keeps everything",
+	},
+	{
+		Name:        "retentionmaxentries",
+		Type:        SettingInt,
+		Default:     "10000",
+		Min:         bound(0),
+		Max:         bound(10000000),
+		Description: "How many activities are kept for each device.  0 keeps everything",
+	},
+}
+
+// LookupSetting finds a setting in the schema
+func LookupSetting(name string) (Setting, bool) {
+	for _, setting := range Settings {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+
+	return Setting{}, false
+}
+
+// IsReadOnly returns true if the setting can't be changed through the API
+func IsReadOnly(name string) bool {
+	setting, found := LookupSetting(name)
+	return found && setting.ReadOnly
+}
+
+// ValidateConfigItem checks a config item against the schema.  Unknown items are
+// only allowed if they start with CustomSettingPrefix
+func ValidateConfigItem(item ConfigItem) error {
+	if strings.TrimSpace(item.Name) == "" {
+		return fmt.Errorf("Config name can't be blank")
+	}
+
+	if strings.HasPrefix(item.Name, CustomSettingPrefix) {
+		return nil
+	}
+
+	setting, found := LookupSetting(item.Name)
+	if !found {
+		return fmt.Errorf("Unknown setting: %s.  Custom settings should start with '%s'", item.Name, CustomSettingPrefix)
+	}
+
+	return setting.Validate(item.Value)
+}
+
+// Validate checks that the value is allowed for the setting.  A blank value
+// is always allowed -- it means the default is used
+func (setting Setting) Validate(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	switch setting.Type {
+	case SettingString:
+	case SettingInt:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s should be a whole number: %v", setting.Name, value)
+		}
+
+		if setting.Min != nil && number < *setting.Min {
+			return fmt.Errorf("%s can't be less than %v", setting.Name, *setting.Min)
+		}
+
+		if setting.Max != nil && number > *setting.Max {
+			return fmt.Errorf("%s can't be more than %v", setting.Name, *setting.Max)
+		}
+	case SettingBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s should be true or false: %v", setting.Name, value)
+		}
+	case SettingURL:
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%s should be a url, like http://server:8086: %v", setting.Name, value)
+		}
+	case SettingTemplate:
+		if _, err := template.New(setting.Name).Parse(value); err != nil {
+			return fmt.Errorf("%s isn't a valid template: %v", setting.Name, err)
+		}
+	default:
+		return fmt.Errorf("%s has an unknown type: %s", setting.Name, setting.Type)
+	}
+
+	return nil
+}
+
+// bound is a helper for setting Min and Max in the schema
+func bound(value int) *int {
+	return &value
+}
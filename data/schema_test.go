@@ -0,0 +1,65 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	Every setting in the schema should have a valid default
+func TestSchema_Settings_DefaultsAreValid(t *testing.T) {
+	for _, setting := range data.Settings {
+		//	Act
+		err := setting.Validate(setting.Default)
+
+		//	Assert
+		if err != nil {
+			t.Errorf("Validate failed: Default for %s should be valid: %v", setting.Name, err)
+		}
+	}
+}
+
+func TestSchema_ValidateConfigItem_InvalidItems_ReturnsErrors(t *testing.T) {
+	//	Arrange
+	items := []data.ConfigItem{
+		{Name: "", Value: "something"},
+		{Name: "pushoverrecepient", Value: "typo"},
+		{Name: "retentiondays", Value: "a year"},
+		{Name: "retentiondays", Value: "-1"},
+		{Name: "monitorwindow", Value: "0"},
+		{Name: "influxserver", Value: "chile.lan"},
+		{Name: "notificationtemplate", Value: "{{.Name"},
+	}
+
+	for _, item := range items {
+		//	Act
+		err := data.ValidateConfigItem(item)
+
+		//	Assert
+		if err == nil {
+			t.Errorf("ValidateConfigItem failed: Should have returned an error for item %+v", item)
+		}
+	}
+}
+
+func TestSchema_ValidateConfigItem_ValidItems_NoErrors(t *testing.T) {
+	//	Arrange
+	items := []data.ConfigItem{
+		{Name: "name", Value: "laundry-room"},
+		{Name: "retentiondays", Value: "30"},
+		{Name: "retentiondays", Value: ""},
+		{Name: "influxserver", Value: "http://chile.lan:8086"},
+		{Name: "notificationtemplate", Value: "{{.Name}} is done"},
+		{Name: "custom.anything", Value: "goes"},
+	}
+
+	for _, item := range items {
+		//	Act
+		err := data.ValidateConfigItem(item)
+
+		//	Assert
+		if err != nil {
+			t.Errorf("ValidateConfigItem failed: Should not have returned an error for item %+v: %v", item, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/viper"
+)
+
+const (
+	// RedactedValue replaces the value of secret settings in API responses.
+	// Setting a secret to RedactedValue leaves it unchanged
+	RedactedValue = "********"
+
+	// encryptedPrefix marks a config value that's encrypted
+	encryptedPrefix = "enc:v1:"
+
+	// The size of the device-local key, in bytes (AES-256)
+	secretKeySize = 32
+)
+
+// IsSecret returns true if the config item holds a secret
+func IsSecret(name string) bool {
+	setting, found := LookupSetting(name)
+	return found && setting.Secret
+}
+
+// RedactConfigItem hides the value of a secret config item.  Blank secrets
+// stay blank, so it's still possible to tell whether they've been set
+func RedactConfigItem(item ConfigItem) ConfigItem {
+	if IsSecret(item.Name) && item.Value != "" {
+		item.Value = RedactedValue
+	}
+
+	return item
+}
+
+// secretKeyPath is where the device-local key for secret settings is kept.  It
+// lives next to the database (and isn't part of backups), so a copy of the
+// database alone can't be used to read the secrets
+func (store *ConfigDB) secretKeyPath() string {
+	return store.path + ".key"
+}
+
+// holdSecretKey keeps any new device-local key in memory only, until the
+// returned function is called.  Then the unsaved key is forgotten.  It's used
+// for dry runs, which are rolled back, so they don't leave a key behind
+func (store *ConfigDB) holdSecretKey() func() {
+	store.keyMu.Lock()
+	defer store.keyMu.Unlock()
+
+	loaded := store.key != nil
+	store.unsavedKey = true
+
+	return func() {
+		store.keyMu.Lock()
+		defer store.keyMu.Unlock()
+
+		store.unsavedKey = false
+		if !loaded {
+			store.key = nil
+		}
+	}
+}
+
+// secretKey loads the device-local key.  If create is set and there isn't a key
+// yet, a new one is generated
+func (store *ConfigDB) secretKey(create bool) ([]byte, error) {
+	store.keyMu.Lock()
+	defer store.keyMu.Unlock()
+
+	if store.key != nil {
+		return store.key, nil
+	}
+
+	key, err := ioutil.ReadFile(store.secretKeyPath())
+	if os.IsNotExist(err) && create {
+		key = make([]byte, secretKeySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+
+		if store.unsavedKey {
+			store.key = key
+			return key, nil
+		}
+
+		if err := ioutil.WriteFile(store.secretKeyPath(), key, 0600); err != nil {
+			return nil, fmt.Errorf("Problem saving the secret key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("Problem reading the secret key: %v", err)
+	}
+
+	if len(key) != secretKeySize {
+		return nil, fmt.Errorf("The secret key in %s is the wrong size", store.secretKeyPath())
+	}
+
+	store.key = key
+	return key, nil
+}
+
+// encryptValue encrypts the value of a secret config item.  The name is
+// authenticated too, so an encrypted value can't be moved to another setting
+func (store *ConfigDB) encryptValue(name, value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+
+	key, err := store.secretKey(true)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptValue decrypts the value of a secret config item.  Values that
+// aren't encrypted are returned as-is
+func (store *ConfigDB) decryptValue(name, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	key, err := store.secretKey(false)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("Encrypted value is too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// readConfigItem unmarshals a stored config item, decrypting it if it's a
+// secret.  A secret that can't be decrypted (because the database came from
+// another device, for example) reads as unset
+func (store *ConfigDB) readConfigItem(encoded []byte) (ConfigItem, error) {
+	retval := ConfigItem{}
+	if err := json.Unmarshal(encoded, &retval); err != nil {
+		return retval, err
+	}
+
+	if IsSecret(retval.Name) {
+		value, err := store.decryptValue(retval.Name, retval.Value)
+		if err != nil {
+			log.Printf("[WARN] Problem decrypting %s, so it reads as unset.  Is %s missing or damaged? %v", retval.Name, store.secretKeyPath(), err)
+			value = ""
+		}
+		retval.Value = value
+	}
+
+	return retval, nil
+}
+
+// encryptSecrets encrypts any secrets stored in plaintext.  Secrets that are
+// only set in the config file are imported, so they keep working once they're
+// removed from it
+func encryptSecrets(s *Store, tx *bolt.Tx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte("configItems"))
+	if err != nil {
+		return err
+	}
+
+	updated := map[string][]byte{}
+	err = b.ForEach(func(k, v []byte) error {
+		item := ConfigItem{}
+		if err := json.Unmarshal(v, &item); err != nil {
+			return err
+		}
+
+		if !IsSecret(item.Name) || item.Value == "" || strings.HasPrefix(item.Value, encryptedPrefix) {
+			return nil
+		}
+
+		value, err := s.Config.encryptValue(item.Name, item.Value)
+		if err != nil {
+			return err
+		}
+		item.Value = value
+
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		updated[string(k)] = encoded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//	Import the secrets from the config file that aren't stored yet:
+	for _, setting := range Settings {
+		value := viper.GetString(configPrefix + "." + setting.Name)
+		if !setting.Secret || value == "" || b.Get([]byte(setting.Name)) != nil {
+			continue
+		}
+
+		encrypted, err := s.Config.encryptValue(setting.Name, value)
+		if err != nil {
+			return err
+		}
+
+		id, _ := b.NextSequence()
+		encoded, err := json.Marshal(ConfigItem{ID: int64(id), Name: setting.Name, Value: encrypted, LastUpdated: time.Now()})
+		if err != nil {
+			return err
+		}
+
+		updated[setting.Name] = encoded
+	}
+
+	for k, v := range updated {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newGCM creates the AES-GCM cipher for the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
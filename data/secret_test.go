@@ -0,0 +1,228 @@
+package data_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/spf13/viper"
+)
+
+//	storedConfigValue reads a config item's value straight from the database file
+func storedConfigValue(t *testing.T, filename, name string) string {
+	boltdb, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Couldn't open the database file: %v", err)
+	}
+	defer boltdb.Close()
+
+	item := data.ConfigItem{}
+	boltdb.View(func(tx *bolt.Tx) error {
+		return json.Unmarshal(tx.Bucket([]byte("configItems")).Get([]byte(name)), &item)
+	})
+
+	return item.Value
+}
+
+//	Secrets should be encrypted in the database, but read back in plaintext
+func TestSecret_SetSecret_EncryptedAtRest(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".key")
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+
+	secret := "ad2ujxv7zi7i5zw8fuvt5hu3chjuv4"
+
+	//	Act
+	_, err = db.Set(data.ConfigItem{Name: "pushoverapikey", Value: secret})
+	response, _ := db.Get("pushoverapikey")
+	db.Close()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Set failed: Should have set the secret without error: %v", err)
+	}
+
+	if response.Value != secret {
+		t.Errorf("Get failed: Should have decrypted the secret, but got %s", response.Value)
+	}
+
+	if stored := storedConfigValue(t, filename, "pushoverapikey"); strings.Contains(stored, secret) {
+		t.Errorf("Set failed: The secret shouldn't be stored in plaintext: %s", stored)
+	}
+}
+
+//	Without the device key, secrets should read as unset
+func TestSecret_KeyMissing_SecretReadsAsUnset(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".key")
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	db.Set(data.ConfigItem{Name: "pushoverapikey", Value: "somesecret"})
+	db.Close()
+	os.Remove(filename + ".key")
+
+	db, err = data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	response, err := db.Get("pushoverapikey")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Get failed: Should have returned without error: %v", err)
+	}
+
+	if response.Value != "" {
+		t.Errorf("Get failed: Shouldn't have been able to read the secret, but got %s", response.Value)
+	}
+}
+
+//	Secrets should be redacted, but blank secrets and other settings left alone
+func TestSecret_RedactConfigItem_OnlyRedactsSecrets(t *testing.T) {
+	//	Arrange
+	items := map[data.ConfigItem]string{
+		{Name: "pushoverapikey", Value: "somesecret"}: data.RedactedValue,
+		{Name: "pushoverapikey", Value: ""}:           "",
+		{Name: "name", Value: "laundry-room"}:         "laundry-room",
+	}
+
+	for item, expected := range items {
+		//	Act
+		response := data.RedactConfigItem(item)
+
+		//	Assert
+		if response.Value != expected {
+			t.Errorf("RedactConfigItem failed: Expected %s for %+v but got %s", expected, item, response.Value)
+		}
+	}
+}
+
+//	Migrating should encrypt secrets stored by older versions of the app
+func TestSecret_Migrate_EncryptsPlaintextSecrets(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testing.db.key")
+	defer os.Remove("testactivity.db")
+
+	createOldDatabase(t, "testing.db", func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("configItems"))
+		if err != nil {
+			return err
+		}
+
+		encoded, _ := json.Marshal(data.ConfigItem{ID: 1, Name: "pushoverapikey", Value: "oldsecret"})
+		return b.Put([]byte("pushoverapikey"), encoded)
+	})
+
+	store := openTestStore(t)
+
+	//	Act
+	_, err := store.Migrate(false)
+	response, _ := store.Config.Get("pushoverapikey")
+	store.Close()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Migrate failed: Should have migrated without error: %v", err)
+	}
+
+	if response.Value != "oldsecret" {
+		t.Errorf("Migrate failed: Should still be able to read the secret, but got %s", response.Value)
+	}
+
+	if stored := storedConfigValue(t, "testing.db", "pushoverapikey"); stored == "oldsecret" {
+		t.Errorf("Migrate failed: The secret should have been encrypted")
+	}
+}
+
+//	A dry run shouldn't leave a secret key behind
+func TestSecret_MigrateDryRun_DoesntCreateKey(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testing.db.key")
+	defer os.Remove("testactivity.db")
+
+	createOldDatabase(t, "testing.db", func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("configItems"))
+		if err != nil {
+			return err
+		}
+
+		encoded, _ := json.Marshal(data.ConfigItem{ID: 1, Name: "pushoverapikey", Value: "oldsecret"})
+		return b.Put([]byte("pushoverapikey"), encoded)
+	})
+
+	store := openTestStore(t)
+
+	//	Act
+	_, err := store.Migrate(true)
+	_, keyErr := os.Stat("testing.db.key")
+	store.Close()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Migrate failed: Should have done a dry run without error: %v", err)
+	}
+
+	if !os.IsNotExist(keyErr) {
+		t.Errorf("Migrate failed: A dry run shouldn't have created the secret key")
+	}
+
+	if stored := storedConfigValue(t, "testing.db", "pushoverapikey"); stored != "oldsecret" {
+		t.Errorf("Migrate failed: A dry run shouldn't have encrypted the secret, but got %s", stored)
+	}
+}
+
+//	Migrating should import secrets that are only in the config file
+func TestSecret_Migrate_ImportsConfigFileSecrets(t *testing.T) {
+	//	Arrange
+	defer os.Remove("testing.db")
+	defer os.Remove("testing.db.key")
+	defer os.Remove("testactivity.db")
+	defer viper.Reset()
+
+	createOldDatabase(t, "testing.db", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("configItems"))
+		return err
+	})
+
+	viper.Set("settings.pushoverapikey", "filesecret")
+	store := openTestStore(t)
+
+	//	Act
+	_, err := store.Migrate(false)
+	viper.Reset()
+	response, _ := store.Config.Get("pushoverapikey")
+	store.Close()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("Migrate failed: Should have migrated without error: %v", err)
+	}
+
+	if response.Value != "filesecret" {
+		t.Errorf("Migrate failed: Should have imported the secret from the config file, but got %s", response.Value)
+	}
+
+	if stored := storedConfigValue(t, "testing.db", "pushoverapikey"); stored == "filesecret" {
+		t.Errorf("Migrate failed: The imported secret should have been encrypted")
+	}
+}
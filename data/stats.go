@@ -0,0 +1,95 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// CycleStats summarizes the cycles in a period
+type CycleStats struct {
+	// Period is the day (2006-01-02) or month (2006-01) being summarized
+	Period string `json:"period"`
+
+	// Cycles is the number of cycles that started in the period
+	Cycles int `json:"cycles"`
+
+	// RunTime is the total time the cycles ran
+	RunTime time.Duration `json:"runtime"`
+
+	// EnergyKWh is the total energy used by the cycles, in kWh
+	EnergyKWh float64 `json:"energykwh"`
+
+	// Cost is the total cost of the cycles
+	Cost float64 `json:"cost"`
+}
+
+// Stats summarizes energy use and cost for a set of cycles
+type Stats struct {
+	Currency string       `json:"currency"`
+	Cycles   []Cycle      `json:"cycles"`
+	Days     []CycleStats `json:"days"`
+	Months   []CycleStats `json:"months"`
+	Total    CycleStats   `json:"total"`
+}
+
+// Summarize gets the cost of each cycle, and totals for each day and month.
+// Cycles are costed when they're recorded, so a cycle is only costed with
+// the given tariff if it doesn't have a cost yet
+func Summarize(cycles []Cycle, tariff Tariff) Stats {
+	retval := Stats{
+		Currency: tariff.Currency,
+		Cycles:   []Cycle{},
+		Days:     []CycleStats{},
+		Months:   []CycleStats{},
+	}
+
+	days := make(map[string]*CycleStats)
+	months := make(map[string]*CycleStats)
+
+	for _, cycle := range cycles {
+		if cycle.Cost == 0 {
+			cycle.Cost = tariff.Cost(cycle.StartTime, cycle.EndTime, cycle.EnergyWh)
+		}
+		retval.Cycles = append(retval.Cycles, cycle)
+
+		addCycle(&retval.Total, cycle)
+		addCycle(period(days, cycle.StartTime.Format("2006-01-02")), cycle)
+		addCycle(period(months, cycle.StartTime.Format("2006-01")), cycle)
+	}
+
+	retval.Days = sortedPeriods(days)
+	retval.Months = sortedPeriods(months)
+
+	return retval
+}
+
+// addCycle adds the cycle to the period totals
+func addCycle(stats *CycleStats, cycle Cycle) {
+	stats.Cycles++
+	stats.RunTime += cycle.EndTime.Sub(cycle.StartTime)
+	stats.EnergyKWh += cycle.EnergyWh / 1000
+	stats.Cost += cycle.Cost
+}
+
+// period gets the stats for the period, adding them if they don't exist
+func period(periods map[string]*CycleStats, name string) *CycleStats {
+	if _, ok := periods[name]; !ok {
+		periods[name] = &CycleStats{Period: name}
+	}
+
+	return periods[name]
+}
+
+// sortedPeriods gets the stats for each period, oldest first
+func sortedPeriods(periods map[string]*CycleStats) []CycleStats {
+	retval := []CycleStats{}
+	for _, stats := range periods {
+		retval = append(retval, *stats)
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].Period < retval[j].Period
+	})
+
+	return retval
+}
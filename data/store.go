@@ -0,0 +1,114 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// DefaultTimeout is how long to wait for another process to release the lock on a database
+const DefaultTimeout = 5 * time.Second
+
+// Store holds the open config and activity databases.  It's opened once at startup,
+// shared by the API and the collector, and closed on shutdown
+type Store struct {
+	Config   *ConfigDB
+	Activity *ActivityDB
+}
+
+// OpenStore opens (or creates) the config and activity databases.  If another
+// process has a database open, waits up to timeout for it to let go
+func OpenStore(configPath, activityPath string, timeout time.Duration) (*Store, error) {
+	configDB, err := OpenConfigDB(configPath, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	activityDB, err := OpenActivityDB(activityPath, timeout)
+	if err != nil {
+		configDB.Close()
+		return nil, err
+	}
+
+	return &Store{Config: configDB, Activity: activityDB}, nil
+}
+
+// Close closes both databases.  Any transactions in progress are allowed to finish first
+func (s *Store) Close() error {
+	activityErr := s.Activity.Close()
+	configErr := s.Config.Close()
+
+	if activityErr != nil {
+		return activityErr
+	}
+
+	return configErr
+}
+
+// OpenConfigDB opens (or creates) the config database
+func OpenConfigDB(path string, timeout time.Duration) (*ConfigDB, error) {
+	db, err := openBolt(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigDB{db: db, path: path, timeout: timeout}, nil
+}
+
+// Close closes the config database
+func (store *ConfigDB) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.db.Close()
+}
+
+// OpenActivityDB opens (or creates) the activity database
+func OpenActivityDB(path string, timeout time.Duration) (*ActivityDB, error) {
+	db, err := openBolt(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActivityDB{db: db, path: path, timeout: timeout}, nil
+}
+
+// Close closes the activity database
+func (store *ActivityDB) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.db.Close()
+}
+
+// swapFile closes a database, moves the file at newPath over it and opens it
+// again.  If the move fails, the original file is opened again
+func swapFile(db *bolt.DB, path, newPath string, timeout time.Duration) (*bolt.DB, error) {
+	if err := db.Close(); err != nil {
+		return db, err
+	}
+
+	moveErr := os.Rename(newPath, path)
+
+	reopened, err := openBolt(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return reopened, moveErr
+}
+
+// openBolt opens a BoltDB file, giving up if the file lock can't be had within timeout
+func openBolt(path string, timeout time.Duration) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("Timed out waiting for %s.  Is another copy of the app running?", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Problem opening %s: %v", path, err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,279 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/rs/xid"
+)
+
+// The channels a subscriber can get notifications on
+const (
+	ChannelPushover = "pushover"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+)
+
+// Subscriber is a person who gets notifications about devices
+type Subscriber struct {
+	// ID is the unique subscriber identifier
+	ID string `json:"id"`
+
+	// Name is the name of the person
+	Name string `json:"name"`
+
+	// Username is the user account the subscriber belongs to, if any.  People
+	// without an account can still be subscribers
+	Username string `json:"username"`
+
+	// Devices are the ids of the devices to notify about.  If there are no
+	// devices, all devices are included
+	Devices []string `json:"devices"`
+
+	// Events are the events to notify about (running / stopped).  If there are
+	// no events, the subscriber hears when a device finishes running
+	Events []string `json:"events"`
+
+	// Channel is how notifications are sent (pushover / email / webhook)
+	Channel string `json:"channel"`
+
+	// Target is where notifications are sent: the Pushover user key, the
+	// email address, or the webhook url
+	Target string `json:"target"`
+
+	// QuietHours is when the subscriber doesn't want notifications
+	QuietHours QuietHours `json:"quiethours"`
+
+	// LastUpdated indicates when the subscriber was last updated
+	LastUpdated time.Time `json:"updated"`
+}
+
+// QuietHours is a time of day when notifications aren't sent.  If End is
+// before Start, quiet hours run past midnight.  Blank means no quiet hours
+type QuietHours struct {
+	// Start is the time of day quiet hours start, like 22:00
+	Start string `json:"start"`
+
+	// End is the time of day quiet hours end, like 07:00
+	End string `json:"end"`
+}
+
+// Validate checks that the subscriber has everything needed to send notifications
+func (subscriber Subscriber) Validate() error {
+	if strings.TrimSpace(subscriber.Name) == "" {
+		return errors.New("Subscriber name can't be blank")
+	}
+
+	switch subscriber.Channel {
+	case ChannelPushover:
+		if strings.TrimSpace(subscriber.Target) == "" {
+			return errors.New("Pushover subscribers need a Pushover user key")
+		}
+	case ChannelEmail:
+		if _, err := mail.ParseAddress(subscriber.Target); err != nil {
+			return fmt.Errorf("Invalid email address: %s", subscriber.Target)
+		}
+	case ChannelWebhook:
+		parsed, err := url.Parse(subscriber.Target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("Invalid webhook url: %s", subscriber.Target)
+		}
+	default:
+		return fmt.Errorf("Unknown channel: %s", subscriber.Channel)
+	}
+
+	if err := validateEvents(subscriber.Events); err != nil {
+		return err
+	}
+
+	return subscriber.QuietHours.Validate()
+}
+
+// Wants returns true if the subscriber should hear about the event for the device
+func (subscriber Subscriber) Wants(deviceID string, event EventType) bool {
+	events := subscriber.Events
+	if len(events) == 0 {
+		events = []string{ApplianceStopped.String()}
+	}
+
+	return containsOrEmpty(subscriber.Devices, deviceID) && contains(events, event.String())
+}
+
+// Validate checks that the quiet hours are blank, or both times are valid
+func (q QuietHours) Validate() error {
+	if q.Start == "" && q.End == "" {
+		return nil
+	}
+
+	if _, err := minuteOfDay(q.Start); err != nil {
+		return fmt.Errorf("Quiet hours have an invalid start time: %v", q.Start)
+	}
+
+	if _, err := minuteOfDay(q.End); err != nil {
+		return fmt.Errorf("Quiet hours have an invalid end time: %v", q.End)
+	}
+
+	return nil
+}
+
+// Contains returns true if the time is during quiet hours
+func (q QuietHours) Contains(when time.Time) bool {
+	start, err := minuteOfDay(q.Start)
+	if err != nil {
+		return false
+	}
+
+	end, err := minuteOfDay(q.End)
+	if err != nil {
+		return false
+	}
+
+	now := when.Hour()*60 + when.Minute()
+	if end <= start {
+		return now >= start || now < end
+	}
+
+	return now >= start && now < end
+}
+
+// GetAllSubscribers gets all subscribers
+func (store *ConfigDB) GetAllSubscribers() ([]Subscriber, error) {
+	//	Our return item
+	retval := []Subscriber{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("subscribers"))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			subscriber := Subscriber{}
+			if err := json.Unmarshal(v, &subscriber); err != nil {
+				return err
+			}
+
+			retval = append(retval, subscriber)
+			return nil
+		})
+	})
+
+	return retval, err
+}
+
+// GetSubscriber gets a single subscriber.  If the subscriber can't be found,
+// returns an empty subscriber
+func (store *ConfigDB) GetSubscriber(id string) (Subscriber, error) {
+	//	Our return item
+	retval := Subscriber{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("subscribers"))
+		if b == nil {
+			return nil
+		}
+
+		subscriberBytes := b.Get([]byte(id))
+		if len(subscriberBytes) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(subscriberBytes, &retval)
+	})
+
+	return retval, err
+}
+
+// AddOrUpdateSubscriber adds a subscriber, or updates an existing one
+func (store *ConfigDB) AddOrUpdateSubscriber(subscriber Subscriber) (Subscriber, error) {
+	//	Our return item:
+	retval := subscriber
+
+	if err := retval.Validate(); err != nil {
+		return retval, err
+	}
+
+	if retval.Devices == nil {
+		retval.Devices = []string{}
+	}
+
+	if retval.Events == nil {
+		retval.Events = []string{}
+	}
+
+	//	Update the database:
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("subscribers"))
+		if err != nil {
+			return err
+		}
+
+		if retval.ID == "" {
+			retval.ID = xid.New().String()
+		}
+
+		//	Set the current datetime:
+		retval.LastUpdated = time.Now()
+
+		//	Serialize to JSON format
+		encoded, err := json.Marshal(retval)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(retval.ID), encoded)
+	})
+
+	return retval, err
+}
+
+// RemoveSubscriber removes a subscriber
+func (store *ConfigDB) RemoveSubscriber(id string) error {
+	//	If there is no subscriber id, throw an error:
+	if strings.TrimSpace(id) == "" {
+		return errors.New("Subscriber id can't be blank")
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("subscribers"))
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(id))
+	})
+}
+
+// validateEvents checks that the events can be subscribed to
+func validateEvents(events []string) error {
+	for _, event := range events {
+		eventType, err := ParseEventType(event)
+		if err != nil || (eventType != ApplianceRunning && eventType != ApplianceStopped) {
+			return fmt.Errorf("Can't subscribe to event: %s", event)
+		}
+	}
+
+	return nil
+}
+
+// contains returns true if the list has the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsOrEmpty returns true if the list has the value, or is empty
+func containsOrEmpty(list []string, value string) bool {
+	return len(list) == 0 || contains(list, value)
+}
@@ -0,0 +1,117 @@
+package data_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+func TestSubscribers_Validate_InvalidSubscribers_ReturnsErrors(t *testing.T) {
+	//	Arrange
+	subscribers := []data.Subscriber{
+		{Name: "", Channel: data.ChannelPushover, Target: "u123"},
+		{Name: "Sam", Channel: "carrierpigeon", Target: "u123"},
+		{Name: "Sam", Channel: data.ChannelPushover, Target: ""},
+		{Name: "Sam", Channel: data.ChannelEmail, Target: "not an email"},
+		{Name: "Sam", Channel: data.ChannelWebhook, Target: "ftp://example.com/hook"},
+		{Name: "Sam", Channel: data.ChannelPushover, Target: "u123", Events: []string{"bogus"}},
+		{Name: "Sam", Channel: data.ChannelPushover, Target: "u123", QuietHours: data.QuietHours{Start: "22:00"}},
+	}
+
+	for _, subscriber := range subscribers {
+		//	Act
+		err := subscriber.Validate()
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Validate failed: Should have returned an error for subscriber %+v", subscriber)
+		}
+	}
+}
+
+//	Quiet hours that run past midnight should include both sides of it
+func TestSubscribers_QuietHours_Overnight_ContainsLateAndEarly(t *testing.T) {
+	//	Arrange
+	quiet := data.QuietHours{Start: "22:00", End: "07:00"}
+	day := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]bool{
+		"21:59": false,
+		"22:00": true,
+		"03:00": true,
+		"06:59": true,
+		"07:00": false,
+		"12:00": false,
+	}
+
+	for clock, expected := range tests {
+		when, _ := time.Parse("15:04", clock)
+		when = day.Add(time.Duration(when.Hour())*time.Hour + time.Duration(when.Minute())*time.Minute)
+
+		//	Act
+		response := quiet.Contains(when)
+
+		//	Assert
+		if response != expected {
+			t.Errorf("Contains failed: Expected %v at %s", expected, clock)
+		}
+	}
+
+	if (data.QuietHours{}).Contains(day) {
+		t.Errorf("Contains failed: Blank quiet hours shouldn't contain anything")
+	}
+}
+
+//	Subscribers should hear about every device finishing until they choose otherwise
+func TestSubscribers_Wants_UsesDefaultsForBlankChoices(t *testing.T) {
+	//	Arrange
+	blank := data.Subscriber{}
+	devicesOnly := data.Subscriber{Devices: []string{"dryer"}}
+	eventsOnly := data.Subscriber{Events: []string{"running"}}
+
+	//	Act & Assert
+	if !blank.Wants("washer", data.ApplianceStopped) || blank.Wants("washer", data.ApplianceRunning) {
+		t.Errorf("Wants failed: Should only want devices stopping")
+	}
+
+	if !devicesOnly.Wants("dryer", data.ApplianceStopped) || devicesOnly.Wants("washer", data.ApplianceStopped) {
+		t.Errorf("Wants failed: Should only want the dryer stopping")
+	}
+
+	if !eventsOnly.Wants("washer", data.ApplianceRunning) || eventsOnly.Wants("washer", data.ApplianceStopped) {
+		t.Errorf("Wants failed: Should only want devices starting")
+	}
+}
+
+func TestSubscribers_AddOrUpdateSubscriber_ThenGetAndRemove_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	added, err := db.AddOrUpdateSubscriber(data.Subscriber{Name: "Sam", Channel: data.ChannelEmail, Target: "sam@example.com"})
+	found, _ := db.GetSubscriber(added.ID)
+	db.RemoveSubscriber(added.ID)
+	all, _ := db.GetAllSubscribers()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("AddOrUpdateSubscriber failed: Should have added the subscriber without error: %v", err)
+	}
+
+	if added.ID == "" || found.Target != "sam@example.com" {
+		t.Errorf("GetSubscriber failed: Should have found the subscriber, but got %+v", found)
+	}
+
+	if len(all) != 0 {
+		t.Errorf("RemoveSubscriber failed: Should have removed the subscriber, but still have %+v", all)
+	}
+}
@@ -0,0 +1,223 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Tariff describes what electricity costs
+type Tariff struct {
+	// Currency is the currency symbol or code used to display costs
+	Currency string `json:"currency"`
+
+	// BaseRate is the cost per kWh when no time-of-use rate applies
+	BaseRate float64 `json:"baserate"`
+
+	// Rates are the time-of-use rates.  The first matching rate is used
+	Rates []TariffRate `json:"rates"`
+
+	// LastUpdated indicates when the tariff was last updated
+	LastUpdated time.Time `json:"updated"`
+}
+
+// TariffRate is the cost per kWh during part of the day
+type TariffRate struct {
+	// Name is the name of the rate (peak / off-peak / etc)
+	Name string `json:"name"`
+
+	// Start is the time of day the rate starts, like 16:00
+	Start string `json:"start"`
+
+	// End is the time of day the rate ends, like 21:00.  If it's before
+	// Start, the rate runs past midnight
+	End string `json:"end"`
+
+	// Days are the days of the week the rate applies (0 is Sunday).  If
+	// there are no days, the rate applies every day
+	Days []time.Weekday `json:"days"`
+
+	// Rate is the cost per kWh
+	Rate float64 `json:"rate"`
+}
+
+// Validate checks the tariff rates make sense
+func (t Tariff) Validate() error {
+	if t.BaseRate < 0 {
+		return errors.New("Base rate can't be negative")
+	}
+
+	for _, r := range t.Rates {
+		if r.Rate < 0 {
+			return fmt.Errorf("Rate %s can't be negative", r.Name)
+		}
+
+		if _, err := minuteOfDay(r.Start); err != nil {
+			return fmt.Errorf("Rate %s has an invalid start time: %v", r.Name, r.Start)
+		}
+
+		if _, err := minuteOfDay(r.End); err != nil {
+			return fmt.Errorf("Rate %s has an invalid end time: %v", r.Name, r.End)
+		}
+
+		for _, d := range r.Days {
+			if d < time.Sunday || d > time.Saturday {
+				return fmt.Errorf("Rate %s has an invalid day: %v", r.Name, d)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RateAt gets the cost per kWh at the given time
+func (t Tariff) RateAt(when time.Time) float64 {
+	for _, r := range t.Rates {
+		if r.appliesAt(when) {
+			return r.Rate
+		}
+	}
+
+	return t.BaseRate
+}
+
+// Cost gets the cost of using energyWh watt-hours between start and end.  The
+// energy is assumed to be used evenly, so cycles that cross a rate change are
+// charged at both rates
+func (t Tariff) Cost(start, end time.Time, energyWh float64) float64 {
+	if energyWh <= 0 {
+		return 0
+	}
+
+	kWh := energyWh / 1000
+
+	duration := end.Sub(start)
+	if duration <= 0 {
+		return kWh * t.RateAt(start)
+	}
+
+	//	Charge each minute of the cycle at the rate in effect:
+	retval := float64(0)
+	for slice := start; slice.Before(end); slice = slice.Add(time.Minute) {
+		sliceEnd := slice.Add(time.Minute)
+		if sliceEnd.After(end) {
+			sliceEnd = end
+		}
+
+		fraction := float64(sliceEnd.Sub(slice)) / float64(duration)
+		retval += kWh * fraction * t.RateAt(slice)
+	}
+
+	return retval
+}
+
+// appliesAt returns true if the rate is in effect at the given time
+func (r TariffRate) appliesAt(when time.Time) bool {
+	start, err := minuteOfDay(r.Start)
+	if err != nil {
+		return false
+	}
+
+	end, err := minuteOfDay(r.End)
+	if err != nil {
+		return false
+	}
+
+	now := when.Hour()*60 + when.Minute()
+	day := when.Weekday()
+
+	//	A rate that runs past midnight started the day before:
+	inRange := now >= start && now < end
+	if end <= start {
+		inRange = now >= start || now < end
+		if now < end {
+			day = (day + 6) % 7
+		}
+	}
+
+	if !inRange {
+		return false
+	}
+
+	if len(r.Days) == 0 {
+		return true
+	}
+
+	for _, d := range r.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// minuteOfDay parses a time of day like 16:30 into minutes since midnight
+func minuteOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// GetTariff gets the electricity tariff.  If it hasn't been set, returns an empty tariff
+func (store *ConfigDB) GetTariff() (Tariff, error) {
+	//	Our return item
+	retval := Tariff{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		//	Get the item from the bucket
+		b := tx.Bucket([]byte("tariff"))
+
+		if b != nil {
+			tariffBytes := b.Get([]byte("current"))
+
+			//	Need to make sure we got something back here before we try to unmarshal
+			if len(tariffBytes) > 0 {
+				if err := json.Unmarshal(tariffBytes, &retval); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return retval, err
+}
+
+// SetTariff sets the electricity tariff
+func (store *ConfigDB) SetTariff(tariff Tariff) (Tariff, error) {
+	//	Our return item:
+	retval := tariff
+
+	if err := retval.Validate(); err != nil {
+		return retval, err
+	}
+
+	//	Update the database:
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("tariff"))
+		if err != nil {
+			return err
+		}
+
+		//	Set the current datetime:
+		retval.LastUpdated = time.Now()
+
+		//	Serialize to JSON format
+		encoded, err := json.Marshal(retval)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte("current"), encoded)
+	})
+
+	return retval, err
+}
@@ -0,0 +1,139 @@
+package data_test
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	A tariff with a weekday evening peak and an overnight off-peak rate
+var testTariff = data.Tariff{
+	Currency: "$",
+	BaseRate: 0.15,
+	Rates: []data.TariffRate{
+		{Name: "peak", Start: "16:00", End: "21:00", Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, Rate: 0.30},
+		{Name: "offpeak", Start: "23:00", End: "06:00", Rate: 0.10},
+	},
+}
+
+func TestTariff_RateAt_ReturnsRateInEffect(t *testing.T) {
+	//	Arrange
+	tests := []struct {
+		when     time.Time
+		expected float64
+	}{
+		{time.Date(2026, 10, 19, 17, 0, 0, 0, time.UTC), 0.30}, // Monday evening
+		{time.Date(2026, 10, 18, 17, 0, 0, 0, time.UTC), 0.15}, // Sunday evening
+		{time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), 0.15}, // Monday noon
+		{time.Date(2026, 10, 19, 23, 30, 0, 0, time.UTC), 0.10},
+		{time.Date(2026, 10, 20, 5, 59, 0, 0, time.UTC), 0.10},
+		{time.Date(2026, 10, 20, 6, 0, 0, 0, time.UTC), 0.15},
+	}
+
+	for _, test := range tests {
+		//	Act
+		rate := testTariff.RateAt(test.when)
+
+		//	Assert
+		if rate != test.expected {
+			t.Errorf("RateAt failed: Expected %v at %v but got %v", test.expected, test.when, rate)
+		}
+	}
+}
+
+func TestTariff_Cost_CycleCrossesRateChange_ChargesBothRates(t *testing.T) {
+	//	Arrange
+	//	One hour, half before the peak and half during:
+	start := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 19, 16, 30, 0, 0, time.UTC)
+	energyWh := float64(2000)
+	expected := 1*0.15 + 1*0.30
+
+	//	Act
+	cost := testTariff.Cost(start, end, energyWh)
+
+	//	Assert
+	if math.Abs(cost-expected) > 0.0001 {
+		t.Errorf("Cost failed: Expected %v but got %v", expected, cost)
+	}
+}
+
+func TestTariff_Validate_InvalidRates_ReturnsErrors(t *testing.T) {
+	//	Arrange
+	tariffs := []data.Tariff{
+		{BaseRate: -1},
+		{Rates: []data.TariffRate{{Name: "bad", Start: "25:00", End: "06:00"}}},
+		{Rates: []data.TariffRate{{Name: "bad", Start: "01:00", End: "bogus"}}},
+		{Rates: []data.TariffRate{{Name: "bad", Start: "01:00", End: "06:00", Rate: -0.1}}},
+		{Rates: []data.TariffRate{{Name: "bad", Start: "01:00", End: "06:00", Days: []time.Weekday{7}}}},
+	}
+
+	for _, tariff := range tariffs {
+		//	Act
+		err := tariff.Validate()
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Validate failed: Should have returned an error for tariff %+v", tariff)
+		}
+	}
+}
+
+func TestTariff_SetTariff_ThenGetTariff_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	_, errSet := db.SetTariff(testTariff)
+	response, errGet := db.GetTariff()
+
+	//	Assert
+	if errSet != nil || errGet != nil {
+		t.Errorf("SetTariff failed: Should have set and gotten the tariff without error: %v / %v", errSet, errGet)
+	}
+
+	if response.BaseRate != testTariff.BaseRate || len(response.Rates) != len(testTariff.Rates) {
+		t.Errorf("SetTariff failed: Expected %+v but got %+v", testTariff, response)
+	}
+}
+
+func TestStats_Summarize_ReturnsTotalsPerDayAndMonth(t *testing.T) {
+	//	Arrange
+	cycles := []data.Cycle{
+		{DeviceID: "washer", StartTime: time.Date(2026, 9, 30, 10, 0, 0, 0, time.UTC), EndTime: time.Date(2026, 9, 30, 11, 0, 0, 0, time.UTC), EnergyWh: 1000},
+		{DeviceID: "washer", StartTime: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), EndTime: time.Date(2026, 10, 1, 10, 30, 0, 0, time.UTC), EnergyWh: 500, Cost: 1},
+		{DeviceID: "washer", StartTime: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), EndTime: time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC), EnergyWh: 2000},
+	}
+
+	//	Act
+	stats := data.Summarize(cycles, testTariff)
+
+	//	Assert
+	if len(stats.Days) != 2 || stats.Days[1].Period != "2026-10-01" || stats.Days[1].Cycles != 2 {
+		t.Errorf("Summarize failed: Got the wrong days: %+v", stats.Days)
+	}
+
+	if len(stats.Months) != 2 || stats.Months[0].Period != "2026-09" {
+		t.Errorf("Summarize failed: Got the wrong months: %+v", stats.Months)
+	}
+
+	//	Cycles that were already costed should keep their cost:
+	expectedTotal := 0.15 + 1 + 0.30
+	if math.Abs(stats.Total.Cost-expectedTotal) > 0.0001 {
+		t.Errorf("Summarize failed: Expected a total cost of %v but got %v", expectedTotal, stats.Total.Cost)
+	}
+
+	if stats.Total.EnergyKWh != 3.5 || stats.Total.RunTime != 150*time.Minute {
+		t.Errorf("Summarize failed: Got the wrong totals: %+v", stats.Total)
+	}
+}
@@ -0,0 +1,397 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The roles a user can have
+const (
+	// RoleViewer can see the current state and history
+	RoleViewer = "viewer"
+
+	// RoleOperator can also change notification subscriptions
+	RoleOperator = "operator"
+
+	// RoleAdmin can do everything, including network, system and config changes
+	RoleAdmin = "admin"
+)
+
+const (
+	// AdminUsername is the built-in account that uses the admin password
+	AdminUsername = "admin"
+
+	// SessionDuration is how long a login session lasts
+	SessionDuration = 14 * 24 * time.Hour
+)
+
+var (
+	// roleScopes is the API scope each role gets
+	roleScopes = map[string]string{RoleViewer: ScopeRead, RoleOperator: ScopeWrite, RoleAdmin: ScopeAdmin}
+
+	// validUsername is what a username can look like
+	validUsername = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+	// dummyPasswordHash is checked for users that don't exist, so they take
+	// as long to turn down as a wrong password, and don't give away which
+	// usernames exist
+	dummyPasswordHash = []byte("$2a$10$5Ew9hA/eUNuE8AHEs7.onuWKQYUkkeTmbsjShofZxmHAd9PaGVqH.")
+)
+
+// User is a member of the household with an account
+type User struct {
+	// Username is the unique name used to log in.  It's always lowercase
+	Username string `json:"username"`
+
+	// Role is what the user is allowed to do (viewer / operator / admin)
+	Role string `json:"role"`
+
+	// PasswordHash is the bcrypt hash of the user's password
+	PasswordHash []byte `json:"passwordhash,omitempty"`
+
+	// LastUpdated indicates when the user was last updated
+	LastUpdated time.Time `json:"updated"`
+}
+
+// Session is a login session for the UI
+type Session struct {
+	// Username is the user that logged in
+	Username string `json:"username"`
+
+	// Expires is when the session ends
+	Expires time.Time `json:"expires"`
+}
+
+// RoleScope gets the API scope for a role.  Unknown roles get no scope
+func RoleScope(role string) string {
+	return roleScopes[role]
+}
+
+// ValidRole returns true if the role is one we know about
+func ValidRole(role string) bool {
+	_, found := roleScopes[role]
+	return found
+}
+
+// GetAllUsers gets all users.  The password hashes aren't included
+func (store *ConfigDB) GetAllUsers() ([]User, error) {
+	//	Our return item
+	retval := []User{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("users"))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			user := User{}
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+
+			user.PasswordHash = nil
+			retval = append(retval, user)
+			return nil
+		})
+	})
+
+	return retval, err
+}
+
+// GetUser gets a single user, without the password hash.  If the user can't
+// be found, returns an empty user
+func (store *ConfigDB) GetUser(username string) (User, error) {
+	retval, err := store.getUser(strings.ToLower(username))
+	retval.PasswordHash = nil
+
+	return retval, err
+}
+
+// AddOrUpdateUser adds a user, or updates an existing one.  If password is
+// blank, an existing user keeps their password.  Otherwise, the user's
+// sessions are ended
+func (store *ConfigDB) AddOrUpdateUser(user User, password string) (User, error) {
+	//	Our return item:
+	retval := user
+	retval.Username = strings.ToLower(strings.TrimSpace(retval.Username))
+	retval.PasswordHash = nil
+
+	if !validUsername.MatchString(retval.Username) {
+		return retval, errors.New("Usernames need to be 1-32 letters, numbers, dots, dashes or underscores")
+	}
+
+	if retval.Username == AdminUsername {
+		return retval, fmt.Errorf("%s is reserved for the admin password", AdminUsername)
+	}
+
+	if !ValidRole(retval.Role) {
+		return retval, fmt.Errorf("Unknown role: %s", retval.Role)
+	}
+
+	var hash []byte
+	if password != "" {
+		if len(password) < MinPasswordLength {
+			return retval, fmt.Errorf("The password needs to be at least %v characters", MinPasswordLength)
+		}
+
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+			return retval, err
+		}
+	}
+
+	err := store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("users"))
+		if err != nil {
+			return err
+		}
+
+		//	Keep the existing password if we didn't get a new one:
+		stored := retval
+		stored.PasswordHash = hash
+		if stored.PasswordHash == nil {
+			existing := User{}
+			if existingBytes := b.Get([]byte(stored.Username)); len(existingBytes) > 0 {
+				if err := json.Unmarshal(existingBytes, &existing); err != nil {
+					return err
+				}
+			}
+
+			if len(existing.PasswordHash) == 0 {
+				return errors.New("New users need a password")
+			}
+			stored.PasswordHash = existing.PasswordHash
+		} else {
+			//	A new password ends the sessions logged in with the old one:
+			if err := removeSessions(tx, func(s Session) bool { return s.Username == stored.Username }); err != nil {
+				return err
+			}
+		}
+
+		//	Set the current datetime:
+		stored.LastUpdated = time.Now()
+		retval.LastUpdated = stored.LastUpdated
+
+		//	Serialize to JSON format
+		encoded, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(stored.Username), encoded)
+	})
+
+	return retval, err
+}
+
+// RemoveUser removes a user, and ends their sessions
+func (store *ConfigDB) RemoveUser(username string) error {
+	username = strings.ToLower(username)
+
+	//	If there is no username, throw an error:
+	if strings.TrimSpace(username) == "" {
+		return errors.New("Username can't be blank")
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("users"))
+		if err != nil {
+			return err
+		}
+
+		if err := b.Delete([]byte(username)); err != nil {
+			return err
+		}
+
+		return removeSessions(tx, func(session Session) bool {
+			return session.Username == username
+		})
+	})
+}
+
+// CheckUserPassword checks a username and password, and returns the user
+// (without the password hash).  The admin password logs in as AdminUsername.
+// Returns ErrInvalidCredentials if they don't check out
+func (store *ConfigDB) CheckUserPassword(username, password string) (User, error) {
+	username = strings.ToLower(username)
+
+	if username == AdminUsername {
+		if err := store.CheckAdminPassword(password); err != nil {
+			return User{}, err
+		}
+
+		return User{Username: AdminUsername, Role: RoleAdmin}, nil
+	}
+
+	user, err := store.getUser(username)
+	if err != nil {
+		return User{}, err
+	}
+
+	hash := user.PasswordHash
+	if len(hash) == 0 {
+		hash = dummyPasswordHash
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || len(user.PasswordHash) == 0 {
+		return User{}, ErrInvalidCredentials
+	}
+
+	user.PasswordHash = nil
+	return user, nil
+}
+
+// CreateSession starts a login session for the user, and returns the value to
+// put in the session cookie.  Expired sessions are cleaned up at the same time
+func (store *ConfigDB) CreateSession(username string) (string, Session, error) {
+	session := Session{Username: strings.ToLower(username), Expires: time.Now().Add(SessionDuration)}
+
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", session, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(secret)
+
+	err := store.update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		if err := removeSessions(tx, func(s Session) bool { return now.After(s.Expires) }); err != nil {
+			return err
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte("sessions"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+
+		//	Only a hash of the cookie value is stored:
+		return b.Put([]byte(hashTokenSecret(value)), encoded)
+	})
+
+	return value, session, err
+}
+
+// CheckSession finds the user for a session cookie value.  Returns
+// ErrInvalidCredentials if the session doesn't exist, has expired, or the
+// user has been removed
+func (store *ConfigDB) CheckSession(value string) (User, error) {
+	session := Session{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		if b == nil {
+			return ErrInvalidCredentials
+		}
+
+		sessionBytes := b.Get([]byte(hashTokenSecret(value)))
+		if len(sessionBytes) == 0 {
+			return ErrInvalidCredentials
+		}
+
+		return json.Unmarshal(sessionBytes, &session)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	if time.Now().After(session.Expires) {
+		return User{}, ErrInvalidCredentials
+	}
+
+	if session.Username == AdminUsername {
+		return User{Username: AdminUsername, Role: RoleAdmin}, nil
+	}
+
+	user, err := store.GetUser(session.Username)
+	if err != nil {
+		return User{}, err
+	}
+
+	if user.Username == "" {
+		return User{}, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// RemoveSession ends a login session
+func (store *ConfigDB) RemoveSession(value string) error {
+	return store.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("sessions"))
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(hashTokenSecret(value)))
+	})
+}
+
+// getUser gets a single user, including the password hash
+func (store *ConfigDB) getUser(username string) (User, error) {
+	//	Our return item
+	retval := User{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("users"))
+		if b == nil {
+			return nil
+		}
+
+		userBytes := b.Get([]byte(username))
+		if len(userBytes) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(userBytes, &retval)
+	})
+
+	return retval, err
+}
+
+// removeSessions removes the sessions that match
+func removeSessions(tx *bolt.Tx, match func(Session) bool) error {
+	b := tx.Bucket([]byte("sessions"))
+	if b == nil {
+		return nil
+	}
+
+	var remove [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		session := Session{}
+		if err := json.Unmarshal(v, &session); err != nil {
+			return err
+		}
+
+		if match(session) {
+			remove = append(remove, append([]byte{}, k...))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range remove {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package data_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+//	A user should be able to log in with their password, and their role should stick
+func TestUsers_AddUser_ThenCheckPassword_Successful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	//	Act
+	_, err = db.AddOrUpdateUser(data.User{Username: "Sam", Role: data.RoleOperator}, "sams password")
+	user, checkErr := db.CheckUserPassword("sam", "sams password")
+	_, wrongErr := db.CheckUserPassword("sam", "not the password")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("AddOrUpdateUser failed: Should have added the user without error: %v", err)
+	}
+
+	if checkErr != nil || user.Username != "sam" || user.Role != data.RoleOperator {
+		t.Errorf("CheckUserPassword failed: Should have found the operator 'sam', but got %+v / %v", user, checkErr)
+	}
+
+	if len(user.PasswordHash) != 0 {
+		t.Errorf("CheckUserPassword failed: Shouldn't have returned the password hash")
+	}
+
+	if wrongErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckUserPassword failed: The wrong password should be invalid, but got %v", wrongErr)
+	}
+}
+
+func TestUsers_AddOrUpdateUser_InvalidUsers_NotSuccessful(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	users := []data.User{
+		{Username: "", Role: data.RoleViewer},
+		{Username: "has spaces", Role: data.RoleViewer},
+		{Username: data.AdminUsername, Role: data.RoleAdmin},
+		{Username: "sam", Role: "bogusrole"},
+	}
+
+	for _, user := range users {
+		//	Act
+		_, err := db.AddOrUpdateUser(user, "long enough password")
+
+		//	Assert
+		if err == nil {
+			t.Errorf("AddOrUpdateUser failed: Should have returned an error for user %+v", user)
+		}
+	}
+
+	//	New users need a password:
+	if _, err := db.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, ""); err == nil {
+		t.Errorf("AddOrUpdateUser failed: Should have returned an error for a new user without a password")
+	}
+}
+
+//	A session should identify the user until they're removed
+func TestUsers_CreateSession_EndsWhenUserRemoved(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, "sams password")
+
+	//	Act
+	value, _, err := db.CreateSession("sam")
+	user, checkErr := db.CheckSession(value)
+	db.RemoveUser("sam")
+	_, removedErr := db.CheckSession(value)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("CreateSession failed: Should have created the session without error: %v", err)
+	}
+
+	if checkErr != nil || user.Username != "sam" || user.Role != data.RoleViewer {
+		t.Errorf("CheckSession failed: Should have found the viewer 'sam', but got %+v / %v", user, checkErr)
+	}
+
+	if removedErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckSession failed: A removed user's session should be invalid, but got %v", removedErr)
+	}
+}
+
+//	Changing a password should end the sessions logged in with the old one
+func TestUsers_CreateSession_EndsWhenPasswordChanged(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, "sams password")
+	db.SetAdminPassword("admin password")
+
+	userValue, _, _ := db.CreateSession("sam")
+	adminValue, _, _ := db.CreateSession(data.AdminUsername)
+
+	//	Act
+	db.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, "")
+	_, keptErr := db.CheckSession(userValue)
+	db.AddOrUpdateUser(data.User{Username: "sam", Role: data.RoleViewer}, "sams new password")
+	_, userErr := db.CheckSession(userValue)
+	db.SetAdminPassword("new admin password")
+	_, adminErr := db.CheckSession(adminValue)
+
+	//	Assert
+	if keptErr != nil {
+		t.Errorf("CheckSession failed: Updating a user without a new password should keep their session, but got %v", keptErr)
+	}
+
+	if userErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckSession failed: A session from before the password changed should be invalid, but got %v", userErr)
+	}
+
+	if adminErr != data.ErrInvalidCredentials {
+		t.Errorf("CheckSession failed: An admin session from before the password changed should be invalid, but got %v", adminErr)
+	}
+}
@@ -0,0 +1,257 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+const (
+	// FormatCSV is comma separated values, one row per activity or cycle
+	FormatCSV = "csv"
+
+	// FormatJSONLines is one JSON object per line, per activity or cycle
+	FormatJSONLines = "jsonl"
+
+	// FormatICS is an iCalendar feed with an event for each cycle
+	FormatICS = "ics"
+)
+
+// The kinds of records in CSV and JSON Lines exports
+const (
+	RecordActivity = "activity"
+	RecordCycle    = "cycle"
+)
+
+// ContentTypes are the content types for each format
+var ContentTypes = map[string]string{
+	FormatCSV:       "text/csv; charset=utf-8",
+	FormatJSONLines: "application/x-ndjson; charset=utf-8",
+	FormatICS:       "text/calendar; charset=utf-8",
+}
+
+// CSVHeader is the header row for CSV exports
+var CSVHeader = []string{"record", "device_id", "device_name", "timestamp", "event", "start_time", "end_time", "energy_wh", "cost"}
+
+// Export is the activity and cycles to export
+type Export struct {
+	Activities []data.Activity
+	Cycles     []data.Cycle
+
+	// DeviceNames are the names of the devices, by id
+	DeviceNames map[string]string
+}
+
+// ActivityRecord is an activity in a JSON Lines export
+type ActivityRecord struct {
+	Record string `json:"record"`
+	data.Activity
+}
+
+// CycleRecord is a cycle in a JSON Lines export
+type CycleRecord struct {
+	Record string `json:"record"`
+	data.Cycle
+}
+
+// Write writes the export in the given format
+func Write(w io.Writer, format string, export Export) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, export)
+	case FormatJSONLines:
+		return WriteJSONLines(w, export)
+	case FormatICS:
+		return WriteICS(w, export)
+	}
+
+	return fmt.Errorf("Unknown export format: %s", format)
+}
+
+// WriteCSV writes activity and cycles as CSV, with a header row
+func WriteCSV(w io.Writer, export Export) error {
+	writer := csv.NewWriter(w)
+	writer.Write(CSVHeader)
+
+	for _, activity := range export.Activities {
+		writer.Write([]string{
+			RecordActivity,
+			activity.DeviceID,
+			export.DeviceNames[activity.DeviceID],
+			formatTime(activity.Timestamp),
+			activity.Type.String(),
+			"", "", "", "",
+		})
+	}
+
+	for _, cycle := range export.Cycles {
+		writer.Write([]string{
+			RecordCycle,
+			cycle.DeviceID,
+			export.DeviceNames[cycle.DeviceID],
+			"", "",
+			formatTime(cycle.StartTime),
+			formatTime(cycle.EndTime),
+			strconv.FormatFloat(cycle.EnergyWh, 'f', -1, 64),
+			strconv.FormatFloat(cycle.Cost, 'f', -1, 64),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSONLines writes activity and cycles as JSON Lines
+func WriteJSONLines(w io.Writer, export Export) error {
+	encoder := json.NewEncoder(w)
+
+	for _, activity := range export.Activities {
+		if err := encoder.Encode(ActivityRecord{Record: RecordActivity, Activity: activity}); err != nil {
+			return err
+		}
+	}
+
+	for _, cycle := range export.Cycles {
+		if err := encoder.Encode(CycleRecord{Record: RecordCycle, Cycle: cycle}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteICS writes an iCalendar feed with an event for each finished cycle
+func WriteICS(w io.Writer, export Export) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//appliance-monitor//Run history//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeText("Appliance run history"),
+	}
+
+	stamp := icsTime(time.Now())
+	for _, cycle := range export.Cycles {
+		if cycle.EndTime.IsZero() {
+			continue
+		}
+
+		name := export.DeviceNames[cycle.DeviceID]
+		if name == "" {
+			name = "Appliance"
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s-%d@appliance-monitor", cycle.DeviceID, cycle.StartTime.UnixNano()),
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+icsTime(cycle.StartTime),
+			"DTEND:"+icsTime(cycle.EndTime),
+			"SUMMARY:"+escapeText(fmt.Sprintf("%s ran", name)),
+			"DESCRIPTION:"+escapeText(cycleDescription(cycle)),
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldLine(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cycleDescription describes how long a cycle ran and what it used
+func cycleDescription(cycle data.Cycle) string {
+	minutes := int(cycle.EndTime.Sub(cycle.StartTime).Minutes())
+	retval := fmt.Sprintf("Ran for about %v minutes.", minutes)
+
+	if cycle.EnergyWh > 0 {
+		retval += fmt.Sprintf("\nUsed %.2f kWh.", cycle.EnergyWh/1000)
+	}
+
+	if cycle.Cost > 0 {
+		retval += fmt.Sprintf("\nCost %.2f.", cycle.Cost)
+	}
+
+	return retval
+}
+
+// formatTime formats a time for CSV exports.  Zero times are blank
+func formatTime(when time.Time) string {
+	if when.IsZero() {
+		return ""
+	}
+
+	return when.UTC().Format(time.RFC3339Nano)
+}
+
+// icsTime formats a time as an iCalendar UTC date-time
+func icsTime(when time.Time) string {
+	return when.UTC().Format("20060102T150405Z")
+}
+
+// escapeText escapes an iCalendar text value
+func escapeText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(value)
+}
+
+// foldLine splits lines longer than 75 octets, as iCalendar requires.  Lines
+// are only split between characters
+func foldLine(line string) string {
+	const maxLength = 75
+
+	retval := strings.Builder{}
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > maxLength {
+			retval.WriteString("\r\n ")
+			length = 1
+		}
+
+		retval.WriteRune(r)
+		length += size
+	}
+
+	return retval.String()
+}
+
+// Load gets the activity and cycles for a device in a time range.  If deviceID
+// is blank, gets them for all devices
+func Load(store *data.Store, deviceID string, start, end time.Time) (Export, error) {
+	retval := Export{DeviceNames: map[string]string{}}
+
+	activities, err := store.Activity.GetRange(deviceID, start, end)
+	if err != nil {
+		return retval, err
+	}
+	retval.Activities = activities
+
+	cycles, err := store.Activity.GetCycles(deviceID, start, end)
+	if err != nil {
+		return retval, err
+	}
+	retval.Cycles = cycles
+
+	devices, err := store.Config.GetAllDevices()
+	if err != nil {
+		return retval, err
+	}
+
+	for _, device := range devices {
+		retval.DeviceNames[device.ID] = device.Name
+	}
+
+	return retval, nil
+}
@@ -0,0 +1,158 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/export"
+)
+
+var testStart = time.Date(2017, 6, 1, 14, 0, 0, 0, time.UTC)
+
+var testExport = export.Export{
+	Activities: []data.Activity{
+		{DeviceID: "washer", Timestamp: testStart, Type: data.ApplianceRunning},
+		{DeviceID: "washer", Timestamp: testStart.Add(45 * time.Minute), Type: data.ApplianceStopped},
+	},
+	Cycles: []data.Cycle{
+		{DeviceID: "washer", StartTime: testStart, EndTime: testStart.Add(45 * time.Minute), EnergyWh: 500, Cost: 0.08},
+	},
+	DeviceNames: map[string]string{"washer": "Washer, downstairs"},
+}
+
+func TestExport_WriteCSV_ReturnsRowForEachRecord(t *testing.T) {
+	//	Arrange
+	output := bytes.Buffer{}
+
+	//	Act
+	err := export.WriteCSV(&output, testExport)
+	rows, parseErr := csv.NewReader(&output).ReadAll()
+
+	//	Assert
+	if err != nil || parseErr != nil {
+		t.Fatalf("WriteCSV failed: Should have written valid CSV without error: %v / %v", err, parseErr)
+	}
+
+	if len(rows) != 4 {
+		t.Fatalf("WriteCSV failed: Should have a header and 3 rows.  Got %v", rows)
+	}
+
+	if rows[1][0] != "activity" || rows[1][4] != "running" || rows[1][2] != "Washer, downstairs" {
+		t.Errorf("WriteCSV failed: Got the wrong activity row: %v", rows[1])
+	}
+
+	if rows[3][0] != "cycle" || rows[3][5] != "2017-06-01T14:00:00Z" || rows[3][7] != "500" {
+		t.Errorf("WriteCSV failed: Got the wrong cycle row: %v", rows[3])
+	}
+}
+
+func TestExport_WriteJSONLines_ReturnsLineForEachRecord(t *testing.T) {
+	//	Arrange
+	output := bytes.Buffer{}
+
+	//	Act
+	err := export.WriteJSONLines(&output, testExport)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("WriteJSONLines failed: Should have written without error: %v", err)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("WriteJSONLines failed: Should have 3 lines.  Got %v", len(lines))
+	}
+
+	cycle := export.CycleRecord{}
+	if err := json.Unmarshal([]byte(lines[2]), &cycle); err != nil || cycle.Record != "cycle" || cycle.EnergyWh != 500 {
+		t.Errorf("WriteJSONLines failed: Got the wrong cycle line: %s", lines[2])
+	}
+}
+
+func TestExport_WriteICS_ReturnsEventForEachCycle(t *testing.T) {
+	//	Arrange
+	output := bytes.Buffer{}
+
+	//	Act
+	err := export.WriteICS(&output, testExport)
+	calendar := output.String()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("WriteICS failed: Should have written without error: %v", err)
+	}
+
+	if strings.Count(calendar, "BEGIN:VEVENT") != 1 {
+		t.Errorf("WriteICS failed: Should have 1 event.  Got %s", calendar)
+	}
+
+	for _, expected := range []string{"DTSTART:20170601T140000Z\r\n", "DTEND:20170601T144500Z\r\n", `SUMMARY:Washer\, downstairs ran`} {
+		if !strings.Contains(calendar, expected) {
+			t.Errorf("WriteICS failed: Should contain %q.  Got %s", expected, calendar)
+		}
+	}
+
+	for _, line := range strings.Split(calendar, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("WriteICS failed: Lines should be folded at 75 octets.  Got %q", line)
+		}
+	}
+}
+
+func TestExport_ReadCSV_ExportedCSV_ReturnsSameRecords(t *testing.T) {
+	//	Arrange
+	output := bytes.Buffer{}
+	export.WriteCSV(&output, testExport)
+
+	//	Act
+	response, err := export.ReadCSV(&output)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("ReadCSV failed: Should have read the export without error: %v", err)
+	}
+
+	if len(response.Activities) != 2 || response.Activities[1].Type != data.ApplianceStopped || !response.Activities[1].Timestamp.Equal(testStart.Add(45*time.Minute)) {
+		t.Errorf("ReadCSV failed: Got the wrong activities: %+v", response.Activities)
+	}
+
+	if len(response.Cycles) != 1 || response.Cycles[0].Cost != 0.08 || !response.Cycles[0].EndTime.Equal(testStart.Add(45*time.Minute)) {
+		t.Errorf("ReadCSV failed: Got the wrong cycles: %+v", response.Cycles)
+	}
+}
+
+func TestExport_ReadJSONLines_ExportedLines_ReturnsSameRecords(t *testing.T) {
+	//	Arrange
+	output := bytes.Buffer{}
+	export.WriteJSONLines(&output, testExport)
+
+	//	Act
+	response, err := export.ReadJSONLines(&output)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("ReadJSONLines failed: Should have read the export without error: %v", err)
+	}
+
+	if len(response.Activities) != 2 || len(response.Cycles) != 1 || response.Cycles[0].EnergyWh != 500 {
+		t.Errorf("ReadJSONLines failed: Got the wrong records: %+v", response)
+	}
+}
+
+func TestExport_ReadCSV_UnknownRecord_ReturnsError(t *testing.T) {
+	//	Arrange
+	input := strings.NewReader("record,device_id\nbogus,washer\n")
+
+	//	Act
+	_, err := export.ReadCSV(input)
+
+	//	Assert
+	if err == nil {
+		t.Errorf("ReadCSV failed: Should have returned an error for the unknown record")
+	}
+}
@@ -0,0 +1,189 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// Read reads activity and cycles in the given format (csv or jsonl)
+func Read(r io.Reader, format string) (Export, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSONLines:
+		return ReadJSONLines(r)
+	}
+
+	return Export{}, fmt.Errorf("Can't import format: %s", format)
+}
+
+// ReadCSV reads activity and cycles from CSV written by WriteCSV.  The
+// header row is required, but the columns can be in any order
+func ReadCSV(r io.Reader) (Export, error) {
+	retval := Export{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return retval, fmt.Errorf("Problem reading the header row: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+
+	for _, required := range []string{"record", "device_id"} {
+		if _, ok := columns[required]; !ok {
+			return retval, fmt.Errorf("The header row is missing the %s column", required)
+		}
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return retval, err
+		}
+
+		//	Get a column, or blank if the row doesn't have it:
+		column := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		switch column("record") {
+		case RecordActivity:
+			activity, err := csvActivity(column)
+			if err != nil {
+				return retval, fmt.Errorf("Line %v: %v", line, err)
+			}
+			retval.Activities = append(retval.Activities, activity)
+		case RecordCycle:
+			cycle, err := csvCycle(column)
+			if err != nil {
+				return retval, fmt.Errorf("Line %v: %v", line, err)
+			}
+			retval.Cycles = append(retval.Cycles, cycle)
+		default:
+			return retval, fmt.Errorf("Line %v: Unknown record type: %s", line, column("record"))
+		}
+	}
+
+	return retval, nil
+}
+
+// ReadJSONLines reads activity and cycles from JSON Lines written by WriteJSONLines
+func ReadJSONLines(r io.Reader) (Export, error) {
+	retval := Export{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		//	Find out what kind of record it is first:
+		record := struct {
+			Record string `json:"record"`
+		}{}
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return retval, fmt.Errorf("Line %v: %v", line, err)
+		}
+
+		switch record.Record {
+		case RecordActivity:
+			activity := ActivityRecord{}
+			if err := json.Unmarshal([]byte(text), &activity); err != nil {
+				return retval, fmt.Errorf("Line %v: %v", line, err)
+			}
+			retval.Activities = append(retval.Activities, activity.Activity)
+		case RecordCycle:
+			cycle := CycleRecord{}
+			if err := json.Unmarshal([]byte(text), &cycle); err != nil {
+				return retval, fmt.Errorf("Line %v: %v", line, err)
+			}
+			retval.Cycles = append(retval.Cycles, cycle.Cycle)
+		default:
+			return retval, fmt.Errorf("Line %v: Unknown record type: %s", line, record.Record)
+		}
+	}
+
+	return retval, scanner.Err()
+}
+
+// csvActivity reads an activity from a CSV row
+func csvActivity(column func(string) string) (data.Activity, error) {
+	retval := data.Activity{DeviceID: column("device_id")}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, column("timestamp"))
+	if err != nil {
+		return retval, fmt.Errorf("Invalid timestamp: %s", column("timestamp"))
+	}
+	retval.Timestamp = timestamp
+
+	//	Event types can be names or numbers:
+	event := column("event")
+	if number, err := strconv.Atoi(event); err == nil {
+		retval.Type = data.EventType(number)
+	} else if retval.Type, err = data.ParseEventType(event); err != nil {
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+// csvCycle reads a cycle from a CSV row
+func csvCycle(column func(string) string) (data.Cycle, error) {
+	retval := data.Cycle{DeviceID: column("device_id")}
+
+	start, err := time.Parse(time.RFC3339Nano, column("start_time"))
+	if err != nil {
+		return retval, fmt.Errorf("Invalid start_time: %s", column("start_time"))
+	}
+	retval.StartTime = start
+
+	if value := column("end_time"); value != "" {
+		end, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return retval, fmt.Errorf("Invalid end_time: %s", value)
+		}
+		retval.EndTime = end
+	}
+
+	if retval.EnergyWh, err = parseNumber(column("energy_wh")); err != nil {
+		return retval, fmt.Errorf("Invalid energy_wh: %s", column("energy_wh"))
+	}
+
+	if retval.Cost, err = parseNumber(column("cost")); err != nil {
+		return retval, fmt.Errorf("Invalid cost: %s", column("cost"))
+	}
+
+	return retval, nil
+}
+
+// parseNumber parses a number.  Blank is zero
+func parseNumber(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,183 @@
+package hs110
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultPort is the port the plug listens on for its local protocol
+	DefaultPort = 9999
+
+	// The first key for the autokey cipher
+	initialKey = byte(171)
+
+	// Plugs only send small responses.  Anything bigger is garbage
+	maxResponseSize = 64 * 1024
+)
+
+// Client talks to a TP-Link HS110 smart plug using its local protocol
+type Client struct {
+	// Address is the host:port of the plug.  If no port is given, DefaultPort is used
+	Address string
+
+	// Timeout is the timeout for the whole request.  Defaults to 5 seconds
+	Timeout time.Duration
+}
+
+// Realtime is a single reading from the plug's energy meter
+type Realtime struct {
+	// Power is the current power draw, in watts
+	Power float64 `json:"power"`
+
+	// Voltage is the current voltage, in volts
+	Voltage float64 `json:"voltage"`
+
+	// Current is the current draw, in amps
+	Current float64 `json:"current"`
+
+	// Total is the total energy used since the meter was reset, in kWh
+	Total float64 `json:"total"`
+}
+
+// realtimeResponse is the response to a get_realtime request.  Hardware version 1
+// plugs report watts/volts/amps/kWh.  Version 2 plugs report milli-units and Wh
+type realtimeResponse struct {
+	Emeter struct {
+		GetRealtime struct {
+			Power     *float64 `json:"power"`
+			Voltage   *float64 `json:"voltage"`
+			Current   *float64 `json:"current"`
+			Total     *float64 `json:"total"`
+			PowerMW   *float64 `json:"power_mw"`
+			VoltageMV *float64 `json:"voltage_mv"`
+			CurrentMA *float64 `json:"current_ma"`
+			TotalWH   *float64 `json:"total_wh"`
+			ErrCode   int      `json:"err_code"`
+			ErrMsg    string   `json:"err_msg"`
+		} `json:"get_realtime"`
+	} `json:"emeter"`
+}
+
+// GetRealtime gets the current reading from the plug's energy meter
+func (c Client) GetRealtime() (Realtime, error) {
+	retval := Realtime{}
+
+	response, err := c.Send([]byte(`{"emeter":{"get_realtime":{}}}`))
+	if err != nil {
+		return retval, err
+	}
+
+	decoded := realtimeResponse{}
+	if err := json.Unmarshal(response, &decoded); err != nil {
+		return retval, fmt.Errorf("Problem decoding plug response: %v", err)
+	}
+
+	realtime := decoded.Emeter.GetRealtime
+	if realtime.ErrCode != 0 {
+		return retval, fmt.Errorf("Plug returned error %v: %s", realtime.ErrCode, realtime.ErrMsg)
+	}
+
+	//	Use whichever units the plug reported:
+	retval.Power = value(realtime.Power, realtime.PowerMW, 1000)
+	retval.Voltage = value(realtime.Voltage, realtime.VoltageMV, 1000)
+	retval.Current = value(realtime.Current, realtime.CurrentMA, 1000)
+	retval.Total = value(realtime.Total, realtime.TotalWH, 1000)
+
+	return retval, nil
+}
+
+// Send sends a raw JSON request to the plug and returns the raw JSON response
+func (c Client) Send(request []byte) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	//	Use the default port if one wasn't given:
+	address := c.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprintf("%d", DefaultPort))
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(Encode(request)); err != nil {
+		return nil, err
+	}
+
+	return ReadMessage(conn)
+}
+
+// Encode encrypts a message and adds the length header, ready to send
+func Encode(message []byte) []byte {
+	retval := make([]byte, 4, 4+len(message))
+	binary.BigEndian.PutUint32(retval, uint32(len(message)))
+	return append(retval, Encrypt(message)...)
+}
+
+// ReadMessage reads a single length-prefixed message and decrypts it
+func ReadMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length > maxResponseSize {
+		return nil, fmt.Errorf("Message is too big: %v bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return Decrypt(body), nil
+}
+
+// Encrypt encrypts a message with the plug's autokey cipher
+func Encrypt(message []byte) []byte {
+	retval := make([]byte, len(message))
+	key := initialKey
+	for i, b := range message {
+		key = key ^ b
+		retval[i] = key
+	}
+
+	return retval
+}
+
+// Decrypt decrypts a message encrypted with the plug's autokey cipher
+func Decrypt(message []byte) []byte {
+	retval := make([]byte, len(message))
+	key := initialKey
+	for i, b := range message {
+		retval[i] = key ^ b
+		key = b
+	}
+
+	return retval
+}
+
+// value gets the reading in the base unit, from whichever field is set
+func value(base, scaled *float64, scale float64) float64 {
+	if base != nil {
+		return *base
+	}
+
+	if scaled != nil {
+		return *scaled / scale
+	}
+
+	return 0
+}
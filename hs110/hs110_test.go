@@ -0,0 +1,130 @@
+package hs110_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/hs110"
+)
+
+//	standInPlug starts a local server that speaks the plug protocol and
+//	answers every request with the given response.  Requests are sent on the returned channel
+func standInPlug(t *testing.T, response string) (string, chan []byte, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't start the stand-in plug: %v", err)
+	}
+
+	requests := make(chan []byte, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			request, err := hs110.ReadMessage(conn)
+			if err == nil {
+				requests <- request
+				conn.Write(hs110.Encode([]byte(response)))
+			}
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().String(), requests, func() { listener.Close() }
+}
+
+//	Encrypt should match the plug's cipher
+func TestHS110_Encrypt_KnownMessage_ReturnsKnownBytes(t *testing.T) {
+	//	Arrange
+	message := []byte(`{"system":{"get_sysinfo":{}}}`)
+	expected := []byte{0xd0, 0xf2, 0x81, 0xf8}
+
+	//	Act
+	retval := hs110.Encrypt(message)
+
+	//	Assert
+	if !bytes.Equal(retval[:4], expected) {
+		t.Errorf("Encrypt failed: Expected the message to start with %x but got %x", expected, retval[:4])
+	}
+}
+
+//	Decrypt should undo Encrypt
+func TestHS110_Decrypt_EncryptedMessage_ReturnsOriginal(t *testing.T) {
+	//	Arrange
+	message := []byte(`{"emeter":{"get_realtime":{}}}`)
+
+	//	Act
+	retval := hs110.Decrypt(hs110.Encrypt(message))
+
+	//	Assert
+	if !bytes.Equal(retval, message) {
+		t.Errorf("Decrypt failed: Expected %s but got %s", message, retval)
+	}
+}
+
+//	Version 1 plugs report watts, volts, amps and kWh
+func TestHS110_GetRealtime_Version1Plug_ReturnsReading(t *testing.T) {
+	//	Arrange
+	address, requests, stop := standInPlug(t, `{"emeter":{"get_realtime":{"current":0.5,"voltage":120.2,"power":60.1,"total":1.25,"err_code":0}}}`)
+	defer stop()
+
+	client := hs110.Client{Address: address}
+
+	//	Act
+	retval, err := client.GetRealtime()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetRealtime failed: Should have gotten a reading without error: %v", err)
+	}
+
+	if request := <-requests; string(request) != `{"emeter":{"get_realtime":{}}}` {
+		t.Errorf("GetRealtime failed: Sent the wrong request: %s", request)
+	}
+
+	if retval.Power != 60.1 || retval.Voltage != 120.2 || retval.Current != 0.5 || retval.Total != 1.25 {
+		t.Errorf("GetRealtime failed: Got the wrong reading: %+v", retval)
+	}
+}
+
+//	Version 2 plugs report milliwatts, millivolts, milliamps and Wh
+func TestHS110_GetRealtime_Version2Plug_ReturnsReadingInBaseUnits(t *testing.T) {
+	//	Arrange
+	address, _, stop := standInPlug(t, `{"emeter":{"get_realtime":{"current_ma":500,"voltage_mv":120200,"power_mw":60100,"total_wh":1250,"err_code":0}}}`)
+	defer stop()
+
+	client := hs110.Client{Address: address}
+
+	//	Act
+	retval, err := client.GetRealtime()
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("GetRealtime failed: Should have gotten a reading without error: %v", err)
+	}
+
+	if retval.Power != 60.1 || retval.Voltage != 120.2 || retval.Current != 0.5 || retval.Total != 1.25 {
+		t.Errorf("GetRealtime failed: Got the wrong reading: %+v", retval)
+	}
+}
+
+//	Plug errors should be returned
+func TestHS110_GetRealtime_PlugError_ReturnsError(t *testing.T) {
+	//	Arrange
+	address, _, stop := standInPlug(t, `{"emeter":{"get_realtime":{"err_code":-1,"err_msg":"module not support"}}}`)
+	defer stop()
+
+	client := hs110.Client{Address: address}
+
+	//	Act
+	_, err := client.GetRealtime()
+
+	//	Assert
+	if err == nil {
+		t.Errorf("GetRealtime failed: Should have returned the plug error")
+	}
+}
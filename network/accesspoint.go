@@ -0,0 +1,212 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+	"unicode"
+)
+
+// The access point network used for provisioning
+const (
+	AccessPointInterface = WifiInterface
+	AccessPointAddress   = "192.168.4.1"
+)
+
+var hostapdConfig = []byte(`interface={{.Interface}}
+driver=nl80211
+ssid={{.SSID}}
+country_code={{.Country}}
+hw_mode=g
+channel={{.Channel}}
+auth_algs=1
+wmm_enabled=0
+ignore_broadcast_ssid=0
+`)
+
+var dnsmasqConfig = []byte(`interface={{.Interface}}
+except-interface=lo
+bind-interfaces
+dhcp-range={{.DHCPStart}},{{.DHCPEnd}},255.255.255.0,1h
+address=/#/{{.Address}}
+`)
+
+// AccessPointFiles are the config files written for the access point
+type AccessPointFiles struct {
+	// Hostapd is the hostapd config
+	Hostapd string
+
+	// Dnsmasq is the config for the dnsmasq started just for provisioning.
+	// It shouldn't be somewhere the system dnsmasq reads, or every DNS lookup
+	// keeps getting the monitor's address after provisioning is over
+	Dnsmasq string
+}
+
+// DefaultAccessPointFiles are the access point config files on the Pi.  The
+// dnsmasq config is in /run, so it's gone after a reboot
+var DefaultAccessPointFiles = AccessPointFiles{
+	Hostapd: "/etc/hostapd/hostapd.conf",
+	Dnsmasq: "/run/appliance-monitor/dnsmasq.conf",
+}
+
+// Matches two letter country codes, like US
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Matches a network block in a wpa_supplicant config
+var supplicantNetwork = regexp.MustCompile(`(?m)^\s*network\s*=\s*\{`)
+
+// AccessPointInfo describes the open wifi network the monitor broadcasts
+// while it's being set up
+type AccessPointInfo struct {
+	Interface string
+	SSID      string
+	Country   string
+	Channel   int
+
+	// Address is the monitor's address on the network.  DNS lookups for
+	// any name get this address, so browsers end up at the setup UI
+	Address string
+
+	// DHCPStart and DHCPEnd are the addresses handed out to clients
+	DHCPStart string
+	DHCPEnd   string
+}
+
+// DefaultAccessPoint gets the access point used for provisioning.  The
+// network is named after the host name, like am-a1b2c3, and uses the same
+// country as the wifi config
+func DefaultAccessPoint() AccessPointInfo {
+	return AccessPointInfo{
+		Interface: AccessPointInterface,
+		SSID:      DefaultHostname(),
+		Country:   wifiCountry(),
+		Channel:   6,
+		Address:   AccessPointAddress,
+		DHCPStart: "192.168.4.10",
+		DHCPEnd:   "192.168.4.100",
+	}
+}
+
+// wifiCountry gets the country from the wifi config, or the default country
+// if it can't be read
+func wifiCountry() string {
+	config, err := GetWifiConfig()
+	if err != nil {
+		log.Printf("[WARN] Couldn't read the wifi country, so using %s: %v\n", DefaultWifiCountry, err)
+		return DefaultWifiCountry
+	}
+
+	return config.withDefaults().Country
+}
+
+// Validate checks that the access point can be written to the config files
+func (info AccessPointInfo) Validate() error {
+	if info.Interface == "" {
+		return fmt.Errorf("The access point needs an interface")
+	}
+
+	if len(info.SSID) == 0 || len(info.SSID) > 32 {
+		return fmt.Errorf("The access point SSID has to be 1 to 32 characters: %q", info.SSID)
+	}
+
+	for _, r := range info.SSID + info.Interface {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return fmt.Errorf("The access point SSID and interface can only have printable ASCII characters: %q", info.SSID)
+		}
+	}
+
+	if !countryCode.MatchString(info.Country) {
+		return fmt.Errorf("Invalid country code: %v", info.Country)
+	}
+
+	if info.Channel < 1 || info.Channel > 14 {
+		return fmt.Errorf("Invalid channel: %v", info.Channel)
+	}
+
+	for _, address := range []string{info.Address, info.DHCPStart, info.DHCPEnd} {
+		if ip := net.ParseIP(address); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("Invalid IPv4 address: %v", address)
+		}
+	}
+
+	return nil
+}
+
+// FormatHostapdConfig formats the access point as a hostapd config file
+func FormatHostapdConfig(info AccessPointInfo) (string, error) {
+	return formatAccessPoint("hostapd", hostapdConfig, info)
+}
+
+// FormatDnsmasqConfig formats the access point as a dnsmasq config file.  It
+// hands out addresses and answers every DNS lookup with the monitor's address
+func FormatDnsmasqConfig(info AccessPointInfo) (string, error) {
+	return formatAccessPoint("dnsmasq", dnsmasqConfig, info)
+}
+
+// WifiConfigured returns true if a wpa_supplicant config has any networks
+func WifiConfigured(supplicant []byte) bool {
+	return supplicantNetwork.Match(supplicant)
+}
+
+// formatAccessPoint checks the access point and formats it with a template
+func formatAccessPoint(name string, config []byte, info AccessPointInfo) (string, error) {
+	if err := info.Validate(); err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(name).Parse(string(config))
+	if err != nil {
+		return "", err
+	}
+
+	var tpl bytes.Buffer
+	err = tmpl.Execute(&tpl, info)
+	if err != nil {
+		return "", err
+	}
+
+	return tpl.String(), nil
+}
+
+// Write formats the access point and writes the config files
+func (files AccessPointFiles) Write(info AccessPointInfo) error {
+	hostapd, err := FormatHostapdConfig(info)
+	if err != nil {
+		return err
+	}
+
+	dnsmasq, err := FormatDnsmasqConfig(info)
+	if err != nil {
+		return err
+	}
+
+	for path, contents := range map[string]string{files.Hostapd: hostapd, files.Dnsmasq: dnsmasq} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			return fmt.Errorf("Problem writing %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Clear removes the config files, so nothing from provisioning mode is left
+// once the monitor is back on the wifi
+func (files AccessPointFiles) Clear() error {
+	for _, path := range []string{files.Hostapd, files.Dnsmasq} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package network_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/network"
+)
+
+// testAccessPoint is an access point with a known SSID
+func testAccessPoint() network.AccessPointInfo {
+	info := network.DefaultAccessPoint()
+	info.SSID = "am-a1b2c3"
+	return info
+}
+
+//	The formatting utility should format the hostapd config file
+func TestFormatHostapdConfig_WithValidParams_ShouldReturnProperFormat(t *testing.T) {
+
+	//	Arrange
+	expectedconfig := `interface=wlan0
+driver=nl80211
+ssid=am-a1b2c3
+country_code=US
+hw_mode=g
+channel=6
+auth_algs=1
+wmm_enabled=0
+ignore_broadcast_ssid=0
+`
+
+	//	Act
+	retval, err := network.FormatHostapdConfig(testAccessPoint())
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the hostapd config: %v", err)
+	}
+
+	if retval != expectedconfig {
+		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
+	}
+}
+
+//	The formatting utility should format the dnsmasq config file
+func TestFormatDnsmasqConfig_WithValidParams_ShouldReturnProperFormat(t *testing.T) {
+
+	//	Arrange
+	expectedconfig := `interface=wlan0
+except-interface=lo
+bind-interfaces
+dhcp-range=192.168.4.10,192.168.4.100,255.255.255.0,1h
+address=/#/192.168.4.1
+`
+
+	//	Act
+	retval, err := network.FormatDnsmasqConfig(testAccessPoint())
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the dnsmasq config: %v", err)
+	}
+
+	if retval != expectedconfig {
+		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
+	}
+}
+
+//	Access points that would break the config files shouldn't be formatted
+func TestFormatHostapdConfig_WithInvalidParams_ShouldReturnError(t *testing.T) {
+
+	//	Arrange
+	newline := testAccessPoint()
+	newline.SSID = "am-a1b2c3\nwpa=2"
+
+	tooLong := testAccessPoint()
+	tooLong.SSID = "am-a1b2c3-with-a-very-long-network-name"
+
+	badCountry := testAccessPoint()
+	badCountry.Country = "usa"
+
+	badAddress := testAccessPoint()
+	badAddress.Address = "192.168.4"
+
+	//	Act
+	for _, info := range []network.AccessPointInfo{newline, tooLong, badCountry, badAddress} {
+		_, err := network.FormatHostapdConfig(info)
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Should have rejected the access point: %+v", info)
+		}
+	}
+}
+
+//	Supplicant configs without network blocks don't have wifi set up
+func TestWifiConfigured_ShouldFindNetworks(t *testing.T) {
+
+	//	Arrange
+	configured, _ := network.FormatWifiCredentials("testssid", "testpassphrase")
+
+	//	Act
+	withNetwork := network.WifiConfigured([]byte(configured))
+	withoutNetwork := network.WifiConfigured(network.DefaultWifiSupplicant)
+
+	//	Assert
+	if !withNetwork {
+		t.Errorf("Should have found the network in:\n%v", configured)
+	}
+
+	if withoutNetwork {
+		t.Errorf("Shouldn't have found a network in the default config")
+	}
+}
+
+//	Once the monitor is back on the wifi, the access point config files should be gone
+func TestAccessPointFiles_Clear_ShouldRemoveFiles(t *testing.T) {
+
+	//	Arrange
+	dir, _ := ioutil.TempDir("", "accesspoint")
+	defer os.RemoveAll(dir)
+
+	files := network.AccessPointFiles{
+		Hostapd: filepath.Join(dir, "hostapd", "hostapd.conf"),
+		Dnsmasq: filepath.Join(dir, "run", "dnsmasq.conf"),
+	}
+
+	//	Act
+	writeErr := files.Write(testAccessPoint())
+	written, _ := ioutil.ReadFile(files.Dnsmasq)
+	clearErr := files.Clear()
+	againErr := files.Clear()
+
+	//	Assert
+	if writeErr != nil || clearErr != nil || againErr != nil {
+		t.Fatalf("Should have written and cleared the files without errors: %v / %v / %v", writeErr, clearErr, againErr)
+	}
+
+	if len(written) == 0 {
+		t.Errorf("Should have written the dnsmasq config")
+	}
+
+	for _, path := range []string{files.Hostapd, files.Dnsmasq} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Should have removed %s", path)
+		}
+	}
+}
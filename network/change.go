@@ -0,0 +1,365 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The kinds of network change
+const (
+	ChangeWifi    = "wifi"
+	ChangeNetwork = "network"
+)
+
+// The outcomes of a network change
+const (
+	ChangePending    = "pending"
+	ChangeApplied    = "applied"
+	ChangeRolledBack = "rolledback"
+	ChangeFailed     = "failed"
+)
+
+// How long the monitor has to get back on the network after a change
+var changeVerifyTimeout = 2 * time.Minute
+
+// How often the network is checked while a change is verified
+var changeCheckInterval = 5 * time.Second
+
+// ErrChangePending is returned when a network change is made before the last
+// one has been verified
+var ErrChangePending = errors.New("The last network change hasn't been verified yet")
+
+// NetworkChange describes the last network change and how it went
+type NetworkChange struct {
+	// Kind is what was changed (wifi / network)
+	Kind string `json:"kind"`
+
+	// Status is pending until the change is verified after the reboot, then
+	// applied / rolledback / failed
+	Status string `json:"status"`
+
+	// Requested is when the change was made
+	Requested time.Time `json:"requested"`
+
+	// Finished is when the change was verified or rolled back
+	Finished time.Time `json:"finished"`
+
+	// Message explains why the change was rolled back or failed
+	Message string `json:"message,omitempty"`
+
+	// Files are the config files the change replaced
+	Files []string `json:"files"`
+
+	// BootID identifies the boot the change was made in, so it's only
+	// verified after the reboot
+	BootID string `json:"bootid,omitempty"`
+}
+
+// ChangeJournal records a network change and keeps the config files it
+// replaces, so the change can be rolled back
+type ChangeJournal struct {
+	// Path is the file the last change is recorded in
+	Path string
+
+	// BootIDPath is the file with the id of the current boot
+	BootIDPath string
+}
+
+// DefaultChangeJournal is the journal for the network config files
+var DefaultChangeJournal = ChangeJournal{
+	Path:       "/var/lib/appliance-monitor/networkchange.json",
+	BootIDPath: "/proc/sys/kernel/random/boot_id",
+}
+
+// backupPath gets the file the previous version of a config file is kept in
+func backupPath(path string) string {
+	return path + ".previous"
+}
+
+// Last gets the last change.  If nothing has been changed, the kind is blank
+func (j ChangeJournal) Last() (NetworkChange, error) {
+	retval := NetworkChange{}
+
+	contents, err := ioutil.ReadFile(j.Path)
+	if os.IsNotExist(err) {
+		return retval, nil
+	}
+	if err != nil {
+		return retval, err
+	}
+
+	err = json.Unmarshal(contents, &retval)
+	return retval, err
+}
+
+// Stage backs up the config files, records the change as pending and then
+// writes the new files.  Files without contents are removed.  The caller
+// reboots, and VerifyNetworkChange decides whether the change stays
+func (j ChangeJournal) Stage(kind string, files map[string][]byte) error {
+	last, err := j.Last()
+	if err != nil {
+		return err
+	}
+
+	if last.Status == ChangePending {
+		return ErrChangePending
+	}
+
+	change := NetworkChange{Kind: kind, Status: ChangePending, Requested: time.Now(), BootID: j.bootID()}
+	for path := range files {
+		change.Files = append(change.Files, path)
+	}
+
+	//	Keep the files as they are, with their permissions, so a rollback
+	//	puts back the same file.  Files that don't exist yet get removed by
+	//	a rollback, so leftover backups need to go:
+	for _, path := range change.Files {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			err = os.Remove(backupPath(path))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if err := backupConfigFile(path, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := j.save(change); err != nil {
+		return err
+	}
+
+	for path, contents := range files {
+		if err := writeConfigFile(path, contents); err != nil {
+			log.Printf("[ERROR] Problem writing %s: %v", path, err.Error())
+			if rollbackErr := j.Rollback("the new config couldn't be written: " + err.Error()); rollbackErr != nil {
+				log.Printf("[ERROR] Problem rolling back the network change: %v", rollbackErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebooted returns true if the change was made before the last reboot.  If
+// the boot id isn't known, it's assumed the monitor has rebooted
+func (j ChangeJournal) Rebooted(change NetworkChange) bool {
+	current := j.bootID()
+	return change.BootID == "" || current == "" || change.BootID != current
+}
+
+// bootID gets the id of the current boot, or blank if it can't be read
+func (j ChangeJournal) bootID() string {
+	if j.BootIDPath == "" {
+		return ""
+	}
+
+	contents, err := ioutil.ReadFile(j.BootIDPath)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(contents))
+}
+
+// Commit records a pending change as applied and removes the backups
+func (j ChangeJournal) Commit() error {
+	change, err := j.Last()
+	if err != nil || change.Status != ChangePending {
+		return err
+	}
+
+	for _, path := range change.Files {
+		if err := os.Remove(backupPath(path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	change.Status = ChangeApplied
+	change.Finished = time.Now()
+	return j.save(change)
+}
+
+// Rollback puts back the files a pending change replaced and records why.  If
+// the files can't be put back, the change is recorded as failed
+func (j ChangeJournal) Rollback(reason string) error {
+	change, err := j.Last()
+	if err != nil || change.Status != ChangePending {
+		return err
+	}
+
+	change.Status = ChangeRolledBack
+	change.Finished = time.Now()
+	change.Message = reason
+
+	for _, path := range change.Files {
+		err = os.Rename(backupPath(path), path)
+		if os.IsNotExist(err) {
+			err = os.Remove(path)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			change.Status = ChangeFailed
+			change.Message = reason + ".  Rolling back failed: " + err.Error()
+			break
+		}
+	}
+
+	if saveErr := j.save(change); saveErr != nil {
+		return saveErr
+	}
+
+	if change.Status == ChangeFailed {
+		return err
+	}
+
+	return nil
+}
+
+// Discard forgets a pending change without putting anything back.  It's used
+// when the config files are reset
+func (j ChangeJournal) Discard() error {
+	change, err := j.Last()
+	if err != nil || change.Status != ChangePending {
+		return err
+	}
+
+	for _, path := range change.Files {
+		if err := os.Remove(backupPath(path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Remove(j.Path)
+}
+
+// backupConfigFile copies a config file to its backup, with the same permissions
+func backupConfigFile(path string, mode os.FileMode) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	backup := backupPath(path)
+	if err := ioutil.WriteFile(backup, contents, mode); err != nil {
+		return err
+	}
+
+	//	An old backup keeps its permissions when it's written over:
+	return os.Chmod(backup, mode)
+}
+
+// writeConfigFile writes a config file, keeping its permissions.  New files
+// can be read by everyone, like the services that use them, except the wifi
+// config, which has the passphrases.  If there aren't any contents, the file
+// is removed
+func writeConfigFile(path string, contents []byte) error {
+	if contents == nil {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if path == wifiSupplicantPath {
+		mode = 0600
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := ioutil.WriteFile(path, contents, mode); err != nil {
+		return err
+	}
+
+	//	New files are created with the umask taken off:
+	return os.Chmod(path, mode)
+}
+
+// save records the change
+func (j ChangeJournal) save(change NetworkChange) error {
+	contents, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(j.Path, contents, 0600)
+}
+
+// LastNetworkChange gets the last network change and how it went
+func LastNetworkChange() (NetworkChange, error) {
+	return DefaultChangeJournal.Last()
+}
+
+// VerifyNetworkChange checks a pending network change once the monitor has
+// rebooted.  If the monitor isn't back on the network before the timeout, the
+// previous config files are put back and the monitor reboots again.  If the
+// service restarts before the reboot, the change is left for after the reboot
+func VerifyNetworkChange(ctx context.Context, reboot chan bool) {
+	change, err := DefaultChangeJournal.Last()
+	if err != nil {
+		log.Printf("[ERROR] Problem reading the last network change: %v", err)
+		return
+	}
+
+	if change.Status != ChangePending {
+		return
+	}
+
+	if !DefaultChangeJournal.Rebooted(change) {
+		log.Printf("[INFO] The %s change will be verified after the reboot", change.Kind)
+		return
+	}
+
+	log.Printf("[INFO] Verifying the %s change...", change.Kind)
+	deadline := time.Now().Add(changeVerifyTimeout)
+
+	for {
+		err = checkConnectivity(change.Kind)
+		if err == nil {
+			log.Printf("[INFO] The %s change is working", change.Kind)
+			if err := DefaultChangeJournal.Commit(); err != nil {
+				log.Printf("[ERROR] Problem recording the network change: %v", err)
+			}
+			return
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changeCheckInterval):
+		}
+	}
+
+	log.Printf("[WARN] Rolling back the %s change because %v", change.Kind, err)
+	if err := DefaultChangeJournal.Rollback(err.Error()); err != nil {
+		log.Printf("[ERROR] Problem rolling back the network change: %v", err)
+		return
+	}
+
+	log.Println("[INFO] Requesting a reboot because the network change was rolled back")
+	reboot <- true
+}
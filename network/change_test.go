@@ -0,0 +1,215 @@
+package network_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/network"
+)
+
+//	A rolled back change should put back the old files and remove new ones
+func TestChangeJournal_Rollback_ShouldRestoreFiles(t *testing.T) {
+
+	//	Arrange
+	dir, _ := ioutil.TempDir("", "networkchange")
+	defer os.RemoveAll(dir)
+
+	journal := network.ChangeJournal{Path: filepath.Join(dir, "change.json")}
+	existing := filepath.Join(dir, "wpa_supplicant.conf")
+	added := filepath.Join(dir, "added.conf")
+	ioutil.WriteFile(existing, []byte("old"), 0600)
+
+	//	Act
+	stageErr := journal.Stage(network.ChangeWifi, map[string][]byte{existing: []byte("new"), added: []byte("new")})
+	staged, _ := ioutil.ReadFile(existing)
+	againErr := journal.Stage(network.ChangeWifi, map[string][]byte{existing: []byte("newer")})
+	rollbackErr := journal.Rollback("the wifi didn't connect")
+	restored, _ := ioutil.ReadFile(existing)
+	_, addedErr := os.Stat(added)
+	change, _ := journal.Last()
+
+	//	Assert
+	if stageErr != nil || rollbackErr != nil {
+		t.Errorf("Should have staged and rolled back without errors: %v / %v", stageErr, rollbackErr)
+	}
+
+	if string(staged) != "new" {
+		t.Errorf("Should have written the new file.  Got %s", staged)
+	}
+
+	if againErr != network.ErrChangePending {
+		t.Errorf("Shouldn't allow a change while one is pending.  Got %v", againErr)
+	}
+
+	if string(restored) != "old" {
+		t.Errorf("Should have put back the old file.  Got %s", restored)
+	}
+
+	if !os.IsNotExist(addedErr) {
+		t.Errorf("Should have removed the file that didn't exist before")
+	}
+
+	if change.Status != network.ChangeRolledBack || change.Message != "the wifi didn't connect" {
+		t.Errorf("Should have recorded the rollback.  Got %+v", change)
+	}
+}
+
+//	New files should be readable by the services that use them, and rolled back files should keep their permissions
+func TestChangeJournal_Rollback_ShouldKeepPermissions(t *testing.T) {
+
+	//	Arrange
+	dir, _ := ioutil.TempDir("", "networkchange")
+	defer os.RemoveAll(dir)
+
+	journal := network.ChangeJournal{Path: filepath.Join(dir, "change.json")}
+	existing := filepath.Join(dir, "dhcpcd.conf")
+	added := filepath.Join(dir, "10-appliance-monitor-eth0.network")
+	ioutil.WriteFile(existing, []byte("old"), 0644)
+	os.Chmod(existing, 0644)
+	ioutil.WriteFile(existing+".previous", []byte("older"), 0600)
+
+	//	Act
+	stageErr := journal.Stage(network.ChangeNetwork, map[string][]byte{existing: []byte("new"), added: []byte("new")})
+	addedInfo, _ := os.Stat(added)
+	rollbackErr := journal.Rollback("the gateway couldn't be reached")
+	existingInfo, _ := os.Stat(existing)
+
+	//	Assert
+	if stageErr != nil || rollbackErr != nil {
+		t.Fatalf("Should have staged and rolled back without errors: %v / %v", stageErr, rollbackErr)
+	}
+
+	if addedInfo == nil || addedInfo.Mode().Perm() != 0644 {
+		t.Errorf("New files should be readable by everyone.  Got %v", addedInfo)
+	}
+
+	if existingInfo == nil || existingInfo.Mode().Perm() != 0644 {
+		t.Errorf("The rolled back file should keep its permissions.  Got %v", existingInfo)
+	}
+}
+
+//	A committed change should keep the new files and allow another change
+func TestChangeJournal_Commit_ShouldKeepFiles(t *testing.T) {
+
+	//	Arrange
+	dir, _ := ioutil.TempDir("", "networkchange")
+	defer os.RemoveAll(dir)
+
+	journal := network.ChangeJournal{Path: filepath.Join(dir, "change.json")}
+	existing := filepath.Join(dir, "wpa_supplicant.conf")
+	ioutil.WriteFile(existing, []byte("old"), 0600)
+	journal.Stage(network.ChangeWifi, map[string][]byte{existing: []byte("new")})
+
+	//	Act
+	commitErr := journal.Commit()
+	rollbackErr := journal.Rollback("too late")
+	contents, _ := ioutil.ReadFile(existing)
+	_, backupErr := os.Stat(existing + ".previous")
+	change, _ := journal.Last()
+	againErr := journal.Stage(network.ChangeWifi, map[string][]byte{existing: []byte("newer")})
+
+	//	Assert
+	if commitErr != nil || rollbackErr != nil {
+		t.Errorf("Should have committed without errors: %v / %v", commitErr, rollbackErr)
+	}
+
+	if string(contents) != "new" {
+		t.Errorf("Should have kept the new file.  Got %s", contents)
+	}
+
+	if !os.IsNotExist(backupErr) {
+		t.Errorf("Should have removed the backup")
+	}
+
+	if change.Status != network.ChangeApplied {
+		t.Errorf("Should have recorded the change as applied.  Got %+v", change)
+	}
+
+	if againErr != nil {
+		t.Errorf("Should allow another change.  Got %v", againErr)
+	}
+}
+
+//	A change should only be verified once the boot it was made in is over
+func TestChangeJournal_Rebooted_ShouldCompareBootIDs(t *testing.T) {
+
+	//	Arrange
+	dir, _ := ioutil.TempDir("", "networkchange")
+	defer os.RemoveAll(dir)
+
+	bootID := filepath.Join(dir, "boot_id")
+	ioutil.WriteFile(bootID, []byte("first-boot\n"), 0644)
+
+	journal := network.ChangeJournal{Path: filepath.Join(dir, "change.json"), BootIDPath: bootID}
+	existing := filepath.Join(dir, "wpa_supplicant.conf")
+	ioutil.WriteFile(existing, []byte("old"), 0600)
+	journal.Stage(network.ChangeWifi, map[string][]byte{existing: []byte("new")})
+	change, _ := journal.Last()
+
+	//	Act
+	restarted := journal.Rebooted(change)
+	ioutil.WriteFile(bootID, []byte("second-boot\n"), 0644)
+	rebooted := journal.Rebooted(change)
+
+	//	Assert
+	if change.BootID != "first-boot" {
+		t.Errorf("Should have recorded the boot id.  Got %+v", change)
+	}
+
+	if restarted {
+		t.Errorf("A restart in the same boot shouldn't count as a reboot")
+	}
+
+	if !rebooted {
+		t.Errorf("A new boot id should count as a reboot")
+	}
+}
+
+//	Default gateways should be read from the kernel routing table
+func TestParseDefaultGateways_ShouldReturnGateways(t *testing.T) {
+
+	//	Arrange
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	0101A8C0	0003	0	0	303	00000000	0	0	0
+wlan0	0001A8C0	00000000	0001	0	0	303	00FFFFFF	0	0	0
+eth0	00000000	FE00000A	0003	0	0	202	00000000	0	0	0
+`
+
+	//	Act
+	retval := network.ParseDefaultGateways(table)
+
+	//	Assert
+	if len(retval) != 2 || retval["wlan0"].String() != "192.168.1.1" || retval["eth0"].String() != "10.0.0.254" {
+		t.Errorf("Gateways don't match what we expect.  Got %v", retval)
+	}
+}
+
+//	Without a gateway, an address other hosts can reach should mean the network is up
+func TestHasUsableAddress_ShouldSkipLoopbackAndLinkLocal(t *testing.T) {
+
+	//	Arrange
+	cidr := func(value string) net.Addr {
+		ip, ipnet, _ := net.ParseCIDR(value)
+		ipnet.IP = ip
+		return ipnet
+	}
+
+	unusable := []net.Addr{cidr("127.0.0.1/8"), cidr("169.254.10.20/16"), cidr("fe80::1/64")}
+	static := append(unusable, cidr("192.168.1.20/24"))
+
+	//	Act
+	unusableRetval := network.HasUsableAddress(unusable)
+	staticRetval := network.HasUsableAddress(static)
+
+	//	Assert
+	if unusableRetval {
+		t.Errorf("Loopback and link-local addresses shouldn't count")
+	}
+
+	if !staticRetval {
+		t.Errorf("A static address without a gateway should count")
+	}
+}
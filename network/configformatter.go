@@ -1,40 +1,446 @@
 package network
 
 import (
-	"bytes"
-	"html/template"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The security types a configured wifi network can use
+const (
+	WifiOpen = "open"
+	WifiWPA2 = "wpa2"
+	WifiWPA3 = "wpa3"
+
+	// WifiOther is a network set up in the config file in a way the API
+	// doesn't support, like WPA-Enterprise.  It's kept as it is
+	WifiOther = "other"
 )
 
-var wifiSupplicant = []byte(`country=US
-	
-network={
-	ssid="{{.SSID}}"
-	psk="{{.Passphrase}}"
-	key_mgmt=WPA-PSK
+// DefaultWifiCountry is the country used when one isn't set
+const DefaultWifiCountry = "US"
+
+// The first lines of every wpa_supplicant config.  The control interface is
+// what wpa_cli talks to
+const supplicantHeader = `ctrl_interface=DIR=/var/run/wpa_supplicant GROUP=netdev
+update_config=1
+`
+
+// WifiConfig is the wifi client setup: the country the radio is in and the
+// networks to join
+type WifiConfig struct {
+	// Country is the two letter country code, like US
+	Country string `json:"country"`
+
+	// Networks are the networks to join.  If more than one is in range, the
+	// one with the highest priority is used
+	Networks []WifiNetworkConfig `json:"networks"`
 }
 
-`)
+// WifiNetworkConfig is a wifi network to join
+type WifiNetworkConfig struct {
+	SSID string `json:"ssid"`
 
-// WifiInfo describes the information needed to configure the wifi client
-type WifiInfo struct {
-	SSID       string
-	Passphrase string
+	// Passphrase is the network password.  Open networks don't have one
+	Passphrase string `json:"passphrase"`
+
+	// Security is the security type (open / wpa2 / wpa3 / other).  If it's
+	// blank, networks with a passphrase use wpa2 and networks without one are
+	// open.  Networks of the other type can only be kept or removed
+	Security string `json:"security"`
+
+	// Hidden indicates the network doesn't broadcast its SSID
+	Hidden bool `json:"hidden"`
+
+	// Priority is the preference for the network.  Higher is preferred
+	Priority int `json:"priority"`
+
+	// pmk is the WPA2 key from the config file, for passphrases that can't
+	// be written as plain text
+	pmk string
+
+	// block is the network block from the config file, for networks of the
+	// other type
+	block string
 }
 
 // FormatWifiCredentials formats the given credentials as a new wifi supplicant config file
 func FormatWifiCredentials(ssid, password string) (string, error) {
+	return FormatWifiConfig(WifiConfig{
+		Networks: []WifiNetworkConfig{{SSID: ssid, Passphrase: password}},
+	})
+}
 
-	credentials := WifiInfo{ssid, password}
-	tmpl, err := template.New("wifisupp").Parse(string(wifiSupplicant))
-	if err != nil {
+// FormatWifiConfig formats the wifi setup as a wpa_supplicant config file.
+// Text that wpa_supplicant can't read in quotes is written as hex
+func FormatWifiConfig(config WifiConfig) (string, error) {
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
 		return "", err
 	}
 
-	var tpl bytes.Buffer
-	err = tmpl.Execute(&tpl, credentials)
+	var retval strings.Builder
+	retval.WriteString(supplicantHeader)
+	fmt.Fprintf(&retval, "country=%s\n", config.Country)
+
+	for _, network := range config.Networks {
+		retval.WriteString("\nnetwork={\n")
+		if network.Security == WifiOther {
+			retval.WriteString(network.block)
+			retval.WriteString("}\n")
+			continue
+		}
+
+		fmt.Fprintf(&retval, "\tssid=%s\n", supplicantString(network.SSID))
+
+		if network.Hidden {
+			retval.WriteString("\tscan_ssid=1\n")
+		}
+
+		switch network.Security {
+		case WifiOpen:
+			retval.WriteString("\tkey_mgmt=NONE\n")
+		case WifiWPA2:
+			fmt.Fprintf(&retval, "\tpsk=%s\n", network.psk())
+			retval.WriteString("\tkey_mgmt=WPA-PSK\n")
+		case WifiWPA3:
+			fmt.Fprintf(&retval, "\tsae_password=%s\n", supplicantString(network.Passphrase))
+			retval.WriteString("\tkey_mgmt=SAE\n")
+			retval.WriteString("\tieee80211w=2\n")
+		}
+
+		if network.Priority != 0 {
+			fmt.Fprintf(&retval, "\tpriority=%d\n", network.Priority)
+		}
+
+		retval.WriteString("}\n")
+	}
+
+	return retval.String(), nil
+}
+
+// ParseWifiConfig reads the wifi setup from a wpa_supplicant config file
+func ParseWifiConfig(supplicant string) (WifiConfig, error) {
+	retval := WifiConfig{Networks: []WifiNetworkConfig{}}
+
+	var network map[string]string
+	var block strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(supplicant))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case supplicantNetwork.MatchString(line):
+			network = map[string]string{}
+			block.Reset()
+		case line == "}" && network != nil:
+			parsed, err := parseNetwork(network, block.String())
+			if err != nil {
+				return retval, err
+			}
+			retval.Networks = append(retval.Networks, parsed)
+			network = nil
+		default:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			if network != nil {
+				network[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+				fmt.Fprintf(&block, "\t%s\n", line)
+			} else if strings.TrimSpace(parts[0]) == "country" {
+				retval.Country = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	if network != nil {
+		return retval, fmt.Errorf("The wifi config has a network that isn't closed")
+	}
+
+	return retval, scanner.Err()
+}
+
+// GetWifiConfig reads the current wifi setup
+func GetWifiConfig() (WifiConfig, error) {
+	supplicant, err := readSupplicant()
+	if os.IsNotExist(err) {
+		return WifiConfig{Country: DefaultWifiCountry, Networks: []WifiNetworkConfig{}}, nil
+	}
 	if err != nil {
-		return "", err
+		return WifiConfig{}, err
+	}
+
+	return ParseWifiConfig(string(supplicant))
+}
+
+// Validate checks that the wifi setup can be written to a wpa_supplicant config
+func (config WifiConfig) Validate() error {
+	if !countryCode.MatchString(config.Country) {
+		return fmt.Errorf("Invalid country code: %v", config.Country)
+	}
+
+	ssids := map[string]bool{}
+	for _, network := range config.Networks {
+		if err := network.Validate(); err != nil {
+			return err
+		}
+
+		if ssids[network.SSID] {
+			return fmt.Errorf("%s is in the wifi networks more than once", network.SSID)
+		}
+		ssids[network.SSID] = true
+	}
+
+	return nil
+}
+
+// Redacted gets a copy of the wifi setup without the passphrases
+func (config WifiConfig) Redacted() WifiConfig {
+	retval := WifiConfig{Country: config.Country, Networks: []WifiNetworkConfig{}}
+
+	for _, network := range config.Networks {
+		if network.Passphrase != "" || network.pmk != "" {
+			network.Passphrase = data.RedactedValue
+		}
+		network.pmk = ""
+		retval.Networks = append(retval.Networks, network)
+	}
+
+	return retval
+}
+
+// Merge gets the new wifi setup, keeping the passphrases of networks in the
+// current setup that were sent back redacted
+func (config WifiConfig) Merge(current WifiConfig) WifiConfig {
+	existing := map[string]WifiNetworkConfig{}
+	for _, network := range current.Networks {
+		existing[network.SSID] = network
+	}
+
+	retval := WifiConfig{Country: config.Country, Networks: []WifiNetworkConfig{}}
+	for _, network := range config.Networks {
+		previous, found := existing[network.SSID]
+		if found && network.Passphrase == data.RedactedValue {
+			network.Passphrase = previous.Passphrase
+			network.pmk = previous.pmk
+		}
+		if found && network.Security == WifiOther {
+			network.block = previous.block
+		}
+		retval.Networks = append(retval.Networks, network)
+	}
+
+	return retval
+}
+
+// Validate checks that the network can be written to a wpa_supplicant config
+func (network WifiNetworkConfig) Validate() error {
+	if len(network.SSID) == 0 || len(network.SSID) > 32 {
+		return fmt.Errorf("Wifi SSIDs have to be 1 to 32 bytes: %q", network.SSID)
+	}
+
+	if network.Priority < 0 {
+		return fmt.Errorf("%s can't have a negative priority", network.SSID)
+	}
+
+	if network.Passphrase == data.RedactedValue {
+		return fmt.Errorf("%s isn't set up yet, so it needs its passphrase", network.SSID)
+	}
+
+	switch network.Security {
+	case WifiOpen:
+		if network.Passphrase != "" {
+			return fmt.Errorf("%s is an open network, so it can't have a passphrase", network.SSID)
+		}
+	case WifiWPA2:
+		if network.pmk != "" && network.Passphrase == "" {
+			return nil
+		}
+
+		if len(network.Passphrase) < 8 || len(network.Passphrase) > 63 {
+			return fmt.Errorf("WPA2 passphrases have to be 8 to 63 characters")
+		}
+
+		for _, c := range []byte(network.Passphrase) {
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("WPA2 passphrases can only have printable ASCII characters")
+			}
+		}
+	case WifiWPA3:
+		if network.Passphrase == "" {
+			return fmt.Errorf("%s is a WPA3 network, so it needs a passphrase", network.SSID)
+		}
+	case WifiOther:
+		if network.block == "" {
+			return fmt.Errorf("%s can't be set up with the other security type.  Only networks already in the wpa_supplicant config can be kept", network.SSID)
+		}
+	default:
+		return fmt.Errorf("Unknown wifi security type for %s: %v", network.SSID, network.Security)
+	}
+
+	return nil
+}
+
+// withDefaults fills in the country and security types that weren't set, and
+// sorts the networks highest priority first
+func (config WifiConfig) withDefaults() WifiConfig {
+	retval := WifiConfig{Country: strings.ToUpper(config.Country), Networks: []WifiNetworkConfig{}}
+	if retval.Country == "" {
+		retval.Country = DefaultWifiCountry
+	}
+
+	for _, network := range config.Networks {
+		if network.Security == "" {
+			network.Security = WifiWPA2
+			if network.Passphrase == "" && network.pmk == "" {
+				network.Security = WifiOpen
+			}
+		}
+		retval.Networks = append(retval.Networks, network)
+	}
+
+	sort.SliceStable(retval.Networks, func(i, j int) bool {
+		return retval.Networks[i].Priority > retval.Networks[j].Priority
+	})
+
+	return retval
+}
+
+// psk gets the WPA2 key for the config file.  wpa_supplicant reads a quoted
+// passphrase up to the last quote and a # after a quote starts a comment, so
+// passphrases with quotes are written as the key derived from the passphrase
+func (network WifiNetworkConfig) psk() string {
+	if network.Passphrase == "" {
+		return network.pmk
+	}
+
+	if !strings.Contains(network.Passphrase, `"`) {
+		return `"` + network.Passphrase + `"`
+	}
+
+	return hex.EncodeToString(pbkdf2.Key([]byte(network.Passphrase), []byte(network.SSID), 4096, 32, sha1.New))
+}
+
+// parseNetwork reads a network block from a wpa_supplicant config.  Networks
+// the API can't set up are kept as the other type, with the block as it is
+func parseNetwork(values map[string]string, block string) (WifiNetworkConfig, error) {
+	retval := WifiNetworkConfig{}
+
+	ssid, err := parseSupplicantString(values["ssid"])
+	if err != nil {
+		return retval, fmt.Errorf("The wifi config has an invalid SSID: %v", err)
+	}
+	retval.SSID = ssid
+	retval.Hidden = values["scan_ssid"] == "1"
+
+	if value, found := values["priority"]; found {
+		if retval.Priority, err = strconv.Atoi(value); err != nil {
+			return retval, fmt.Errorf("%s has an invalid priority: %v", ssid, value)
+		}
+	}
+
+	//	wpa_supplicant uses the psk for SAE if there isn't an sae_password:
+	psk, hasPsk := values["psk"]
+	saePassword, hasSaePassword := values["sae_password"]
+	if !hasSaePassword && strings.HasPrefix(psk, `"`) {
+		saePassword, hasSaePassword = psk, true
+	}
+
+	keyManagement := values["key_mgmt"]
+	switch {
+	case keyManagement == "SAE" && hasSaePassword:
+		retval.Security = WifiWPA3
+		if retval.Passphrase, err = parseSupplicantString(saePassword); err != nil {
+			return retval, fmt.Errorf("%s has an invalid passphrase: %v", ssid, err)
+		}
+	case keyManagement == "NONE":
+		retval.Security = WifiOpen
+	case (keyManagement == "" || keyManagement == "WPA-PSK") && hasPsk:
+		retval.Security = WifiWPA2
+		if strings.HasPrefix(psk, `"`) {
+			retval.Passphrase = strings.TrimSuffix(strings.TrimPrefix(psk, `"`), `"`)
+		} else {
+			retval.pmk = psk
+		}
+	default:
+		retval.Security = WifiOther
+		retval.block = block
+	}
+
+	return retval, nil
+}
+
+// supplicantString writes a string for a wpa_supplicant config: in quotes if
+// it's plain text that wpa_supplicant reads back the same, and in hex otherwise
+func supplicantString(value string) string {
+	for _, c := range []byte(value) {
+		if c < 0x20 || c > 0x7e || c == '"' {
+			return hex.EncodeToString([]byte(value))
+		}
+	}
+
+	return `"` + value + `"`
+}
+
+// parseSupplicantString reads a string from a wpa_supplicant config: quoted,
+// printf-escaped (P"...") or hex
+func parseSupplicantString(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1:
+		return value[1 : len(value)-1], nil
+	case strings.HasPrefix(value, `P"`) && strings.HasSuffix(value, `"`) && len(value) > 2:
+		return unescapePrintf(value[2 : len(value)-1])
+	}
+
+	decoded, err := hex.DecodeString(value)
+	return string(decoded), err
+}
+
+// unescapePrintf reads a printf-escaped string, like wpa_supplicant does
+func unescapePrintf(value string) (string, error) {
+	var retval strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			retval.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch value[i] {
+		case 'n':
+			retval.WriteByte('\n')
+		case 'r':
+			retval.WriteByte('\r')
+		case 't':
+			retval.WriteByte('\t')
+		case 'e':
+			retval.WriteByte(0x1b)
+		case 'x':
+			if i+3 > len(value) {
+				return "", fmt.Errorf("Invalid escape in %q", value)
+			}
+			decoded, err := hex.DecodeString(value[i+1 : i+3])
+			if err != nil {
+				return "", fmt.Errorf("Invalid escape in %q", value)
+			}
+			retval.Write(decoded)
+			i += 2
+		default:
+			retval.WriteByte(value[i])
+		}
 	}
 
-	return tpl.String(), nil
+	return retval.String(), nil
 }
@@ -1,8 +1,12 @@
 package network_test
 
 import (
+	"encoding/hex"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/danesparza/appliance-monitor/data"
 	"github.com/danesparza/appliance-monitor/network"
 )
 
@@ -12,14 +16,15 @@ func TestFormatWifiCredentials_WithValidParams_ShouldReturnProperFormat(t *testi
 	//	Arrange
 	ssid := "testssid"
 	passphrase := "testpassphrase"
-	expectedconfig := `country=US
-	
+	expectedconfig := `ctrl_interface=DIR=/var/run/wpa_supplicant GROUP=netdev
+update_config=1
+country=US
+
 network={
 	ssid="testssid"
 	psk="testpassphrase"
 	key_mgmt=WPA-PSK
 }
-
 `
 
 	//	Act
@@ -34,3 +39,229 @@ network={
 		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
 	}
 }
+
+//	Every kind of network should be formatted, highest priority first, with
+//	text wpa_supplicant can't read in quotes written as hex
+func TestFormatWifiConfig_WithManyNetworks_ShouldReturnProperFormat(t *testing.T) {
+
+	//	Arrange
+	config := network.WifiConfig{
+		Country: "de",
+		Networks: []network.WifiNetworkConfig{
+			{SSID: "Guest", Priority: 1},
+			{SSID: `Tom & "Jerry"`, Passphrase: "testpassphrase", Priority: 5},
+			{SSID: "Upstairs", Passphrase: "sae password", Security: network.WifiWPA3, Hidden: true, Priority: 10},
+		},
+	}
+	expectedconfig := `ctrl_interface=DIR=/var/run/wpa_supplicant GROUP=netdev
+update_config=1
+country=DE
+
+network={
+	ssid="Upstairs"
+	scan_ssid=1
+	sae_password="sae password"
+	key_mgmt=SAE
+	ieee80211w=2
+	priority=10
+}
+
+network={
+	ssid=SSIDHEX
+	psk="testpassphrase"
+	key_mgmt=WPA-PSK
+	priority=5
+}
+
+network={
+	ssid="Guest"
+	key_mgmt=NONE
+	priority=1
+}
+`
+	expectedconfig = strings.Replace(expectedconfig, "SSIDHEX", hex.EncodeToString([]byte(`Tom & "Jerry"`)), 1)
+
+	//	Act
+	retval, err := network.FormatWifiConfig(config)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the wifi config: %v", err)
+	}
+
+	if retval != expectedconfig {
+		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
+	}
+}
+
+//	Passphrases with quotes can't be quoted, so the key is written instead
+func TestFormatWifiConfig_PassphraseWithQuotes_ShouldWriteKey(t *testing.T) {
+
+	//	Arrange
+	config := network.WifiConfig{
+		Networks: []network.WifiNetworkConfig{{SSID: "IEEE", Passphrase: `pass"word#1`}},
+	}
+
+	//	Act
+	retval, err := network.FormatWifiConfig(config)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the wifi config: %v", err)
+	}
+
+	if strings.Contains(retval, "word#1") || !regexp.MustCompile(`\n\tpsk=[0-9a-f]{64}\n`).MatchString(retval) {
+		t.Errorf("Should have written the key instead of the passphrase.  Here's what we got:\n%v", retval)
+	}
+}
+
+//	A formatted config should read back as the same setup
+func TestParseWifiConfig_FormattedConfig_ShouldRoundTrip(t *testing.T) {
+
+	//	Arrange
+	config := network.WifiConfig{
+		Country: "GB",
+		Networks: []network.WifiNetworkConfig{
+			{SSID: "Upstairs", Passphrase: "sae \"password\"", Security: network.WifiWPA3, Hidden: true, Priority: 10},
+			{SSID: "Café\nBar", Passphrase: `pass"word#1`, Security: network.WifiWPA2, Priority: 5},
+			{SSID: "Guest", Security: network.WifiOpen},
+		},
+	}
+	formatted, _ := network.FormatWifiConfig(config)
+
+	//	Act
+	retval, err := network.ParseWifiConfig(formatted)
+	reformatted, _ := network.FormatWifiConfig(retval)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while parsing the wifi config: %v", err)
+	}
+
+	if reformatted != formatted {
+		t.Errorf("Configuration doesn't match what we formatted.  Here's what we got:\n%v", reformatted)
+	}
+
+	if retval.Country != "GB" || len(retval.Networks) != 3 || retval.Networks[0].Passphrase != config.Networks[0].Passphrase || retval.Networks[1].SSID != config.Networks[1].SSID {
+		t.Errorf("Setup doesn't match what we formatted.  Here's what we got:\n%+v", retval)
+	}
+}
+
+//	Redacted passphrases should be kept when the setup is sent back
+func TestWifiConfig_RedactedThenMerged_ShouldKeepPassphrases(t *testing.T) {
+
+	//	Arrange
+	current, _ := network.ParseWifiConfig(`country=US
+network={
+	ssid="Home"
+	psk=f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e
+	key_mgmt=WPA-PSK
+}
+network={
+	ssid="Upstairs"
+	sae_password="sae password"
+	key_mgmt=SAE
+}
+`)
+
+	//	Act
+	redacted := current.Redacted()
+	redacted.Networks = append(redacted.Networks, network.WifiNetworkConfig{SSID: "Guest"})
+	merged := redacted.Merge(current)
+	formatted, err := network.FormatWifiConfig(merged)
+
+	//	Assert
+	if redacted.Networks[0].Passphrase != data.RedactedValue || redacted.Networks[1].Passphrase != data.RedactedValue {
+		t.Errorf("Should have redacted the passphrases.  Here's what we got:\n%+v", redacted)
+	}
+
+	if err != nil {
+		t.Errorf("An error occured while formatting the wifi config: %v", err)
+	}
+
+	if !strings.Contains(formatted, "psk=f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e") || !strings.Contains(formatted, `sae_password="sae password"`) {
+		t.Errorf("Should have kept the passphrases.  Here's what we got:\n%v", formatted)
+	}
+}
+
+//	Networks the API can't set up should be kept as they are when the setup is sent back
+func TestWifiConfig_UnsupportedNetworks_ShouldBeKept(t *testing.T) {
+
+	//	Arrange
+	current, parseErr := network.ParseWifiConfig(`country=US
+network={
+	ssid="Office"
+	key_mgmt=WPA-EAP
+	eap=PEAP
+	identity="sam"
+	password="office password"
+}
+network={
+	ssid="Mixed"
+	psk="mixed password"
+	key_mgmt=WPA-PSK SAE
+	ieee80211w=1
+}
+network={
+	ssid="Upstairs"
+	psk="sae password"
+	key_mgmt=SAE
+}
+`)
+
+	//	Act
+	redacted := current.Redacted()
+	merged := redacted.Merge(current)
+	formatted, formatErr := network.FormatWifiConfig(merged)
+	_, newErr := network.FormatWifiConfig(network.WifiConfig{Networks: []network.WifiNetworkConfig{{SSID: "Office", Security: network.WifiOther}}})
+
+	//	Assert
+	if parseErr != nil || formatErr != nil {
+		t.Fatalf("Should have parsed and formatted the wifi config without errors: %v / %v", parseErr, formatErr)
+	}
+
+	if current.Networks[0].Security != network.WifiOther || current.Networks[1].Security != network.WifiOther || current.Networks[0].Passphrase != "" {
+		t.Errorf("Should have kept the enterprise and mixed networks as the other type.  Here's what we got:\n%+v", current)
+	}
+
+	if current.Networks[2].Security != network.WifiWPA3 || current.Networks[2].Passphrase != "sae password" {
+		t.Errorf("Should have read the WPA3 passphrase from the psk.  Here's what we got:\n%+v", current.Networks[2])
+	}
+
+	for _, expected := range []string{"\tkey_mgmt=WPA-EAP\n\teap=PEAP\n\tidentity=\"sam\"\n\tpassword=\"office password\"\n", "\tpsk=\"mixed password\"\n\tkey_mgmt=WPA-PSK SAE\n\tieee80211w=1\n", `sae_password="sae password"`} {
+		if !strings.Contains(formatted, expected) {
+			t.Errorf("Should have kept %q.  Here's what we got:\n%v", expected, formatted)
+		}
+	}
+
+	if newErr == nil {
+		t.Errorf("Shouldn't set up a new network with the other type")
+	}
+}
+
+//	Setups that wpa_supplicant can't use shouldn't be formatted
+func TestFormatWifiConfig_WithInvalidParams_ShouldReturnError(t *testing.T) {
+
+	//	Arrange
+	configs := []network.WifiConfig{
+		{Country: "USA", Networks: []network.WifiNetworkConfig{{SSID: "Home", Passphrase: "testpassphrase"}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "", Passphrase: "testpassphrase"}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Passphrase: "short"}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Passphrase: "testpassphrase\n"}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Passphrase: data.RedactedValue}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Passphrase: "testpassphrase", Security: network.WifiOpen}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Security: network.WifiWPA3}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home", Security: "wep"}}},
+		{Networks: []network.WifiNetworkConfig{{SSID: "Home"}, {SSID: "Home"}}},
+	}
+
+	//	Act
+	for _, config := range configs {
+		_, err := network.FormatWifiConfig(config)
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Should have rejected the wifi config: %+v", config)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// The kernel routing table
+const routeTablePath = "/proc/net/route"
+
+// checkConnectivity returns an error if the monitor isn't back on the network
+// after a change.  After a wifi change, the wifi has to be associated and
+// have an address.  Then a default gateway has to answer a ping.  If there
+// isn't a default gateway, an interface has to have an address
+func checkConnectivity(kind string) error {
+	if kind == ChangeWifi {
+		output, err := exec.Command("wpa_cli", "-i", WifiInterface, "status").CombinedOutput()
+		if err != nil || !strings.Contains(string(output), "wpa_state=COMPLETED") {
+			return fmt.Errorf("the wifi didn't connect to any of the networks")
+		}
+
+		if !wifiConnected() {
+			return fmt.Errorf("the wifi connected, but didn't get an address")
+		}
+	}
+
+	table, err := ioutil.ReadFile(routeTablePath)
+	if err != nil {
+		return err
+	}
+
+	gateways := ParseDefaultGateways(string(table))
+	if kind == ChangeWifi {
+		gateways = map[string]net.IP{WifiInterface: gateways[WifiInterface]}
+	}
+
+	pinged := false
+	for iface, gateway := range gateways {
+		if gateway == nil {
+			continue
+		}
+
+		pinged = true
+		if exec.Command("ping", "-c", "1", "-W", "2", "-I", iface, gateway.String()).Run() == nil {
+			return nil
+		}
+	}
+
+	if pinged {
+		return fmt.Errorf("the gateway couldn't be reached")
+	}
+
+	//	Static addresses don't need a gateway.  Without one, an interface
+	//	that's up has to have its address:
+	if kind == ChangeWifi || interfacesAddressed() {
+		return nil
+	}
+
+	return fmt.Errorf("there's no default gateway, and no network interface got an address")
+}
+
+// interfacesAddressed returns true if a network interface that's up has an
+// address other hosts can reach
+func interfacesAddressed() bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		if addrs, err := iface.Addrs(); err == nil && HasUsableAddress(addrs) {
+			return true
+		}
+	}
+
+	return false
+}
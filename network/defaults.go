@@ -0,0 +1,43 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// The wpa_supplicant config file
+const wifiSupplicantPath = "/etc/wpa_supplicant/wpa_supplicant.conf"
+
+// WifiInterface is the wifi network interface
+const WifiInterface = "wlan0"
+
+// DefaultWifiSupplicant is the wpa_supplicant config for a monitor without
+// any wifi networks set up
+var DefaultWifiSupplicant = []byte(supplicantHeader + "country=" + DefaultWifiCountry + "\n")
+
+// DefaultHostname gets the host name the monitor should have: 'am-' followed
+// by the end of its MAC address
+func DefaultHostname() string {
+	return fmt.Sprintf("%s-%s", "am", getMacAddr())
+}
+
+// getMacAddr gets the MAC hardware
+// address of the host machine
+func getMacAddr() (addr string) {
+	interfaces, err := net.Interfaces()
+
+	if err == nil {
+		for _, i := range interfaces {
+			if i.Flags&net.FlagUp != 0 && bytes.Compare(i.HardwareAddr, nil) != 0 {
+				// Don't use random as we have a real address
+				addr = strings.Replace(i.HardwareAddr.String(), ":", "", -1)
+				addr = addr[6:len(addr)]
+				break
+			}
+		}
+	}
+
+	return
+}
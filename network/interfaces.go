@@ -0,0 +1,519 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The ways an interface can get its addresses
+const (
+	AddressDHCP   = "dhcp"
+	AddressStatic = "static"
+)
+
+// The services that can set up the network interfaces
+const (
+	BackendDhcpcd   = "dhcpcd"
+	BackendNetworkd = "networkd"
+)
+
+// Matches network interface names
+var interfaceName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// Matches the dhcpcd lines the monitor sets in an interface block
+var dhcpcdStatic = regexp.MustCompile(`^static\s+(ip_address|ip6_address|routers|domain_name_servers)\s*=\s*(.*)$`)
+
+// Matches the dhcpcd lines that start a block
+var dhcpcdBlock = regexp.MustCompile(`^(interface|ssid|profile)\s+(\S+)`)
+
+// The systemd-networkd files the monitor writes are named like
+// 10-appliance-monitor-eth0.network
+const (
+	networkdFilePrefix = "10-appliance-monitor-"
+	networkdFileSuffix = ".network"
+)
+
+// NetworkConfig is the addressing setup for the network interfaces.
+// Interfaces that aren't listed use DHCP
+type NetworkConfig struct {
+	// Backend is the service that sets up the interfaces (dhcpcd / networkd).
+	// It's filled in when the setup is read
+	Backend string `json:"backend"`
+
+	Interfaces []InterfaceConfig `json:"interfaces"`
+}
+
+// InterfaceConfig is the addressing setup for a network interface
+type InterfaceConfig struct {
+	// Name is the interface name, like eth0
+	Name string `json:"name"`
+
+	IPv4 AddressConfig `json:"ipv4"`
+	IPv6 AddressConfig `json:"ipv6"`
+
+	// DNS are the name servers to use instead of the ones from DHCP
+	DNS []string `json:"dns"`
+}
+
+// AddressConfig is how an interface gets an IPv4 or IPv6 address
+type AddressConfig struct {
+	// Method is dhcp or static.  If it's blank, DHCP is used.  For IPv6, DHCP
+	// includes router advertisements
+	Method string `json:"method"`
+
+	// Address is the static address and prefix length, like 192.168.1.20/24
+	Address string `json:"address"`
+
+	// Gateway is the static default gateway.  It's optional.  Without any
+	// gateways, a change is kept if an interface gets its address
+	Gateway string `json:"gateway"`
+}
+
+// FormatDhcpcdConfig updates a dhcpcd config file with the network setup.
+// Everything in the current file is kept except the static addresses, routers
+// and name servers, which are replaced with the ones in the setup
+func FormatDhcpcdConfig(current string, config NetworkConfig) (string, error) {
+	config.Backend = BackendDhcpcd
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+
+	statics := map[string][]string{}
+	for _, iface := range config.Interfaces {
+		statics[iface.Name] = iface.dhcpcdLines()
+	}
+
+	globals, blocks := splitDhcpcdConfig(current)
+
+	var retval strings.Builder
+	for _, line := range globals {
+		retval.WriteString(line + "\n")
+	}
+
+	written := map[string]bool{}
+	for _, block := range blocks {
+		lines := block.lines
+		if block.kind == "interface" {
+			lines = []string{}
+			for _, line := range block.lines {
+				if !dhcpcdStatic.MatchString(strings.TrimSpace(line)) {
+					lines = append(lines, line)
+				}
+			}
+			lines = append(trimBlankLines(lines), statics[block.name]...)
+			written[block.name] = true
+		}
+
+		if len(trimBlankLines(lines)) == 0 {
+			continue
+		}
+
+		retval.WriteString("\n" + block.header + "\n")
+		for _, line := range trimBlankLines(lines) {
+			retval.WriteString(line + "\n")
+		}
+	}
+
+	for _, iface := range config.Interfaces {
+		if written[iface.Name] || len(statics[iface.Name]) == 0 {
+			continue
+		}
+
+		retval.WriteString("\ninterface " + iface.Name + "\n")
+		for _, line := range statics[iface.Name] {
+			retval.WriteString(line + "\n")
+		}
+	}
+
+	return retval.String(), nil
+}
+
+// ParseDhcpcdConfig reads the static addresses, routers and name servers from
+// a dhcpcd config file
+func ParseDhcpcdConfig(contents string) NetworkConfig {
+	retval := NetworkConfig{Backend: BackendDhcpcd, Interfaces: []InterfaceConfig{}}
+
+	_, blocks := splitDhcpcdConfig(contents)
+	for _, block := range blocks {
+		if block.kind != "interface" {
+			continue
+		}
+
+		iface := InterfaceConfig{Name: block.name}
+		for _, line := range block.lines {
+			match := dhcpcdStatic.FindStringSubmatch(strings.TrimSpace(line))
+			if match == nil {
+				continue
+			}
+
+			values := strings.Fields(match[2])
+			if len(values) == 0 {
+				continue
+			}
+
+			switch match[1] {
+			case "ip_address":
+				iface.IPv4.Address = values[0]
+			case "ip6_address":
+				iface.IPv6.Address = values[0]
+			case "routers":
+				iface.IPv4.Gateway = values[0]
+			case "domain_name_servers":
+				iface.DNS = values
+			}
+		}
+
+		retval.Interfaces = append(retval.Interfaces, iface.parsed())
+	}
+
+	return retval
+}
+
+// FormatNetworkdConfig formats the network setup as systemd-networkd files.
+// The files are returned by name, and there's one for each interface
+func FormatNetworkdConfig(config NetworkConfig) (map[string]string, error) {
+	config.Backend = BackendNetworkd
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	retval := map[string]string{}
+	for _, iface := range config.Interfaces {
+		dhcp := "no"
+		switch {
+		case iface.IPv4.Method == AddressDHCP && iface.IPv6.Method == AddressDHCP:
+			dhcp = "yes"
+		case iface.IPv4.Method == AddressDHCP:
+			dhcp = "ipv4"
+		case iface.IPv6.Method == AddressDHCP:
+			dhcp = "ipv6"
+		}
+
+		acceptRA := "no"
+		if iface.IPv6.Method == AddressDHCP {
+			acceptRA = "yes"
+		}
+
+		var file strings.Builder
+		fmt.Fprintf(&file, "[Match]\nName=%s\n\n[Network]\nDHCP=%s\nIPv6AcceptRA=%s\n", iface.Name, dhcp, acceptRA)
+
+		for _, address := range []AddressConfig{iface.IPv4, iface.IPv6} {
+			if address.Method != AddressStatic {
+				continue
+			}
+
+			fmt.Fprintf(&file, "Address=%s\n", canonicalPrefix(address.Address))
+			if address.Gateway != "" {
+				fmt.Fprintf(&file, "Gateway=%s\n", net.ParseIP(address.Gateway).String())
+			}
+		}
+
+		for _, server := range iface.DNS {
+			fmt.Fprintf(&file, "DNS=%s\n", net.ParseIP(server).String())
+		}
+
+		retval[networkdFilePrefix+iface.Name+networkdFileSuffix] = file.String()
+	}
+
+	return retval, nil
+}
+
+// ParseNetworkdConfig reads the addressing setup from a systemd-networkd file
+func ParseNetworkdConfig(contents string) InterfaceConfig {
+	retval := InterfaceConfig{}
+	dhcp := "no"
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(parts[1])
+		ip := net.ParseIP(strings.Split(value, "/")[0])
+
+		switch strings.TrimSpace(parts[0]) {
+		case "Name":
+			retval.Name = value
+		case "DHCP":
+			dhcp = value
+		case "Address":
+			if ip != nil && ip.To4() != nil {
+				retval.IPv4.Address = value
+			} else if ip != nil {
+				retval.IPv6.Address = value
+			}
+		case "Gateway":
+			if ip != nil && ip.To4() != nil {
+				retval.IPv4.Gateway = value
+			} else if ip != nil {
+				retval.IPv6.Gateway = value
+			}
+		case "DNS":
+			retval.DNS = append(retval.DNS, strings.Fields(value)...)
+		}
+	}
+
+	retval = retval.parsed()
+	if dhcp == "yes" || dhcp == "ipv4" {
+		retval.IPv4 = AddressConfig{Method: AddressDHCP}
+	}
+	if dhcp == "yes" || dhcp == "ipv6" {
+		retval.IPv6 = AddressConfig{Method: AddressDHCP}
+	}
+
+	return retval
+}
+
+// GetNetworkConfig reads the current network setup.  Interfaces that aren't in
+// the config files are included, using DHCP
+func GetNetworkConfig() (NetworkConfig, error) {
+	retval, err := readNetworkConfig()
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return retval, err
+	}
+
+	configured := map[string]bool{}
+	for _, iface := range retval.Interfaces {
+		configured[iface.Name] = true
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return retval, err
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || configured[iface.Name] || !interfaceName.MatchString(iface.Name) {
+			continue
+		}
+		retval.Interfaces = append(retval.Interfaces, InterfaceConfig{Name: iface.Name}.parsed())
+	}
+
+	return retval.withDefaults(), nil
+}
+
+// ValidateNetworkConfig checks that the network setup can be written
+func ValidateNetworkConfig(config NetworkConfig) error {
+	return config.withDefaults().Validate()
+}
+
+// Validate checks that the network setup can be written by its backend.
+// Blank methods should already be filled in
+func (config NetworkConfig) Validate() error {
+	names := map[string]bool{}
+	for _, iface := range config.Interfaces {
+		if err := iface.Validate(); err != nil {
+			return err
+		}
+
+		if config.Backend == BackendDhcpcd && iface.IPv6.Gateway != "" {
+			return fmt.Errorf("dhcpcd can't set an IPv6 gateway for %s.  Leave it blank to use router advertisements", iface.Name)
+		}
+
+		if names[iface.Name] {
+			return fmt.Errorf("%s is in the network interfaces more than once", iface.Name)
+		}
+		names[iface.Name] = true
+	}
+
+	return nil
+}
+
+// Validate checks that the interface setup can be written
+func (iface InterfaceConfig) Validate() error {
+	if !interfaceName.MatchString(iface.Name) {
+		return fmt.Errorf("Invalid network interface name: %q", iface.Name)
+	}
+
+	if err := iface.IPv4.validate(iface.Name, "IPv4"); err != nil {
+		return err
+	}
+
+	if err := iface.IPv6.validate(iface.Name, "IPv6"); err != nil {
+		return err
+	}
+
+	for _, server := range iface.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("Invalid DNS server for %s: %q", iface.Name, server)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the address setup for the IPv4 or IPv6 family
+func (address AddressConfig) validate(iface, family string) error {
+	switch address.Method {
+	case AddressDHCP:
+		if address.Address != "" || address.Gateway != "" {
+			return fmt.Errorf("%s uses DHCP for %s, so it can't have a static address or gateway", iface, family)
+		}
+		return nil
+	case AddressStatic:
+	default:
+		return fmt.Errorf("Unknown %s method for %s: %v", family, iface, address.Method)
+	}
+
+	example := "2001:db8::20/64"
+	if family == "IPv4" {
+		example = "192.168.1.20/24"
+	}
+
+	ip, network, err := net.ParseCIDR(address.Address)
+	if err != nil || (ip.To4() != nil) != (family == "IPv4") {
+		return fmt.Errorf("Invalid static %s address for %s, it should look like %s: %q", family, iface, example, address.Address)
+	}
+
+	if address.Gateway == "" {
+		return nil
+	}
+
+	gateway := net.ParseIP(address.Gateway)
+	if gateway == nil || (gateway.To4() != nil) != (family == "IPv4") {
+		return fmt.Errorf("Invalid %s gateway for %s: %q", family, iface, address.Gateway)
+	}
+
+	if gateway.Equal(ip) {
+		return fmt.Errorf("The %s gateway for %s can't be its own address", family, iface)
+	}
+
+	//	IPv6 gateways are often link-local, so only IPv4 gateways have to be
+	//	on the interface's network:
+	if family == "IPv4" && !network.Contains(gateway) {
+		return fmt.Errorf("The IPv4 gateway for %s isn't on its network (%v)", iface, network)
+	}
+
+	return nil
+}
+
+// withDefaults fills in the methods that weren't set, and sorts the
+// interfaces by name
+func (config NetworkConfig) withDefaults() NetworkConfig {
+	retval := NetworkConfig{Backend: config.Backend, Interfaces: []InterfaceConfig{}}
+
+	for _, iface := range config.Interfaces {
+		if iface.IPv4.Method == "" {
+			iface.IPv4.Method = AddressDHCP
+		}
+		if iface.IPv6.Method == "" {
+			iface.IPv6.Method = AddressDHCP
+		}
+		retval.Interfaces = append(retval.Interfaces, iface)
+	}
+
+	sort.SliceStable(retval.Interfaces, func(i, j int) bool {
+		return retval.Interfaces[i].Name < retval.Interfaces[j].Name
+	})
+
+	return retval
+}
+
+// dhcpcdLines gets the static lines for the interface's dhcpcd block
+func (iface InterfaceConfig) dhcpcdLines() []string {
+	retval := []string{}
+
+	if iface.IPv4.Method == AddressStatic {
+		retval = append(retval, "static ip_address="+canonicalPrefix(iface.IPv4.Address))
+		if iface.IPv4.Gateway != "" {
+			retval = append(retval, "static routers="+net.ParseIP(iface.IPv4.Gateway).String())
+		}
+	}
+
+	if iface.IPv6.Method == AddressStatic {
+		retval = append(retval, "static ip6_address="+canonicalPrefix(iface.IPv6.Address))
+	}
+
+	if len(iface.DNS) > 0 {
+		servers := []string{}
+		for _, server := range iface.DNS {
+			servers = append(servers, net.ParseIP(server).String())
+		}
+		retval = append(retval, "static domain_name_servers="+strings.Join(servers, " "))
+	}
+
+	return retval
+}
+
+// parsed fills in the methods for an interface read from a config file:
+// families with an address are static
+func (iface InterfaceConfig) parsed() InterfaceConfig {
+	for _, address := range []*AddressConfig{&iface.IPv4, &iface.IPv6} {
+		address.Method = AddressDHCP
+		if address.Address != "" {
+			address.Method = AddressStatic
+		}
+	}
+
+	if iface.DNS == nil {
+		iface.DNS = []string{}
+	}
+
+	return iface
+}
+
+// canonicalPrefix formats an address and prefix length, like 192.168.1.20/24
+func canonicalPrefix(address string) string {
+	ip, network, err := net.ParseCIDR(address)
+	if err != nil {
+		return address
+	}
+
+	ones, _ := network.Mask.Size()
+	return ip.String() + "/" + strconv.Itoa(ones)
+}
+
+// dhcpcdConfigBlock is an interface, ssid or profile block in a dhcpcd config
+type dhcpcdConfigBlock struct {
+	header string
+	kind   string
+	name   string
+	lines  []string
+}
+
+// splitDhcpcdConfig splits a dhcpcd config into the global lines and the
+// blocks.  A block runs until the next one starts
+func splitDhcpcdConfig(contents string) ([]string, []dhcpcdConfigBlock) {
+	globals := []string{}
+	blocks := []dhcpcdConfigBlock{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if match := dhcpcdBlock.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			blocks = append(blocks, dhcpcdConfigBlock{header: strings.TrimSpace(line), kind: match[1], name: match[2]})
+			continue
+		}
+
+		if len(blocks) == 0 {
+			globals = append(globals, line)
+		} else {
+			blocks[len(blocks)-1].lines = append(blocks[len(blocks)-1].lines, line)
+		}
+	}
+
+	return trimBlankLines(globals), blocks
+}
+
+// trimBlankLines removes the blank lines at the end
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
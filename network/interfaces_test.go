@@ -0,0 +1,182 @@
+package network_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/network"
+)
+
+//	The static lines should be replaced, and everything else kept
+func TestFormatDhcpcdConfig_ValidParams_ShouldReturnProperFormat(t *testing.T) {
+
+	//	Arrange
+	current := `hostname
+clientid
+persistent
+slaac private
+
+interface wlan0
+static ip_address=192.168.4.1/24
+nohook wpa_supplicant
+
+ssid Home
+static domain_name_servers=192.168.1.1
+`
+	config := network.NetworkConfig{
+		Interfaces: []network.InterfaceConfig{
+			{Name: "wlan0"},
+			{
+				Name: "eth0",
+				IPv4: network.AddressConfig{Method: network.AddressStatic, Address: "192.168.1.20/24", Gateway: "192.168.1.1"},
+				IPv6: network.AddressConfig{Method: network.AddressStatic, Address: "2001:0db8::0020/64"},
+				DNS:  []string{"1.1.1.1", "2606:4700:4700::1111"},
+			},
+		},
+	}
+	expectedconfig := `hostname
+clientid
+persistent
+slaac private
+
+interface wlan0
+nohook wpa_supplicant
+
+ssid Home
+static domain_name_servers=192.168.1.1
+
+interface eth0
+static ip_address=192.168.1.20/24
+static routers=192.168.1.1
+static ip6_address=2001:db8::20/64
+static domain_name_servers=1.1.1.1 2606:4700:4700::1111
+`
+
+	//	Act
+	retval, err := network.FormatDhcpcdConfig(current, config)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the dhcpcd config: %v", err)
+	}
+
+	if retval != expectedconfig {
+		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
+	}
+}
+
+//	A formatted dhcpcd config should read back as the same setup
+func TestParseDhcpcdConfig_FormattedConfig_ShouldRoundTrip(t *testing.T) {
+
+	//	Arrange
+	expected := []network.InterfaceConfig{
+		{
+			Name: "eth0",
+			IPv4: network.AddressConfig{Method: network.AddressStatic, Address: "10.0.0.5/8", Gateway: "10.0.0.1"},
+			IPv6: network.AddressConfig{Method: network.AddressDHCP},
+			DNS:  []string{"10.0.0.1"},
+		},
+		{
+			Name: "wlan0",
+			IPv4: network.AddressConfig{Method: network.AddressDHCP},
+			IPv6: network.AddressConfig{Method: network.AddressStatic, Address: "2001:db8::5/64"},
+			DNS:  []string{},
+		},
+	}
+	formatted, _ := network.FormatDhcpcdConfig("", network.NetworkConfig{Interfaces: expected})
+
+	//	Act
+	retval := network.ParseDhcpcdConfig(formatted)
+
+	//	Assert
+	if retval.Backend != network.BackendDhcpcd || !reflect.DeepEqual(retval.Interfaces, expected) {
+		t.Errorf("Setup doesn't match what we formatted.  Here's what we got:\n%+v", retval)
+	}
+}
+
+//	Each interface should get a systemd-networkd file that reads back the same
+func TestFormatNetworkdConfig_ValidParams_ShouldReturnProperFormat(t *testing.T) {
+
+	//	Arrange
+	config := network.NetworkConfig{
+		Interfaces: []network.InterfaceConfig{
+			{
+				Name: "eth0",
+				IPv4: network.AddressConfig{Method: network.AddressStatic, Address: "192.168.1.20/24", Gateway: "192.168.1.1"},
+				IPv6: network.AddressConfig{Method: network.AddressStatic, Address: "2001:db8::20/64", Gateway: "fe80::1"},
+				DNS:  []string{"192.168.1.1"},
+			},
+			{Name: "wlan0"},
+		},
+	}
+	expectedconfig := `[Match]
+Name=eth0
+
+[Network]
+DHCP=no
+IPv6AcceptRA=no
+Address=192.168.1.20/24
+Gateway=192.168.1.1
+Address=2001:db8::20/64
+Gateway=fe80::1
+DNS=192.168.1.1
+`
+
+	//	Act
+	retval, err := network.FormatNetworkdConfig(config)
+	parsed := network.ParseNetworkdConfig(retval["10-appliance-monitor-wlan0.network"])
+
+	//	Assert
+	if err != nil {
+		t.Errorf("An error occured while formatting the networkd config: %v", err)
+	}
+
+	if len(retval) != 2 || retval["10-appliance-monitor-eth0.network"] != expectedconfig {
+		t.Errorf("Configuration doesn't match what we expect.  Here's what we got:\n%v", retval)
+	}
+
+	if !reflect.DeepEqual(network.ParseNetworkdConfig(expectedconfig), config.Interfaces[0]) {
+		t.Errorf("Setup doesn't match what we formatted.  Here's what we got:\n%+v", network.ParseNetworkdConfig(expectedconfig))
+	}
+
+	if parsed.Name != "wlan0" || parsed.IPv4.Method != network.AddressDHCP || parsed.IPv6.Method != network.AddressDHCP {
+		t.Errorf("Should have read back DHCP.  Here's what we got:\n%+v", parsed)
+	}
+}
+
+//	Setups that can't be written shouldn't be formatted
+func TestFormatDhcpcdConfig_WithInvalidParams_ShouldReturnError(t *testing.T) {
+
+	//	Arrange
+	static := func(address, gateway string) network.AddressConfig {
+		return network.AddressConfig{Method: network.AddressStatic, Address: address, Gateway: gateway}
+	}
+	interfaces := []network.InterfaceConfig{
+		{Name: "eth0\nstatic"},
+		{Name: ""},
+		{Name: "eth0", IPv4: network.AddressConfig{Method: "manual"}},
+		{Name: "eth0", IPv4: network.AddressConfig{Method: network.AddressDHCP, Address: "192.168.1.20/24"}},
+		{Name: "eth0", IPv4: static("192.168.1.20", "")},
+		{Name: "eth0", IPv4: static("2001:db8::20/64", "")},
+		{Name: "eth0", IPv4: static("192.168.1.20/24", "10.0.0.1")},
+		{Name: "eth0", IPv4: static("192.168.1.20/24", "192.168.1.20")},
+		{Name: "eth0", IPv6: static("192.168.1.20/24", "")},
+		{Name: "eth0", IPv6: static("2001:db8::20/64", "fe80::1")},
+		{Name: "eth0", DNS: []string{"dns.example.com"}},
+	}
+
+	//	Act
+	for _, iface := range interfaces {
+		_, err := network.FormatDhcpcdConfig("", network.NetworkConfig{Interfaces: []network.InterfaceConfig{iface}})
+
+		//	Assert
+		if err == nil {
+			t.Errorf("Should have rejected the network config: %+v", iface)
+		}
+	}
+
+	_, err := network.FormatDhcpcdConfig("", network.NetworkConfig{Interfaces: []network.InterfaceConfig{{Name: "eth0"}, {Name: "eth0"}}})
+	if err == nil {
+		t.Errorf("Should have rejected an interface listed twice")
+	}
+}
@@ -0,0 +1,29 @@
+// +build !linux !arm
+
+package network
+
+import "log"
+
+// readNetworkConfig reads the network setup.  Off the Pi there isn't one, so
+// this pretends eth0 has a static address
+func readNetworkConfig() (NetworkConfig, error) {
+	return ParseDhcpcdConfig("hostname\nclientid\npersistent\n\ninterface eth0\nstatic ip_address=192.168.1.20/24\nstatic routers=192.168.1.1\nstatic domain_name_servers=192.168.1.1\n"), nil
+}
+
+// UpdateNetworkConfig saves the network setup and reboots.  The change is
+// verified after the reboot, and rolled back if the monitor can't connect
+func UpdateNetworkConfig(config NetworkConfig, reboot chan bool) error {
+	config.Backend = BackendDhcpcd
+	if err := ValidateNetworkConfig(config); err != nil {
+		return err
+	}
+
+	for _, iface := range config.Interfaces {
+		log.Printf("[INFO] Not running on Linux/ARM.  Updating the network config.  Interface: %v\n", iface.Name)
+	}
+
+	log.Println("[INFO] Requesting a reboot because of network changes")
+	reboot <- true
+
+	return nil
+}
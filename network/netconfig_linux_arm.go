@@ -0,0 +1,127 @@
+package network
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The network config files
+const (
+	dhcpcdConfigPath  = "/etc/dhcpcd.conf"
+	networkdConfigDir = "/etc/systemd/network"
+)
+
+// networkBackend gets the service that sets up the network interfaces.
+// Raspbian uses dhcpcd, and systemd-networkd is used without it
+func networkBackend() string {
+	if _, err := os.Stat(dhcpcdConfigPath); err == nil {
+		return BackendDhcpcd
+	}
+
+	return BackendNetworkd
+}
+
+// readNetworkConfig reads the network setup from the backend's config files
+func readNetworkConfig() (NetworkConfig, error) {
+	if networkBackend() == BackendDhcpcd {
+		contents, err := ioutil.ReadFile(dhcpcdConfigPath)
+		if err != nil {
+			return NetworkConfig{Backend: BackendDhcpcd, Interfaces: []InterfaceConfig{}}, err
+		}
+		return ParseDhcpcdConfig(string(contents)), nil
+	}
+
+	retval := NetworkConfig{Backend: BackendNetworkd, Interfaces: []InterfaceConfig{}}
+	paths, err := filepath.Glob(filepath.Join(networkdConfigDir, networkdFilePrefix+"*"+networkdFileSuffix))
+	if err != nil {
+		return retval, err
+	}
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return retval, err
+		}
+		retval.Interfaces = append(retval.Interfaces, ParseNetworkdConfig(string(contents)))
+	}
+
+	return retval, nil
+}
+
+// networkConfigFiles formats the network setup as the backend's config files.
+// systemd-networkd files for interfaces that aren't in the setup any more
+// don't have contents, so they get removed
+func networkConfigFiles(config NetworkConfig) (map[string][]byte, error) {
+	retval := map[string][]byte{}
+
+	if networkBackend() == BackendDhcpcd {
+		current, err := ioutil.ReadFile(dhcpcdConfigPath)
+		if err != nil {
+			return retval, err
+		}
+
+		formatted, err := FormatDhcpcdConfig(string(current), config)
+		if err != nil {
+			return retval, err
+		}
+
+		retval[dhcpcdConfigPath] = []byte(formatted)
+		return retval, nil
+	}
+
+	existing, err := filepath.Glob(filepath.Join(networkdConfigDir, networkdFilePrefix+"*"+networkdFileSuffix))
+	if err != nil {
+		return retval, err
+	}
+
+	for _, path := range existing {
+		retval[path] = nil
+	}
+
+	files, err := FormatNetworkdConfig(config)
+	if err != nil {
+		return retval, err
+	}
+
+	for name, contents := range files {
+		retval[filepath.Join(networkdConfigDir, name)] = []byte(contents)
+	}
+
+	return retval, nil
+}
+
+// UpdateNetworkConfig saves the network setup and reboots.  The change is
+// verified after the reboot, and rolled back if the monitor can't connect
+func UpdateNetworkConfig(config NetworkConfig, reboot chan bool) error {
+	for _, iface := range config.Interfaces {
+		log.Printf("[INFO] Updating the network config.  Interface: %v\n", iface.Name)
+	}
+
+	//	Get the formatted config files
+	files, err := networkConfigFiles(config)
+	if err != nil {
+		log.Printf("[ERROR] Formatting network config: %v", err.Error())
+		return err
+	}
+
+	//	Save the formatted config files, keeping the old ones in case the
+	//	monitor can't connect after the reboot
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	err = DefaultChangeJournal.Stage(ChangeNetwork, files)
+	if err != nil {
+		log.Printf("[ERROR] Problem writing %s: %v", strings.Join(paths, ", "), err.Error())
+		return err
+	}
+
+	log.Println("[INFO] Requesting a reboot because of network changes")
+	reboot <- true
+
+	return nil
+}
@@ -0,0 +1,27 @@
+// +build !linux !arm
+
+package network
+
+import "log"
+
+// readSupplicant reads the wpa_supplicant config.  Off the Pi there isn't one,
+// so this pretends a network is set up
+func readSupplicant() ([]byte, error) {
+	return []byte(supplicantHeader + "country=US\n\nnetwork={\n\tssid=\"testssid\"\n\tpsk=\"testpassphrase\"\n\tkey_mgmt=WPA-PSK\n}\n"), nil
+}
+
+// wifiConnected returns true if the wifi is connected
+func wifiConnected() bool {
+	return true
+}
+
+// startAccessPoint broadcasts the setup network
+func startAccessPoint(info AccessPointInfo, portalPort int) error {
+	log.Printf("[INFO] Not running on Linux/ARM, so the %s access point won't get started...", info.SSID)
+	return nil
+}
+
+// clearAccessPoint removes the access point config files.  Off the Pi, none get written
+func clearAccessPoint() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// readSupplicant reads the wpa_supplicant config
+func readSupplicant() ([]byte, error) {
+	return ioutil.ReadFile(wifiSupplicantPath)
+}
+
+// wifiConnected returns true if the wifi interface has an IPv4 address
+// that isn't link-local
+func wifiConnected() bool {
+	iface, err := net.InterfaceByName(WifiInterface)
+	if err != nil {
+		return false
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && !ipnet.IP.IsLinkLocalUnicast() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startAccessPoint writes the hostapd and dnsmasq config files, takes the wifi
+// interface away from wpa_supplicant and starts the access point.  Web traffic
+// is redirected to portalPort.  The system dnsmasq is stopped, and one that only
+// reads the provisioning config is started instead.  None of it is enabled, so
+// the next reboot goes back to the wifi client
+func startAccessPoint(info AccessPointInfo, portalPort int) error {
+	files := DefaultAccessPointFiles
+	if err := files.Write(info); err != nil {
+		log.Printf("[ERROR] %v", err)
+		return err
+	}
+
+	commands := [][]string{
+		{"wpa_cli", "-i", info.Interface, "terminate"},
+		{"systemctl", "stop", "dnsmasq"},
+		{"ip", "addr", "flush", "dev", info.Interface},
+		{"ip", "addr", "add", info.Address + "/24", "dev", info.Interface},
+		{"systemctl", "unmask", "hostapd"},
+		{"systemctl", "start", "hostapd"},
+		{"dnsmasq", "--conf-file=" + files.Dnsmasq, "--pid-file=" + filepath.Join(filepath.Dir(files.Dnsmasq), "dnsmasq.pid")},
+		{"iptables", "-t", "nat", "-A", "PREROUTING", "-i", info.Interface, "-p", "tcp", "--dport", "80", "-j", "REDIRECT", "--to-ports", strconv.Itoa(portalPort)},
+	}
+
+	for _, command := range commands {
+		output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+
+		//	wpa_supplicant and the system dnsmasq might not be running:
+		if err != nil && command[0] != "wpa_cli" && command[1] != "stop" {
+			return fmt.Errorf("Problem running %v: %v %s", command, err, output)
+		}
+	}
+
+	return nil
+}
+
+// clearAccessPoint removes the access point config files left from the last
+// time the monitor was in provisioning mode
+func clearAccessPoint() error {
+	return DefaultAccessPointFiles.Clear()
+}
@@ -0,0 +1,13 @@
+// +build !linux !arm
+
+package network
+
+import "log"
+
+// ResetNetwork removes the wifi networks, puts the network interfaces back on
+// DHCP and the host name back to the default, and reboots
+func ResetNetwork(reboot chan bool) error {
+	log.Println("[INFO] Not running on Linux/ARM, so the wifi and network config won't get reset...")
+
+	return ResetHostname(DefaultHostname(), reboot)
+}
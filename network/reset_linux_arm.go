@@ -0,0 +1,41 @@
+package network
+
+import (
+	"io/ioutil"
+	"log"
+)
+
+// ResetNetwork removes the wifi networks, puts the network interfaces back on
+// DHCP and the host name back to the default, and reboots
+func ResetNetwork(reboot chan bool) error {
+	log.Println("[INFO] Resetting the wifi config")
+
+	//	Don't roll back to the networks that are being removed:
+	if err := DefaultChangeJournal.Discard(); err != nil {
+		log.Printf("[ERROR] Problem discarding the pending network change: %v", err.Error())
+		return err
+	}
+
+	err := ioutil.WriteFile(wifiSupplicantPath, DefaultWifiSupplicant, 0600)
+	if err != nil {
+		log.Printf("[ERROR] Problem writing %s: %v", wifiSupplicantPath, err.Error())
+		return err
+	}
+
+	//	Put the network interfaces back on DHCP:
+	log.Println("[INFO] Resetting the network config")
+	files, err := networkConfigFiles(NetworkConfig{})
+	if err != nil {
+		log.Printf("[ERROR] Problem formatting the network config: %v", err.Error())
+		return err
+	}
+
+	for path, contents := range files {
+		if err := writeConfigFile(path, contents); err != nil {
+			log.Printf("[ERROR] Problem writing %s: %v", path, err.Error())
+			return err
+		}
+	}
+
+	return ResetHostname(DefaultHostname(), reboot)
+}
@@ -0,0 +1,48 @@
+package network
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// ParseDefaultGateways gets the IPv4 default gateway for each interface from
+// the kernel routing table, as listed in /proc/net/route
+func ParseDefaultGateways(table string) map[string]net.IP {
+	retval := map[string]net.IP{}
+
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(line)
+
+		//	Iface Destination Gateway Flags ... Mask ...:
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		gateway, err := hex.DecodeString(fields[2])
+		if err != nil || len(gateway) != net.IPv4len {
+			continue
+		}
+
+		//	The addresses are little-endian:
+		retval[fields[0]] = net.IPv4(gateway[3], gateway[2], gateway[1], gateway[0])
+	}
+
+	return retval
+}
+
+// HasUsableAddress returns true if any of the addresses can be reached from
+// other hosts: it isn't loopback or link-local.  Without a default gateway to
+// ping, it's how a network change is checked
+func HasUsableAddress(addrs []net.Addr) bool {
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,239 @@
+package network
+
+import (
+	"bufio"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The security types of a wifi network
+const (
+	SecurityOpen       = "open"
+	SecurityWEP        = "wep"
+	SecurityWPA        = "wpa"
+	SecurityWPA2       = "wpa2"
+	SecurityWPA3       = "wpa3"
+	SecurityEnterprise = "enterprise"
+)
+
+// WifiNetwork is a wifi network found by a scan
+type WifiNetwork struct {
+	SSID string `json:"ssid"`
+
+	// BSSID is the MAC address of the access point
+	BSSID string `json:"bssid"`
+
+	// Signal is the signal strength in dBm.  Closer to zero is stronger
+	Signal int `json:"signal"`
+
+	// Frequency is the frequency in MHz
+	Frequency int `json:"frequency"`
+
+	Channel int `json:"channel"`
+
+	// Security is the security type (open / wep / wpa / wpa2 / wpa3 / enterprise)
+	Security string `json:"security"`
+}
+
+// ParseWpaScanResults parses the output of 'wpa_cli scan_results'.  Each
+// line after the header is the BSSID, frequency, signal level, flags and
+// SSID, separated by tabs
+func ParseWpaScanResults(output string) []WifiNetwork {
+	retval := []WifiNetwork{}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) < 4 {
+			continue
+		}
+
+		frequency, err := strconv.Atoi(fields[1])
+		if err != nil {
+			//	The header line:
+			continue
+		}
+
+		signal, _ := strconv.Atoi(fields[2])
+
+		ssid := ""
+		if len(fields) == 5 {
+			ssid = scanSSID(fields[4])
+		}
+
+		retval = append(retval, WifiNetwork{
+			SSID:      ssid,
+			BSSID:     fields[0],
+			Signal:    signal,
+			Frequency: frequency,
+			Channel:   frequencyChannel(frequency),
+			Security:  wpaFlagsSecurity(fields[3]),
+		})
+	}
+
+	return strongestNetworks(retval)
+}
+
+// ParseIwScan parses the output of 'iw dev wlan0 scan'.  It's used when
+// wpa_supplicant isn't running, like in provisioning mode
+func ParseIwScan(output string) []WifiNetwork {
+	retval := []WifiNetwork{}
+
+	var current *WifiNetwork
+	var wpa, rsn, privacy bool
+	var suites string
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+
+		switch {
+		case strings.Contains(suites, "802.1X"):
+			current.Security = SecurityEnterprise
+		case rsn && strings.Contains(suites, "SAE") && !strings.Contains(suites, "PSK"):
+			current.Security = SecurityWPA3
+		case rsn:
+			current.Security = SecurityWPA2
+		case wpa:
+			current.Security = SecurityWPA
+		case privacy:
+			current.Security = SecurityWEP
+		default:
+			current.Security = SecurityOpen
+		}
+
+		retval = append(retval, *current)
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		//	Each access point starts a new block:
+		if strings.HasPrefix(line, "BSS ") {
+			finish()
+
+			bssid := strings.TrimPrefix(line, "BSS ")
+			if end := strings.IndexAny(bssid, "( "); end >= 0 {
+				bssid = bssid[:end]
+			}
+
+			current = &WifiNetwork{BSSID: bssid}
+			wpa, rsn, privacy, suites = false, false, false, ""
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, "freq:"):
+			value := strings.TrimSpace(strings.TrimPrefix(trimmed, "freq:"))
+			if frequency, err := strconv.ParseFloat(value, 64); err == nil {
+				current.Frequency = int(frequency)
+				current.Channel = frequencyChannel(current.Frequency)
+			}
+		case strings.HasPrefix(trimmed, "signal:"):
+			value := strings.Fields(strings.TrimPrefix(trimmed, "signal:"))
+			if len(value) > 0 {
+				if signal, err := strconv.ParseFloat(value[0], 64); err == nil {
+					current.Signal = int(signal)
+				}
+			}
+		case strings.HasPrefix(trimmed, "SSID:"):
+			current.SSID = scanSSID(strings.TrimSpace(strings.TrimPrefix(trimmed, "SSID:")))
+		case strings.HasPrefix(trimmed, "capability:"):
+			privacy = strings.Contains(trimmed, "Privacy")
+		case strings.HasPrefix(trimmed, "RSN:"):
+			rsn = true
+		case strings.HasPrefix(trimmed, "WPA:"):
+			wpa = true
+		case strings.Contains(trimmed, "Authentication suites:"):
+			suites += " " + trimmed[strings.Index(trimmed, ":")+1:]
+		}
+	}
+	finish()
+
+	return strongestNetworks(retval)
+}
+
+// scanSSID reads an SSID from scan output.  wpa_cli and iw both escape quotes,
+// backslashes and bytes that aren't printable ASCII, like \" or \xc3\xa9.  If
+// it can't be read, it's kept as it is
+func scanSSID(value string) string {
+	ssid, err := unescapePrintf(value)
+	if err != nil {
+		return value
+	}
+
+	return ssid
+}
+
+// wpaFlagsSecurity gets the security type from wpa_cli flags, like
+// [WPA2-PSK-CCMP][ESS]
+func wpaFlagsSecurity(flags string) string {
+	switch {
+	case strings.Contains(flags, "EAP"):
+		return SecurityEnterprise
+	case strings.Contains(flags, "SAE") && !strings.Contains(flags, "PSK"):
+		return SecurityWPA3
+	case strings.Contains(flags, "WPA2") || strings.Contains(flags, "RSN"):
+		return SecurityWPA2
+	case strings.Contains(flags, "WPA"):
+		return SecurityWPA
+	case strings.Contains(flags, "WEP"):
+		return SecurityWEP
+	}
+
+	return SecurityOpen
+}
+
+// frequencyChannel gets the wifi channel for a frequency in MHz
+func frequencyChannel(frequency int) int {
+	switch {
+	case frequency == 2484:
+		return 14
+	case frequency >= 2412 && frequency < 2484:
+		return (frequency - 2407) / 5
+	case frequency >= 5000 && frequency < 5900:
+		return (frequency - 5000) / 5
+	case frequency > 5950 && frequency <= 7115:
+		return (frequency - 5950) / 5
+	}
+
+	return 0
+}
+
+// strongestNetworks keeps the strongest access point for each SSID, leaves
+// out hidden networks, and sorts them strongest first
+func strongestNetworks(networks []WifiNetwork) []WifiNetwork {
+	strongest := map[string]WifiNetwork{}
+	for _, network := range networks {
+		if network.SSID == "" {
+			continue
+		}
+
+		if existing, found := strongest[network.SSID]; !found || network.Signal > existing.Signal {
+			strongest[network.SSID] = network
+		}
+	}
+
+	retval := []WifiNetwork{}
+	for _, network := range strongest {
+		retval = append(retval, network)
+	}
+
+	sort.Slice(retval, func(i, j int) bool {
+		if retval[i].Signal != retval[j].Signal {
+			return retval[i].Signal > retval[j].Signal
+		}
+		return retval[i].SSID < retval[j].SSID
+	})
+
+	return retval
+}
@@ -0,0 +1,120 @@
+package network_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danesparza/appliance-monitor/network"
+)
+
+//	wpa_cli scan results should be parsed, strongest first, one per SSID
+func TestParseWpaScanResults_ShouldReturnNetworks(t *testing.T) {
+
+	//	Arrange
+	output := "bssid / frequency / signal level / flags / ssid\n" +
+		"a0:b1:c2:d3:e4:f5\t2437\t-42\t[WPA2-PSK-CCMP][ESS]\tHome & Garden\n" +
+		"a0:b1:c2:d3:e4:f7\t2462\t-70\t[WPA2-PSK-CCMP][ESS]\tHome & Garden\n" +
+		"a0:b1:c2:d3:e4:f6\t5180\t-55\t[RSN-SAE-CCMP][ESS]\tHomeNetwork-5G\n" +
+		"10:20:30:40:50:60\t2412\t-71\t[WPA-PSK-TKIP][ESS]\tOld Router\n" +
+		"70:80:90:a0:b0:c0\t2484\t-83\t[ESS]\tCoffeeShop Guest\n" +
+		"70:80:90:a0:b0:c1\t2412\t-60\t[WPA2-PSK-CCMP][ESS]\t\n"
+
+	expected := []network.WifiNetwork{
+		{SSID: "Home & Garden", BSSID: "a0:b1:c2:d3:e4:f5", Signal: -42, Frequency: 2437, Channel: 6, Security: network.SecurityWPA2},
+		{SSID: "HomeNetwork-5G", BSSID: "a0:b1:c2:d3:e4:f6", Signal: -55, Frequency: 5180, Channel: 36, Security: network.SecurityWPA3},
+		{SSID: "Old Router", BSSID: "10:20:30:40:50:60", Signal: -71, Frequency: 2412, Channel: 1, Security: network.SecurityWPA},
+		{SSID: "CoffeeShop Guest", BSSID: "70:80:90:a0:b0:c0", Signal: -83, Frequency: 2484, Channel: 14, Security: network.SecurityOpen},
+	}
+
+	//	Act
+	retval := network.ParseWpaScanResults(output)
+
+	//	Assert
+	if !reflect.DeepEqual(retval, expected) {
+		t.Errorf("Networks don't match what we expect.  Here's what we got:\n%+v", retval)
+	}
+}
+
+//	iw scan output should be parsed, strongest first
+func TestParseIwScan_ShouldReturnNetworks(t *testing.T) {
+
+	//	Arrange
+	output := `BSS a0:b1:c2:d3:e4:f5(on wlan0)
+	TSF: 0 usec (0d, 00:00:00)
+	freq: 2437
+	beacon interval: 100 TUs
+	capability: ESS Privacy ShortSlotTime (0x0411)
+	signal: -42.00 dBm
+	SSID: HomeNetwork
+	DS Parameter set: channel 6
+	RSN:	 * Version: 1
+		 * Group cipher: CCMP
+		 * Pairwise ciphers: CCMP
+		 * Authentication suites: PSK
+BSS a0:b1:c2:d3:e4:f6(on wlan0)
+	freq: 5180
+	capability: ESS Privacy (0x0011)
+	signal: -55.00 dBm
+	SSID: HomeNetwork-5G
+	RSN:	 * Version: 1
+		 * Authentication suites: SAE
+BSS 10:20:30:40:50:60(on wlan0)
+	freq: 2412
+	capability: ESS Privacy (0x0011)
+	signal: -75.00 dBm
+	SSID: Office
+	RSN:	 * Version: 1
+		 * Authentication suites: IEEE 802.1X
+BSS 70:80:90:a0:b0:c0(on wlan0)
+	freq: 2462
+	capability: ESS (0x0001)
+	signal: -83.00 dBm
+	SSID: CoffeeShop Guest
+`
+
+	expected := []network.WifiNetwork{
+		{SSID: "HomeNetwork", BSSID: "a0:b1:c2:d3:e4:f5", Signal: -42, Frequency: 2437, Channel: 6, Security: network.SecurityWPA2},
+		{SSID: "HomeNetwork-5G", BSSID: "a0:b1:c2:d3:e4:f6", Signal: -55, Frequency: 5180, Channel: 36, Security: network.SecurityWPA3},
+		{SSID: "Office", BSSID: "10:20:30:40:50:60", Signal: -75, Frequency: 2412, Channel: 1, Security: network.SecurityEnterprise},
+		{SSID: "CoffeeShop Guest", BSSID: "70:80:90:a0:b0:c0", Signal: -83, Frequency: 2462, Channel: 11, Security: network.SecurityOpen},
+	}
+
+	//	Act
+	retval := network.ParseIwScan(output)
+
+	//	Assert
+	if !reflect.DeepEqual(retval, expected) {
+		t.Errorf("Networks don't match what we expect.  Here's what we got:\n%+v", retval)
+	}
+}
+
+//	Escaped SSIDs in scan output should be read back as they're broadcast
+func TestParseScan_EscapedSSIDs_ShouldBeUnescaped(t *testing.T) {
+
+	//	Arrange
+	wpaOutput := "bssid / frequency / signal level / flags / ssid\n" +
+		"a0:b1:c2:d3:e4:f5\t2437\t-42\t[WPA2-PSK-CCMP][ESS]\tTom & \\\"Jerry\\\"\n" +
+		"a0:b1:c2:d3:e4:f6\t2412\t-55\t[WPA2-PSK-CCMP][ESS]\tCaf\\xc3\\xa9 \\\\ Bar\n"
+
+	iwOutput := "BSS a0:b1:c2:d3:e4:f5(on wlan0)\n" +
+		"\tfreq: 2437\n" +
+		"\tsignal: -42.00 dBm\n" +
+		"\tSSID: Tom & \"Jerry\"\n" +
+		"BSS a0:b1:c2:d3:e4:f6(on wlan0)\n" +
+		"\tfreq: 2412\n" +
+		"\tsignal: -55.00 dBm\n" +
+		"\tSSID: \\x20Caf\\xc3\\xa9 \\x5c Bar\n"
+
+	//	Act
+	wpaNetworks := network.ParseWpaScanResults(wpaOutput)
+	iwNetworks := network.ParseIwScan(iwOutput)
+
+	//	Assert
+	if len(wpaNetworks) != 2 || wpaNetworks[0].SSID != `Tom & "Jerry"` || wpaNetworks[1].SSID != `Café \ Bar` {
+		t.Errorf("wpa_cli SSIDs don't match what we expect.  Here's what we got:\n%+v", wpaNetworks)
+	}
+
+	if len(iwNetworks) != 2 || iwNetworks[0].SSID != `Tom & "Jerry"` || iwNetworks[1].SSID != ` Café \ Bar` {
+		t.Errorf("iw SSIDs don't match what we expect.  Here's what we got:\n%+v", iwNetworks)
+	}
+}
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// How often the wifi connection is checked
+var provisioningCheckInterval = 30 * time.Second
+
+// How often the access point looks for the wifi networks that are set up
+var provisioningScanInterval = 2 * time.Minute
+
+// How long the access point stays up when wifi networks are set up, before
+// the monitor reboots to try them again.  Hidden networks don't show up in a
+// scan, so this is how they get tried
+var provisioningRetry = 30 * time.Minute
+
+// provisioning is 1 while the access point is up
+var provisioning int32
+
+// Provisioning returns true while the monitor is broadcasting its setup
+// network.  It stays in provisioning mode until it reboots
+func Provisioning() bool {
+	return atomic.LoadInt32(&provisioning) == 1
+}
+
+// ServeProvisioning starts provisioning mode when no wifi networks are set
+// up, or the wifi has been disconnected for longer than the 'provisiontimeout'
+// setting.  Web traffic on the setup network is sent to portalPort.  If wifi
+// networks are set up, a reboot is requested once one of them is in range again,
+// or the access point has been up for a while, so an outage doesn't keep the
+// monitor off the network
+func ServeProvisioning(ctx context.Context, configDB *data.ConfigDB, portalPort int, reboot chan bool) {
+	log.Println("[INFO] Starting the provisioning service...")
+
+	//	Clean up after the last time the access point was up:
+	if err := clearAccessPoint(); err != nil {
+		log.Printf("[ERROR] Problem removing the access point config: %v", err)
+	}
+	lastConnected := time.Now()
+
+	for !Provisioning() {
+		supplicant, err := readSupplicant()
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("[ERROR] Problem reading the wifi config: %v", err)
+		}
+
+		reason := ""
+		switch {
+		case err == nil && !WifiConfigured(supplicant), os.IsNotExist(err):
+			reason = "no wifi networks are set up"
+		case wifiConnected():
+			lastConnected = time.Now()
+		default:
+			timeout := provisionTimeout(configDB)
+			if timeout > 0 && time.Since(lastConnected) >= timeout {
+				reason = "the wifi has been disconnected for " + timeout.String()
+			}
+		}
+
+		if reason != "" {
+			log.Printf("[INFO] Starting provisioning mode because %s", reason)
+			if err := startAccessPoint(DefaultAccessPoint(), portalPort); err != nil {
+				log.Printf("[ERROR] Problem starting the access point: %v", err)
+			} else {
+				atomic.StoreInt32(&provisioning, 1)
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("[INFO] Stopping the provisioning service")
+			return
+		case <-time.After(provisioningCheckInterval):
+		}
+	}
+
+	log.Printf("[INFO] Provisioning mode started.  Join the %s wifi network to set up the monitor", DefaultAccessPoint().SSID)
+	started := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[INFO] Stopping the provisioning service")
+			return
+		case <-time.After(provisioningScanInterval):
+		}
+
+		if reason := leaveProvisioningReason(started); reason != "" {
+			log.Printf("[INFO] Requesting a reboot to leave provisioning mode because %s", reason)
+			reboot <- true
+			return
+		}
+	}
+}
+
+// leaveProvisioningReason gets why the monitor should go back to the wifi
+// networks that are set up.  It's blank if it should stay in provisioning
+// mode.  Without any networks, it stays until the wifi is set up
+func leaveProvisioningReason(started time.Time) string {
+	config, err := GetWifiConfig()
+	if err != nil {
+		log.Printf("[ERROR] Problem reading the wifi config: %v", err)
+		return ""
+	}
+
+	if len(config.Networks) == 0 {
+		return ""
+	}
+
+	if time.Since(started) >= provisioningRetry {
+		return "the access point has been up for " + provisioningRetry.String()
+	}
+
+	networks, err := ScanWifi()
+	if err != nil {
+		log.Printf("[WARN] Problem scanning for the wifi networks that are set up: %v", err)
+		return ""
+	}
+
+	for _, found := range networks {
+		for _, configured := range config.Networks {
+			if found.SSID == configured.SSID {
+				return configured.SSID + " is in range"
+			}
+		}
+	}
+
+	return ""
+}
+
+// provisionTimeout gets the 'provisiontimeout' setting
+func provisionTimeout(configDB *data.ConfigDB) time.Duration {
+	item, err := configDB.Get("provisiontimeout")
+	if err != nil {
+		log.Printf("[WARN] Problem getting provisiontimeout: %v", err)
+	}
+
+	minutes, err := strconv.Atoi(item.Value)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
@@ -4,9 +4,16 @@ package network
 
 import "log"
 
-// UpdateWifiCredentials changes the hostname for the local machine
-func UpdateWifiCredentials(ssid, password string, reboot chan bool) error {
-	log.Printf("[INFO] Not running on Linux/ARM.  Updating the wifi credentials.\nNew SSID: %v\nNew Password: %v\n", ssid, password)
+// UpdateWifiConfig saves the wifi setup and reboots.  The change is verified
+// after the reboot, and rolled back if the monitor can't connect
+func UpdateWifiConfig(config WifiConfig, reboot chan bool) error {
+	if _, err := FormatWifiConfig(config); err != nil {
+		return err
+	}
+
+	for _, network := range config.Networks {
+		log.Printf("[INFO] Not running on Linux/ARM.  Updating the wifi config.  Network: %v\n", network.SSID)
+	}
 
 	log.Println("[INFO] Requesting a reboot because of wifi changes")
 	reboot <- true
@@ -1,25 +1,26 @@
 package network
 
-import (
-	"io/ioutil"
-	"log"
-)
+import "log"
 
-// UpdateWifiCredentials updates the ssid and password used
-func UpdateWifiCredentials(ssid, password string, reboot chan bool) error {
-	log.Printf("[INFO] Updating the wifi credentials.\nNew SSID: %v\nNew Password: %v\n", ssid, password)
+// UpdateWifiConfig saves the wifi setup and reboots.  The change is verified
+// after the reboot, and rolled back if the monitor can't connect
+func UpdateWifiConfig(config WifiConfig, reboot chan bool) error {
+	for _, network := range config.Networks {
+		log.Printf("[INFO] Updating the wifi config.  Network: %v\n", network.SSID)
+	}
 
 	//	Get the formatted config file
-	formattedConfig, err := FormatWifiCredentials(ssid, password)
+	formattedConfig, err := FormatWifiConfig(config)
 	if err != nil {
-		log.Printf("[ERROR] Formatting wifi credentials: %v", err.Error())
+		log.Printf("[ERROR] Formatting wifi config: %v", err.Error())
 		return err
 	}
 
-	//	Save the formatted config file
-	err = ioutil.WriteFile("/etc/wpa_supplicant/wpa_supplicant.conf", []byte(formattedConfig), 0600)
+	//	Save the formatted config file, keeping the old one in case the
+	//	monitor can't connect after the reboot
+	err = DefaultChangeJournal.Stage(ChangeWifi, map[string][]byte{wifiSupplicantPath: []byte(formattedConfig)})
 	if err != nil {
-		log.Printf("[ERROR] Problem writing /etc/wpa_supplicant/wpa_supplicant.conf: %v", err.Error())
+		log.Printf("[ERROR] Problem writing %s: %v", wifiSupplicantPath, err.Error())
 		return err
 	}
 
@@ -0,0 +1,17 @@
+// +build !linux !arm
+
+package network
+
+import "log"
+
+// ScanWifi scans for wifi networks.  Off the Pi, it returns some example networks
+func ScanWifi() ([]WifiNetwork, error) {
+	log.Println("[INFO] Not running on Linux/ARM, so returning example wifi networks...")
+
+	return []WifiNetwork{
+		{SSID: "HomeNetwork", BSSID: "a0:b1:c2:d3:e4:f5", Signal: -42, Frequency: 2437, Channel: 6, Security: SecurityWPA2},
+		{SSID: "HomeNetwork-5G", BSSID: "a0:b1:c2:d3:e4:f6", Signal: -55, Frequency: 5180, Channel: 36, Security: SecurityWPA3},
+		{SSID: "Neighbors", BSSID: "10:20:30:40:50:60", Signal: -71, Frequency: 2412, Channel: 1, Security: SecurityWPA2},
+		{SSID: "CoffeeShop Guest", BSSID: "70:80:90:a0:b0:c0", Signal: -83, Frequency: 2462, Channel: 11, Security: SecurityOpen},
+	}, nil
+}
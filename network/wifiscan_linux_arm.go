@@ -0,0 +1,37 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// How long to wait for wpa_supplicant to finish a scan
+var wifiScanWait = 3 * time.Second
+
+// ScanWifi scans for wifi networks.  It asks wpa_supplicant, or the driver if
+// wpa_supplicant isn't running (like in provisioning mode)
+func ScanWifi() ([]WifiNetwork, error) {
+	output, err := exec.Command("wpa_cli", "-i", WifiInterface, "scan").CombinedOutput()
+
+	//	A scan that's already going is fine -- we'll get its results:
+	if err == nil && (!strings.Contains(string(output), "FAIL") || strings.Contains(string(output), "FAIL-BUSY")) {
+		time.Sleep(wifiScanWait)
+
+		output, err = exec.Command("wpa_cli", "-i", WifiInterface, "scan_results").Output()
+		if err == nil {
+			return ParseWpaScanResults(string(output)), nil
+		}
+	}
+
+	log.Printf("[INFO] wpa_supplicant couldn't scan, so scanning with iw: %s", strings.TrimSpace(string(output)))
+
+	output, err = exec.Command("iw", "dev", WifiInterface, "scan", "ap-force").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Problem scanning for wifi networks: %v %s", err, output)
+	}
+
+	return ParseIwScan(string(output)), nil
+}
@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"sync"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/gregdel/pushover"
+)
+
+// How long to wait for a webhook to answer
+var webhookTimeout = 10 * time.Second
+
+// How long an email can take to send
+var emailTimeout = 30 * time.Second
+
+// How many notifications can wait to be sent
+var queueSize = 100
+
+var (
+	queue      chan queuedMessage
+	startQueue sync.Once
+)
+
+// queuedMessage is a notification waiting to be sent
+type queuedMessage struct {
+	configDB *data.ConfigDB
+	event    data.EventType
+	message  Message
+}
+
+// Message is a notification about a device.  It's also the body sent to webhooks
+type Message struct {
+	DeviceID   string    `json:"deviceId"`
+	DeviceName string    `json:"devicename"`
+	Event      string    `json:"event"`
+	Text       string    `json:"message"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Send sends the message to everyone who should hear about the event: the
+// 'pushoverrecipient' setting (for finished cycles), and subscribers who want
+// it and aren't in their quiet hours.  Problems are logged, not returned, so
+// one bad subscriber doesn't stop the rest
+func Send(configDB *data.ConfigDB, event data.EventType, message Message) {
+	message.Event = event.String()
+
+	for _, recipient := range Recipients(configDB, message.DeviceID, event, message.Timestamp) {
+		if err := SendTo(configDB, recipient.Channel, recipient.Target, message); err != nil {
+			log.Printf("[WARN] Problem sending %s notification to %s: %v\n", recipient.Channel, recipient.Name, err)
+		}
+	}
+}
+
+// Queue sends the message in the background, like Send, so slow notification
+// services don't hold up the caller.  Messages are sent in the order they're
+// queued.  If too many are waiting, the message is dropped and logged
+func Queue(configDB *data.ConfigDB, event data.EventType, message Message) {
+	startQueue.Do(func() {
+		queue = make(chan queuedMessage, queueSize)
+		go func() {
+			for queued := range queue {
+				Send(queued.configDB, queued.event, queued.message)
+			}
+		}()
+	})
+
+	select {
+	case queue <- queuedMessage{configDB: configDB, event: event, message: message}:
+	default:
+		log.Printf("[WARN] Too many notifications are waiting to be sent.  Dropping: %s\n", message.Text)
+	}
+}
+
+// Recipients gets everyone who should hear about the event for the device at
+// the given time.  Each destination is only included once
+func Recipients(configDB *data.ConfigDB, deviceID string, event data.EventType, when time.Time) []data.Subscriber {
+	retval := []data.Subscriber{}
+	seen := map[string]bool{}
+
+	add := func(recipient data.Subscriber) {
+		key := recipient.Channel + ":" + recipient.Target
+		if recipient.Target != "" && !seen[key] {
+			seen[key] = true
+			retval = append(retval, recipient)
+		}
+	}
+
+	//	The household recipient:
+	if event == data.ApplianceStopped {
+		pushTo, _ := configDB.Get("pushoverrecipient")
+		add(data.Subscriber{Name: "pushoverrecipient", Channel: data.ChannelPushover, Target: pushTo.Value})
+	}
+
+	//	Subscribers:
+	subscribers, err := configDB.GetAllSubscribers()
+	if err != nil {
+		log.Printf("[WARN] Problem getting subscribers to notify: %v\n", err)
+	}
+
+	for _, subscriber := range subscribers {
+		if subscriber.Wants(deviceID, event) && !subscriber.QuietHours.Contains(when) {
+			add(subscriber)
+		}
+	}
+
+	return retval
+}
+
+// SendTo sends the message on a single channel
+func SendTo(configDB *data.ConfigDB, channel, target string, message Message) error {
+	switch channel {
+	case data.ChannelPushover:
+		return sendPushover(configDB, target, message)
+	case data.ChannelEmail:
+		return sendEmail(configDB, target, message)
+	case data.ChannelWebhook:
+		return sendWebhook(target, message)
+	}
+
+	return fmt.Errorf("Unknown channel: %s", channel)
+}
+
+// sendPushover sends the message to a Pushover user key
+func sendPushover(configDB *data.ConfigDB, userKey string, message Message) error {
+	pushAPIkey, err := configDB.Get("pushoverapikey")
+	if err != nil {
+		return err
+	}
+
+	if pushAPIkey.Value == "" {
+		return errors.New("The pushoverapikey setting isn't set")
+	}
+
+	pushClient := pushover.New(pushAPIkey.Value)
+	recipient := pushover.NewRecipient(userKey)
+	pushMessage := pushover.NewMessage(message.Text)
+	pushMessage.Sound = "bike"
+
+	_, err = pushClient.SendMessage(pushMessage, recipient)
+	return err
+}
+
+// sendEmail sends the message to an email address using the 'smtp' settings
+func sendEmail(configDB *data.ConfigDB, address string, message Message) error {
+	server, _ := configDB.Get("smtpserver")
+	username, _ := configDB.Get("smtpusername")
+	password, _ := configDB.Get("smtppassword")
+	from, _ := configDB.Get("smtpfrom")
+
+	if server.Value == "" {
+		return errors.New("The smtpserver setting isn't set")
+	}
+
+	var auth smtp.Auth
+	if username.Value != "" {
+		host, _, err := net.SplitHostPort(server.Value)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", username.Value, password.Value, host)
+	}
+
+	//	Parse the addresses and encode the subject, so nothing can add
+	//	its own headers:
+	sender, err := mail.ParseAddress(from.Value)
+	if err != nil {
+		return fmt.Errorf("Invalid smtpfrom setting: %s", from.Value)
+	}
+
+	to, err := mail.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("Invalid email address: %s", address)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", sender)
+	fmt.Fprintf(&body, "To: %s\r\n", to)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.DeviceName+" "+message.Event))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n", message.Text)
+
+	return sendMail(server.Value, auth, sender.Address, to.Address, body.Bytes())
+}
+
+// sendMail sends an email like smtp.SendMail, but gives up if the server
+// takes longer than emailTimeout
+func sendMail(server string, auth smtp.Auth, from, to string, body []byte) error {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", server, emailTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("The SMTP server doesn't support authentication")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// sendWebhook posts the message as JSON to a url
+func sendWebhook(url string, message Message) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	response, err := client.Post(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("Webhook returned %s", response.Status)
+	}
+
+	return nil
+}
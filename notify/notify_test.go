@@ -0,0 +1,233 @@
+package notify_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/notify"
+)
+
+//	Recipients should respect subscriptions and quiet hours, and only include each destination once
+func TestNotify_Recipients_FiltersAndRemovesDuplicates(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".key")
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	db.Set(data.ConfigItem{Name: "pushoverrecipient", Value: "household"})
+	db.AddOrUpdateUser(data.User{Username: "kim", Role: data.RoleOperator}, "kims password")
+
+	db.AddOrUpdateSubscriber(data.Subscriber{Name: "Sam", Channel: data.ChannelPushover, Target: "household"})
+	db.AddOrUpdateSubscriber(data.Subscriber{Name: "Kim", Username: "kim", Channel: data.ChannelEmail, Target: "kim@example.com", Events: []string{"running"}})
+	db.AddOrUpdateSubscriber(data.Subscriber{Name: "Lee", Channel: data.ChannelWebhook, Target: "http://example.com/hook", QuietHours: data.QuietHours{Start: "22:00", End: "07:00"}})
+
+	day := time.Date(2017, 6, 1, 12, 0, 0, 0, time.Local)
+	night := time.Date(2017, 6, 1, 23, 0, 0, 0, time.Local)
+
+	//	Act
+	stoppedDay := notify.Recipients(db, "washer", data.ApplianceStopped, day)
+	stoppedNight := notify.Recipients(db, "washer", data.ApplianceStopped, night)
+	running := notify.Recipients(db, "washer", data.ApplianceRunning, day)
+
+	//	Assert
+	if targets := recipientTargets(stoppedDay); len(targets) != 2 || targets[0] != "household" || targets[1] != "http://example.com/hook" {
+		t.Errorf("Recipients failed: Expected the household and Lee when the washer stops, but got %v", targets)
+	}
+
+	if targets := recipientTargets(stoppedNight); len(targets) != 1 || targets[0] != "household" {
+		t.Errorf("Recipients failed: Lee should be in quiet hours, but got %v", targets)
+	}
+
+	if targets := recipientTargets(running); len(targets) != 1 || targets[0] != "kim@example.com" {
+		t.Errorf("Recipients failed: Only Kim is subscribed to starts, but got %v", targets)
+	}
+}
+
+//	Webhooks should get the message as JSON
+func TestNotify_SendTo_Webhook_PostsMessage(t *testing.T) {
+	//	Arrange
+	received := make(chan notify.Message, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		message := notify.Message{}
+		json.NewDecoder(req.Body).Decode(&message)
+		received <- message
+	}))
+	defer server.Close()
+
+	message := notify.Message{DeviceID: "washer", DeviceName: "Washer", Event: "stopped", Text: "Washer has finished running"}
+
+	//	Act
+	err := notify.SendTo(nil, data.ChannelWebhook, server.URL, message)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("SendTo failed: Should have posted to the webhook without error: %v", err)
+	}
+
+	if response := <-received; response.DeviceID != "washer" || response.Text != message.Text {
+		t.Errorf("SendTo failed: The webhook got the wrong message: %+v", response)
+	}
+}
+
+//	Device names shouldn't be able to add their own email headers
+func TestNotify_SendTo_Email_EncodesSubject(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".key")
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't start the SMTP server: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go fakeSMTPServer(listener, received)
+
+	db.Set(data.ConfigItem{Name: "smtpserver", Value: listener.Addr().String()})
+	db.Set(data.ConfigItem{Name: "smtpfrom", Value: "monitor@example.com"})
+
+	message := notify.Message{DeviceName: "Washer\r\nBcc: everyone@example.com", Event: "stopped", Text: "Washer has finished running"}
+
+	//	Act
+	err = notify.SendTo(db, data.ChannelEmail, "Sam <sam@example.com>", message)
+	injectedErr := notify.SendTo(db, data.ChannelEmail, "sam@example.com\r\nBcc: everyone@example.com", message)
+
+	//	Assert
+	if err != nil {
+		t.Fatalf("SendTo failed: Should have sent the email without error: %v", err)
+	}
+
+	email := <-received
+	if strings.Contains(email, "\r\nBcc:") {
+		t.Errorf("SendTo failed: The device name added a header:\n%v", email)
+	}
+
+	if !strings.Contains(email, "\r\nTo: \"Sam\" <sam@example.com>\r\n") {
+		t.Errorf("SendTo failed: Should have sent the email to Sam:\n%v", email)
+	}
+
+	if injectedErr == nil {
+		t.Errorf("SendTo failed: Should have returned an error for an address with a header in it")
+	}
+}
+
+// fakeSMTPServer accepts one email and sends back what was sent
+func fakeSMTPServer(listener net.Listener, received chan string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 localhost\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "DATA"):
+			fmt.Fprint(conn, "354 Go ahead\r\n")
+
+			var email bytes.Buffer
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				email.WriteString(line)
+			}
+			received <- email.String()
+			fmt.Fprint(conn, "250 OK\r\n")
+		case strings.HasPrefix(command, "QUIT"):
+			fmt.Fprint(conn, "221 Bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 OK\r\n")
+		}
+	}
+}
+
+//	Queued messages should be sent in the background, in order
+func TestNotify_Queue_SendsInBackground(t *testing.T) {
+	//	Arrange
+	filename := "testing.db"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".key")
+
+	db, err := data.OpenConfigDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	received := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		message := notify.Message{}
+		json.NewDecoder(req.Body).Decode(&message)
+		received <- message.Text
+	}))
+	defer server.Close()
+
+	db.AddOrUpdateSubscriber(data.Subscriber{Name: "Lee", Channel: data.ChannelWebhook, Target: server.URL, Events: []string{"running", "stopped"}})
+
+	//	Act
+	start := time.Now()
+	notify.Queue(db, data.ApplianceRunning, notify.Message{DeviceID: "washer", Text: "Washer started running", Timestamp: start})
+	notify.Queue(db, data.ApplianceStopped, notify.Message{DeviceID: "washer", Text: "Washer has finished running", Timestamp: start})
+	queued := time.Since(start)
+
+	//	Assert
+	if queued > 100*time.Millisecond {
+		t.Errorf("Queue failed: Shouldn't have waited for the webhook, but took %v", queued)
+	}
+
+	for _, expected := range []string{"Washer started running", "Washer has finished running"} {
+		select {
+		case text := <-received:
+			if text != expected {
+				t.Errorf("Queue failed: Expected '%s', but got '%s'", expected, text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Queue failed: Never sent '%s'", expected)
+		}
+	}
+}
+
+//	recipientTargets lists where each recipient's notifications go
+func recipientTargets(recipients []data.Subscriber) []string {
+	retval := []string{}
+	for _, recipient := range recipients {
+		retval = append(retval, recipient.Target)
+	}
+
+	return retval
+}
@@ -0,0 +1,130 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// How often old activity is pruned
+var pruneInterval = 24 * time.Hour
+
+// Policy describes how much activity to keep.  Zero means no limit
+type Policy struct {
+	// MaxAge is how long activity is kept
+	MaxAge time.Duration
+
+	// MaxEntries is how many activities are kept for each device
+	MaxEntries int
+}
+
+// Serve prunes old activity once a day, and compacts the activity database
+// when pruning has left a lot of it unused
+func Serve(ctx context.Context, store *data.Store) {
+	log.Println("[INFO] Starting the retention service...")
+
+	for {
+		policy := GetPolicy(store.Config)
+		if err := Prune(store.Activity, policy, time.Now()); err != nil {
+			log.Printf("[ERROR] Problem pruning activity: %v", err)
+		}
+
+		compact(store.Activity)
+
+		select {
+		case <-ctx.Done():
+			log.Println("[INFO] Stopping the retention service")
+			return
+		case <-time.After(pruneInterval):
+		}
+	}
+}
+
+// GetPolicy gets the retention policy from the 'retentiondays' and
+// 'retentionmaxentries' config items
+func GetPolicy(configDB *data.ConfigDB) Policy {
+	days := setting(configDB, "retentiondays")
+	entries := setting(configDB, "retentionmaxentries")
+
+	return Policy{
+		MaxAge:     time.Duration(days) * 24 * time.Hour,
+		MaxEntries: entries,
+	}
+}
+
+// Prune removes the activity the policy doesn't keep.  Cycles aren't
+// touched, so energy and cost stats still add up after the events are gone
+func Prune(activityDB *data.ActivityDB, policy Policy, now time.Time) error {
+	deviceIDs, err := activityDB.GetDeviceIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, deviceID := range deviceIDs {
+		//	Remove anything too old:
+		if policy.MaxAge > 0 {
+			if err := activityDB.DeleteRange(deviceID, time.Time{}, now.Add(-policy.MaxAge)); err != nil {
+				return err
+			}
+		}
+
+		//	Remove anything older than the newest entries we keep:
+		if policy.MaxEntries > 0 {
+			oldest, err := activityDB.NewestTimestamp(deviceID, policy.MaxEntries)
+			if err != nil {
+				return err
+			}
+
+			if !oldest.IsZero() {
+				if err := activityDB.DeleteRange(deviceID, time.Time{}, oldest.Add(-time.Nanosecond)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// compact compacts the activity database if at least a quarter of it is unused
+func compact(activityDB *data.ActivityDB) {
+	free, size, err := activityDB.FreeSpace()
+	if err != nil {
+		log.Printf("[ERROR] Problem getting activity database free space: %v", err)
+		return
+	}
+
+	if free*4 < size {
+		return
+	}
+
+	before, after, err := activityDB.Compact()
+	if err != nil {
+		log.Printf("[ERROR] Problem compacting the activity database: %v", err)
+		return
+	}
+
+	log.Printf("[INFO] Compacted the activity database from %v to %v bytes", before, after)
+}
+
+// setting gets a number from a config item.  Invalid items get the schema default
+func setting(configDB *data.ConfigDB, name string) int {
+	schema, _ := data.LookupSetting(name)
+	defaultValue, _ := strconv.Atoi(schema.Default)
+
+	item, err := configDB.Get(name)
+	if err != nil || item.Value == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(item.Value)
+	if err != nil || schema.Validate(item.Value) != nil {
+		log.Printf("[WARN] Invalid %s setting: %v.  Using %v", name, item.Value, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
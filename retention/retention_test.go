@@ -0,0 +1,86 @@
+package retention_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/retention"
+)
+
+func TestRetention_Prune_MaxAge_RemovesOldActivityButKeepsCycles(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	db.Add(data.Activity{DeviceID: "washer", Timestamp: now.Add(-72 * time.Hour), Type: data.ApplianceRunning})
+	db.Add(data.Activity{DeviceID: "washer", Timestamp: now.Add(-71 * time.Hour), Type: data.ApplianceStopped})
+	db.Add(data.Activity{DeviceID: "washer", Timestamp: now.Add(-1 * time.Hour), Type: data.ApplianceRunning})
+	db.AddCycle(data.Cycle{DeviceID: "washer", StartTime: now.Add(-72 * time.Hour), EndTime: now.Add(-71 * time.Hour), EnergyWh: 500})
+
+	//	Act
+	err = retention.Prune(db, retention.Policy{MaxAge: 48 * time.Hour}, now)
+	activity, _ := db.GetAllActivity("washer")
+	cycles, _ := db.GetCycles("washer", now.Add(-96*time.Hour), now)
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Prune failed: Should have pruned without error: %v", err)
+	}
+
+	if len(activity) != 1 {
+		t.Errorf("Prune failed: Should have kept 1 item.  Instead, got %v", len(activity))
+	}
+
+	if len(cycles) != 1 {
+		t.Errorf("Prune failed: Should have kept the cycle.  Instead, got %v", len(cycles))
+	}
+}
+
+func TestRetention_Prune_MaxEntries_KeepsNewestForEachDevice(t *testing.T) {
+	//	Arrange
+	filename := "testactivity.db"
+	defer os.Remove(filename)
+
+	db, err := data.OpenActivityDB(filename, time.Second)
+	if err != nil {
+		t.Fatalf("Couldn't open the database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		db.Add(data.Activity{DeviceID: "washer", Timestamp: now.Add(time.Duration(-i) * time.Minute), Type: data.ApplianceRunning})
+	}
+	db.Add(data.Activity{DeviceID: "dryer", Timestamp: now.Add(-1 * time.Hour), Type: data.ApplianceRunning})
+
+	//	Act
+	err = retention.Prune(db, retention.Policy{MaxEntries: 2}, now)
+	washer, _ := db.GetAllActivity("washer")
+	dryer, _ := db.GetAllActivity("dryer")
+
+	//	Assert
+	if err != nil {
+		t.Errorf("Prune failed: Should have pruned without error: %v", err)
+	}
+
+	if len(washer) != 2 {
+		t.Fatalf("Prune failed: Should have kept 2 items.  Instead, got %v", len(washer))
+	}
+
+	if !washer[1].Timestamp.Equal(now.Add(-1 * time.Minute)) {
+		t.Errorf("Prune failed: Should have kept the newest items.  Got %+v", washer)
+	}
+
+	if len(dryer) != 1 {
+		t.Errorf("Prune failed: Shouldn't have touched a device under the limit.  Got %v items", len(dryer))
+	}
+}
@@ -8,20 +8,33 @@ import (
 	"os"
 	"time"
 
-	"github.com/spf13/viper"
+	"github.com/danesparza/appliance-monitor/data"
 )
 
-// CollectAndProcess performs the sensor data collection and data processing
-func CollectAndProcess(ctx context.Context) {
+// CollectAndProcess performs the sensor data collection and data processing.
+// The devices are reloaded when deviceUpdated is signaled
+func CollectAndProcess(ctx context.Context, store *data.Store, deviceUpdated chan bool) {
 	log.Println("[INFO] Running on a platform other than Linux/ARM, so this will be boring...")
 
-	//	Connect to the datastores:
-	log.Printf("[INFO] Config database: %s\n", viper.GetString("datastore.config"))
-	log.Printf("[INFO] Activities database: %s\n", viper.GetString("datastore.activity"))
+	//	Use the shared datastores:
+	configDB := store.Config
+	activityDB := store.Activity
 
 	hostname, _ := os.Hostname()
 	log.Printf("[INFO] Using hostname %v...", hostname)
 
+	//	Smart plugs are on the network, so they can be monitored from anywhere:
+	superviseMonitors(ctx, configDB, deviceUpdated, map[string]monitorFunc{
+		data.DeviceTypeAmon: monitorDummy,
+		data.DeviceTypeHS110: func(ctx context.Context, device data.Device) {
+			monitorPower(ctx, configDB, activityDB, device)
+		},
+	})
+}
+
+// monitorDummy pretends the device starts and stops every few seconds
+func monitorDummy(ctx context.Context, device data.Device) {
+
 	//	Keep track of state of device
 	currentlyRunning := false
 
@@ -35,10 +48,10 @@ func CollectAndProcess(ctx context.Context) {
 			//	Dummy activity:
 			if !currentlyRunning {
 				//	We should actually log to the activity datastore:
-				WsHub.Broadcast <- []byte("Appliance state: running")
+				WsHub.BroadcastActivity(device.Name, data.Activity{Type: data.ApplianceRunning, DeviceID: device.ID, Timestamp: time.Now()})
 				currentlyRunning = true
 			} else {
-				WsHub.Broadcast <- []byte("Appliance state: stopped")
+				WsHub.BroadcastActivity(device.Name, data.Activity{Type: data.ApplianceStopped, DeviceID: device.ID, Timestamp: time.Now()})
 				currentlyRunning = false
 			}
 
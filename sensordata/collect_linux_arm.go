@@ -1,35 +1,29 @@
 package sensordata
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/danesparza/appliance-monitor/data"
-	"github.com/gregdel/pushover"
 	influxdb "github.com/influxdata/influxdb/client/v2"
 	"github.com/montanaflynn/stats"
-	"github.com/spf13/viper"
 
 	"github.com/danesparza/embd/sensor/envirophat"
 	"github.com/kidoman/embd"
 	_ "github.com/kidoman/embd/host/rpi" // This loads the RPi driver
 )
 
-// CollectAndProcess performs the sensor data collection and data processing
-func CollectAndProcess(ctx context.Context) {
-	//	Connect to the datastores:
-	log.Printf("[INFO] Config database: %s\n", viper.GetString("datastore.config"))
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
-	log.Printf("[INFO] Activities database: %s\n", viper.GetString("datastore.activity"))
-	activityDB := data.ActivityDB{
-		Database: viper.GetString("datastore.activity")}
+// The I2C bus the envirophat is attached to
+const defaultI2CBus = 1
+
+// CollectAndProcess performs the sensor data collection and data processing.
+// The devices are reloaded when deviceUpdated is signaled
+func CollectAndProcess(ctx context.Context, store *data.Store, deviceUpdated chan bool) {
+	//	Use the shared datastores:
+	configDB := store.Config
+	activityDB := store.Activity
 
 	//	Initialize GPIO / I2C / etc
 	log.Println("[INFO] Initializing GPIO...")
@@ -55,9 +49,6 @@ func CollectAndProcess(ctx context.Context) {
 	}
 	defer embd.CloseI2C()
 
-	bus := embd.NewI2CBus(1)
-	sensor := envirophat.New(bus)
-
 	hostname, _ := os.Hostname()
 	log.Printf("[INFO] Using hostname %v...", hostname)
 
@@ -69,20 +60,49 @@ func CollectAndProcess(ctx context.Context) {
 	}
 	c, _ := influxdb.NewHTTPClient(influxdb.HTTPConfig{Addr: influxURL.Value})
 
+	//	Monitor each vibration sensor and smart plug
+	superviseMonitors(ctx, configDB, deviceUpdated, map[string]monitorFunc{
+		data.DeviceTypeAmon: func(ctx context.Context, device data.Device) {
+			monitorVibration(ctx, configDB, activityDB, device, pin, c, influxURL.Value, hostname)
+		},
+		data.DeviceTypeHS110: func(ctx context.Context, device data.Device) {
+			monitorPower(ctx, configDB, activityDB, device)
+		},
+	})
+}
+
+// monitorVibration watches the accelerometer for the device and tracks when it starts and stops
+func monitorVibration(ctx context.Context, configDB *data.ConfigDB, activityDB *data.ActivityDB, device data.Device, pin embd.DigitalPin, c influxdb.Client, influxURL, hostname string) {
+
+	//	Each sensor gets its own bus:
+	busNumber := device.I2CBus
+	if busNumber == 0 {
+		busNumber = defaultI2CBus
+	}
+	bus := embd.NewI2CBus(byte(busNumber))
+	sensor := envirophat.New(bus)
+
+	//	Get the settings for the device:
+	points := windowSize(device)
+	threshold := float64(device.Threshold)
+	log.Printf("[INFO] Monitoring %v on I2C bus %v using %v samples with threshold %v", device.Name, busNumber, points, threshold)
+
 	//	Keep track of the axis values
 	var xaxis, yaxis, zaxis []float64
 	var xdev, ydev, zdev []float64
 
 	//	Keep track of state of device
-	currentlyRunning := false
-	timeStart := time.Now()
+	currentlyRunning, timeStart := resumeState(activityDB, device)
+
+	//	Wait longer between reads while the sensor is failing:
+	delay := sampleInterval
 
 	//	Loop and respond to channels:
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(1 * time.Second):
+		case <-time.After(delay):
 			//	Turn the LED on
 			pin.Write(embd.High)
 
@@ -92,8 +112,15 @@ func CollectAndProcess(ctx context.Context) {
 			//	Get accelerometer values from the sensor
 			x, y, z, err := sensor.Accelerometer()
 			if err != nil {
-				log.Fatal(err)
+				delay *= 2
+				if delay > maxReadBackoff {
+					delay = maxReadBackoff
+				}
+				log.Printf("[ERROR] Reading the accelerometer for %v.  Trying again in %v: %v", device.Name, delay, err)
+				pin.Write(embd.Low)
+				continue
 			}
+			delay = sampleInterval
 
 			//	Track the measurements
 			xaxis = append(xaxis, x)
@@ -120,36 +147,36 @@ func CollectAndProcess(ctx context.Context) {
 			zdev = append(zdev, zdevcurrent)
 
 			//	Keep a rolling collection of data...
-			//	If we already have maxPoints items
-			//	remove the first item:
-			if len(xaxis) > maxPoints {
-				xaxis = xaxis[1:]
+			//	If we already have more than the window size,
+			//	remove the oldest items:
+			if len(xaxis) > points {
+				xaxis = xaxis[len(xaxis)-points:]
 			}
 
-			if len(yaxis) > maxPoints {
-				yaxis = yaxis[1:]
+			if len(yaxis) > points {
+				yaxis = yaxis[len(yaxis)-points:]
 			}
 
-			if len(zaxis) > maxPoints {
-				zaxis = zaxis[1:]
+			if len(zaxis) > points {
+				zaxis = zaxis[len(zaxis)-points:]
 			}
 
-			if len(zdev) > maxPoints {
-				xdev = xdev[1:]
+			if len(xdev) > points {
+				xdev = xdev[len(xdev)-points:]
 			}
 
-			if len(ydev) > maxPoints {
-				ydev = ydev[1:]
+			if len(ydev) > points {
+				ydev = ydev[len(ydev)-points:]
 			}
 
-			if len(zdev) > maxPoints {
-				zdev = zdev[1:]
+			if len(zdev) > points {
+				zdev = zdev[len(zdev)-points:]
 			}
 
 			/***************************
 				INFLUXDB DEBUGGING
 			****************************/
-			if influxURL.Value != "" {
+			if influxURL != "" {
 				// Create a new point batch
 				bp, err := influxdb.NewBatchPoints(influxdb.BatchPointsConfig{
 					Database:  "sensors",
@@ -160,7 +187,7 @@ func CollectAndProcess(ctx context.Context) {
 				}
 
 				// Create a point and add to batch
-				tags := map[string]string{"host": hostname}
+				tags := map[string]string{"host": hostname, "device": device.ID}
 				fields := map[string]interface{}{
 					"x":    x,
 					"y":    y,
@@ -184,42 +211,18 @@ func CollectAndProcess(ctx context.Context) {
 			/*********************************
 				EVENT: MACHINE STARTED
 			**********************************/
-			if ((xdevcurrent * 1000) > applianceRunThreshold) && ((ydevcurrent * 1000) > applianceRunThreshold) && ((zdevcurrent * 1000) > applianceRunThreshold) && currentlyRunning == false {
-				log.Println("[DEBUG] Looks like the machine is running")
-				WsHub.Broadcast <- []byte("Appliance state: running")
-
+			if ((xdevcurrent * 1000) > threshold) && ((ydevcurrent * 1000) > threshold) && ((zdevcurrent * 1000) > threshold) && currentlyRunning == false {
 				currentlyRunning = true
-				timeStart = time.Now()
-
-				//	Track the activity:
-				newActivity := data.Activity{Type: data.ApplianceRunning, Timestamp: time.Now()}
-				activityDB.Add(newActivity)
-				trackActivity(newActivity, configDB)
+				timeStart = deviceStarted(configDB, activityDB, device)
 			}
 
 			/*********************************
 				EVENT: MACHINE STOPPED
 			**********************************/
-			if ((xdevcurrent * 1000) < applianceRunThreshold) && ((ydevcurrent * 1000) < applianceRunThreshold) && ((zdevcurrent * 1000) < applianceRunThreshold) && currentlyRunning == true {
-				log.Println("[DEBUG] Looks like the machine is stopped")
-				WsHub.Broadcast <- []byte("Appliance state: stopped")
-
+			//	(A resumed cycle needs a full window before it can look stopped)
+			if len(xdev) >= points && ((xdevcurrent * 1000) < threshold) && ((ydevcurrent * 1000) < threshold) && ((zdevcurrent * 1000) < threshold) && currentlyRunning == true {
 				currentlyRunning = false
-
-				//	Calculate the run time:
-				runningTime := time.Since(timeStart)
-
-				//	Track the activity:
-				newActivity := data.Activity{Type: data.ApplianceStopped, Timestamp: time.Now()}
-				activityDB.Add(newActivity)
-				trackActivity(newActivity, configDB)
-
-				// Send a Pushover message
-				err := sendPushoverNotification(configDB, int(runningTime.Minutes()))
-				if err != nil {
-					log.Printf("[WARN] Problem sending pushover message: %v\n", err)
-				}
-
+				deviceStopped(configDB, activityDB, device, timeStart, 0)
 			}
 
 			//	Turn the LED off
@@ -235,58 +238,3 @@ func resetPin(pin embd.DigitalPin) {
 	}
 	pin.Close()
 }
-
-// Track the activity in the cloud
-func trackActivity(activity data.Activity, c data.ConfigDB) error {
-	url := "https://api.appliance-monitor.com/v1/activity"
-
-	//	Get the deviceID:
-	deviceID, _ := c.Get("deviceID")
-
-	//	Serialize to JSON
-	cloudActivity := data.CloudActivity{
-		DeviceID:  deviceID.Value,
-		Timestamp: activity.Timestamp,
-		Type:      activity.Type}
-
-	jsonStr, err := json.Marshal(cloudActivity)
-	if err != nil {
-		log.Printf("[WARN] Problem marshalling cloud activity message: %v\n", err)
-	}
-
-	//	Create a request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-
-	//	Set our headers
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-
-	//	Execute the request
-	client := &http.Client{}
-	_, err = client.Do(req)
-
-	return err
-}
-
-// Send a pushover notification
-func sendPushoverNotification(c data.ConfigDB, runningTime int) error {
-
-	//	Get the config data
-	pushAPIkey, err := c.Get("pushoverapikey")
-	pushTo, err := c.Get("pushoverrecipient")
-	applianceName, err := c.Get("name")
-
-	//	If we have config data set...
-	if err == nil && pushTo.Value != "" {
-		//	Create a new client and push a message
-		pushClient := pushover.New(pushAPIkey.Value)
-		recipient := pushover.NewRecipient(pushTo.Value)
-		message := pushover.NewMessage(fmt.Sprintf("%s has finished running.  It ran for about %v minutes", applianceName.Value, runningTime))
-		message.Sound = "bike"
-		_, err := pushClient.SendMessage(message, recipient)
-		if err != nil {
-			return err
-		}
-	}
-
-	return err
-}
@@ -0,0 +1,75 @@
+package sensordata
+
+import (
+	"log"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// DefaultDevice returns the default settings for the monitor's own vibration sensor
+func DefaultDevice(id, name string) data.Device {
+	if name == "" {
+		name = "appliance-monitor"
+	}
+
+	return data.Device{
+		ID:                 id,
+		Type:               data.DeviceTypeAmon,
+		Name:               name,
+		MinimumMonitorTime: time.Duration(maxPoints) * sampleInterval,
+		Threshold:          int(applianceRunThreshold),
+	}
+}
+
+// loadDevices gets the stored devices to monitor.  If none have been set up,
+// the monitor's own sensor is used with the default settings
+func loadDevices(configDB *data.ConfigDB) []data.Device {
+	devices, err := configDB.GetAllDevices()
+	if err != nil {
+		log.Printf("[WARN] Problem getting devices: %v", err)
+	}
+
+	if len(devices) == 0 {
+		deviceID, _ := configDB.Get("deviceID")
+		appName, _ := configDB.Get("name")
+		log.Printf("[WARN] No devices found.  Using default settings for device %s", deviceID.Value)
+		devices = append(devices, DefaultDevice(deviceID.Value, appName.Value))
+	}
+
+	return devices
+}
+
+// windowSize gets the number of samples needed to cover the minimum monitor time for the device
+func windowSize(device data.Device) int {
+	points := int(device.MinimumMonitorTime / sampleInterval)
+	if points < 2 {
+		return maxPoints
+	}
+
+	return points
+}
+
+// resumeState gets the last known running state of the device, and when it started
+// running.  This lets a monitor pick up a cycle that was in progress when it restarted
+func resumeState(activityDB *data.ActivityDB, device data.Device) (bool, time.Time) {
+	latest, err := activityDB.GetLatestActivity(device.ID)
+	if err != nil || latest.Type != data.ApplianceRunning {
+		return false, time.Now()
+	}
+
+	return true, latest.Timestamp
+}
+
+// setDeviceRunning records the running state of the device
+func setDeviceRunning(configDB *data.ConfigDB, deviceID string, running bool) {
+	device, err := configDB.GetDevice(deviceID)
+	if err != nil || device.ID == "" {
+		return
+	}
+
+	device.Running = running
+	if _, err := configDB.AddOrUpdateDevice(device); err != nil {
+		log.Printf("[WARN] Problem updating device running state: %v", err)
+	}
+}
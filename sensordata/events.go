@@ -0,0 +1,173 @@
+package sensordata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/notify"
+)
+
+// deviceStarted records and announces that the device started running.
+// Returns the time it started
+func deviceStarted(configDB *data.ConfigDB, activityDB *data.ActivityDB, device data.Device) time.Time {
+	log.Printf("[DEBUG] Looks like %v is running", device.Name)
+
+	//	Track the activity:
+	newActivity := data.Activity{Type: data.ApplianceRunning, Timestamp: time.Now(), DeviceID: device.ID}
+	if _, err := activityDB.Add(newActivity); err != nil {
+		log.Printf("[WARN] Problem recording activity: %v\n", err)
+	}
+	WsHub.BroadcastActivity(device.Name, newActivity)
+	trackActivity(newActivity)
+	setDeviceRunning(configDB, device.ID, true)
+
+	//	Let anyone subscribed to starts know.  Notifications are sent in the
+	//	background, so a slow server doesn't hold up monitoring:
+	notify.Queue(configDB, data.ApplianceRunning, notify.Message{
+		DeviceID:   device.ID,
+		DeviceName: device.Name,
+		Text:       fmt.Sprintf("%s started running", device.Name),
+		Timestamp:  newActivity.Timestamp,
+	})
+
+	return newActivity.Timestamp
+}
+
+// deviceStopped records and announces that the device stopped running,
+// and records the cycle that began at timeStart.  Devices that measure
+// power pass the energy used during the cycle
+func deviceStopped(configDB *data.ConfigDB, activityDB *data.ActivityDB, device data.Device, timeStart time.Time, energyWh float64) {
+	log.Printf("[DEBUG] Looks like %v is stopped", device.Name)
+
+	//	Track the activity:
+	newActivity := data.Activity{Type: data.ApplianceStopped, Timestamp: time.Now(), DeviceID: device.ID}
+	if _, err := activityDB.Add(newActivity); err != nil {
+		log.Printf("[WARN] Problem recording activity: %v\n", err)
+	}
+	WsHub.BroadcastActivity(device.Name, newActivity)
+	trackActivity(newActivity)
+	setDeviceRunning(configDB, device.ID, false)
+
+	//	Calculate the run time:
+	runningTime := newActivity.Timestamp.Sub(timeStart)
+
+	//	If the device can't measure power, estimate the energy used:
+	if energyWh == 0 && device.EstimatedWatts > 0 {
+		energyWh = device.EstimatedWatts * runningTime.Hours()
+	}
+
+	//	Track the cycle, and what it cost:
+	tariff, err := configDB.GetTariff()
+	if err != nil {
+		log.Printf("[WARN] Problem getting tariff: %v\n", err)
+	}
+
+	cycle := data.Cycle{
+		DeviceID:  device.ID,
+		StartTime: timeStart,
+		EndTime:   newActivity.Timestamp,
+		EnergyWh:  energyWh,
+		Cost:      tariff.Cost(timeStart, newActivity.Timestamp, energyWh)}
+	if _, err := activityDB.AddCycle(cycle); err != nil {
+		log.Printf("[WARN] Problem recording cycle: %v\n", err)
+	}
+
+	//	Let everyone subscribed know:
+	notify.Queue(configDB, data.ApplianceStopped, notify.Message{
+		DeviceID:   device.ID,
+		DeviceName: device.Name,
+		Text:       notificationMessage(configDB, activityDB, device, cycle, tariff),
+		Timestamp:  newActivity.Timestamp,
+	})
+}
+
+// notificationData is the data available to notification templates
+type notificationData struct {
+	Name      string
+	Minutes   int
+	EnergyKWh float64
+	Cost      float64
+	DayCost   float64
+	MonthCost float64
+	Currency  string
+}
+
+// notificationMessage formats the message sent when a cycle finishes, using the
+// 'notificationtemplate' setting if there is one
+func notificationMessage(configDB *data.ConfigDB, activityDB *data.ActivityDB, device data.Device, cycle data.Cycle, tariff data.Tariff) string {
+	messageData := notificationData{
+		Name:      device.Name,
+		Minutes:   int(cycle.EndTime.Sub(cycle.StartTime).Minutes()),
+		EnergyKWh: cycle.EnergyWh / 1000,
+		Cost:      cycle.Cost,
+		Currency:  tariff.Currency,
+	}
+
+	//	Add up what the device cost today and this month:
+	end := cycle.EndTime
+	monthStart := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, end.Location())
+	dayStart := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location())
+	if cycles, err := activityDB.GetCycles(device.ID, monthStart, end); err == nil {
+		stats := data.Summarize(cycles, tariff)
+		messageData.MonthCost = stats.Total.Cost
+		for _, day := range stats.Days {
+			if day.Period == dayStart.Format("2006-01-02") {
+				messageData.DayCost = day.Cost
+			}
+		}
+	}
+
+	//	Use the configured template, if we can:
+	messageTemplate, _ := configDB.Get("notificationtemplate")
+	tmpl, err := template.New("notification").Parse(defaultNotificationTemplate)
+	if messageTemplate.Value != "" {
+		custom, err := template.New("notification").Parse(messageTemplate.Value)
+		if err != nil {
+			log.Printf("[WARN] Problem parsing notification template.  Using the default: %v\n", err)
+		} else {
+			tmpl = custom
+		}
+	}
+
+	var message bytes.Buffer
+	if err = tmpl.Execute(&message, messageData); err != nil {
+		log.Printf("[WARN] Problem formatting notification: %v\n", err)
+		return fmt.Sprintf("%s has finished running.  It ran for about %v minutes", messageData.Name, messageData.Minutes)
+	}
+
+	return message.String()
+}
+
+// Track the activity in the cloud
+func trackActivity(activity data.Activity) error {
+	url := "https://api.appliance-monitor.com/v1/activity"
+
+	//	Serialize to JSON
+	cloudActivity := data.CloudActivity{
+		DeviceID:  activity.DeviceID,
+		Timestamp: activity.Timestamp,
+		Type:      activity.Type}
+
+	jsonStr, err := json.Marshal(cloudActivity)
+	if err != nil {
+		log.Printf("[WARN] Problem marshalling cloud activity message: %v\n", err)
+	}
+
+	//	Create a request
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+
+	//	Set our headers
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	//	Execute the request
+	client := &http.Client{}
+	_, err = client.Do(req)
+
+	return err
+}
@@ -0,0 +1,49 @@
+package sensordata
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/danesparza/appliance-monitor/data"
+)
+
+// monitorFunc monitors a single device until the context is cancelled
+type monitorFunc func(ctx context.Context, device data.Device)
+
+// superviseMonitors starts a monitor for each stored device, using the monitor
+// for the device type.  The monitors are restarted when deviceUpdated is signaled
+func superviseMonitors(ctx context.Context, configDB *data.ConfigDB, deviceUpdated chan bool, monitors map[string]monitorFunc) {
+	for {
+		monitorCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+
+		for _, device := range loadDevices(configDB) {
+			monitor, ok := monitors[device.Type]
+			if !ok {
+				log.Printf("[WARN] Device %v (%v) has type %v, which can't be monitored on this platform", device.Name, device.ID, device.Type)
+				continue
+			}
+
+			log.Printf("[INFO] Monitoring device %v (%v)", device.Name, device.ID)
+
+			wg.Add(1)
+			go func(device data.Device) {
+				defer wg.Done()
+				monitor(monitorCtx, device)
+			}(device)
+		}
+
+		//	Wait until we're done or the devices change:
+		select {
+		case <-ctx.Done():
+			cancel()
+			wg.Wait()
+			return
+		case <-deviceUpdated:
+			log.Println("[INFO] Devices updated.  Restarting monitors...")
+			cancel()
+			wg.Wait()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package sensordata
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/danesparza/appliance-monitor/data"
+	"github.com/danesparza/appliance-monitor/hs110"
+)
+
+// powerDetector decides when a device is running from its power draw.  The device
+// starts running as soon as it draws more than the threshold, and stops once it
+// has stayed under the threshold for a full window of samples
+type powerDetector struct {
+	threshold float64
+	size      int
+	window    []float64
+	running   bool
+}
+
+// add adds a power sample, in watts.  Returns true if the running state changed
+func (d *powerDetector) add(watts float64) bool {
+	d.window = append(d.window, watts)
+	if len(d.window) > d.size {
+		d.window = d.window[len(d.window)-d.size:]
+	}
+
+	if !d.running && watts > d.threshold {
+		d.running = true
+		return true
+	}
+
+	if d.running && len(d.window) >= d.size && maxValue(d.window) <= d.threshold {
+		d.running = false
+		return true
+	}
+
+	return false
+}
+
+// monitorPower polls a smart plug for the device's power draw and tracks when it starts and stops
+func monitorPower(ctx context.Context, configDB *data.ConfigDB, activityDB *data.ActivityDB, device data.Device) {
+	plug := hs110.Client{Address: device.IPAddress}
+
+	detector := &powerDetector{
+		threshold: float64(device.Threshold),
+		size:      windowSize(device),
+	}
+	log.Printf("[INFO] Monitoring %v at %v using %v samples with threshold %v watts", device.Name, device.IPAddress, detector.size, detector.threshold)
+
+	//	Keep track of state of device
+	var timeStart time.Time
+	detector.running, timeStart = resumeState(activityDB, device)
+
+	//	Keep track of the energy used in the current cycle
+	energyWh := float64(0)
+	lastSample := time.Now()
+
+	//	Loop and respond to channels:
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sampleInterval):
+			reading, err := plug.GetRealtime()
+			if err != nil {
+				log.Printf("[WARN] Problem reading power for %v: %v", device.Name, err)
+				continue
+			}
+
+			//	Add up the energy used since the last sample:
+			now := time.Now()
+			if detector.running {
+				energyWh += reading.Power * now.Sub(lastSample).Hours()
+			}
+			lastSample = now
+
+			if !detector.add(reading.Power) {
+				continue
+			}
+
+			/*********************************
+				EVENT: MACHINE STARTED
+			**********************************/
+			if detector.running {
+				timeStart = deviceStarted(configDB, activityDB, device)
+				energyWh = 0
+				continue
+			}
+
+			/*********************************
+				EVENT: MACHINE STOPPED
+			**********************************/
+			deviceStopped(configDB, activityDB, device, timeStart, energyWh)
+		}
+	}
+}
+
+// maxValue gets the largest value in the slice
+func maxValue(values []float64) float64 {
+	retval := float64(0)
+	for i, v := range values {
+		if i == 0 || v > retval {
+			retval = v
+		}
+	}
+
+	return retval
+}
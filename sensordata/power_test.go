@@ -0,0 +1,42 @@
+package sensordata
+
+import "testing"
+
+func TestPowerDetector_Add_StartsAndStops(t *testing.T) {
+	//	Arrange
+	tests := []struct {
+		name    string
+		samples []float64
+		changes []bool
+		running bool
+	}{
+		{"Stays off under the threshold", []float64{0, 5, 10, 10}, []bool{false, false, false, false}, false},
+		{"Starts as soon as it's over the threshold", []float64{0, 11}, []bool{false, true}, true},
+		{"Keeps running through a short dip", []float64{50, 2, 2, 50}, []bool{true, false, false, false}, true},
+		{"Stops after a full window under the threshold", []float64{50, 2, 2, 2}, []bool{true, false, false, true}, false},
+		{"The threshold itself counts as off", []float64{10, 50, 10, 10, 10}, []bool{false, true, false, false, true}, false},
+		{"Starts again after stopping", []float64{50, 0, 0, 0, 50}, []bool{true, false, false, true, true}, true},
+	}
+
+	for _, test := range tests {
+		detector := &powerDetector{threshold: 10, size: 3}
+
+		//	Act
+		changes := []bool{}
+		for _, watts := range test.samples {
+			changes = append(changes, detector.add(watts))
+		}
+
+		//	Assert
+		for i := range test.changes {
+			if changes[i] != test.changes[i] {
+				t.Errorf("%s: Sample %v should have changed the state: %v.  Got %v", test.name, i+1, test.changes[i], changes)
+				break
+			}
+		}
+
+		if detector.running != test.running {
+			t.Errorf("%s: Should have ended up running: %v", test.name, test.running)
+		}
+	}
+}
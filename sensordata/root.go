@@ -1,6 +1,10 @@
 package sensordata
 
-import "github.com/danesparza/appliance-monitor/api"
+import (
+	"time"
+
+	"github.com/danesparza/appliance-monitor/api"
+)
 
 var (
 	// WsHub is the websocket hub for sensor data updates
@@ -8,4 +12,12 @@ var (
 
 	maxPoints             = 120
 	applianceRunThreshold = float64(8)
+	sampleInterval        = 1 * time.Second
+
+	//	The longest to wait between reads while a sensor is failing
+	maxReadBackoff = 1 * time.Minute
+
+	//	The message sent when a cycle finishes, if the 'notificationtemplate' setting isn't set
+	defaultNotificationTemplate = `{{.Name}} has finished running.  It ran for about {{.Minutes}} minutes` +
+		`{{if .Cost}} and cost about {{.Currency}}{{printf "%.2f" .Cost}} ({{.Currency}}{{printf "%.2f" .MonthCost}} this month){{end}}`
 )
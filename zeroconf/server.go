@@ -8,17 +8,12 @@ import (
 
 	"github.com/danesparza/appliance-monitor/data"
 	"github.com/grandcat/zeroconf"
-	"github.com/spf13/viper"
 )
 
 // Serve starts the zeroconf service and registers this server
-func Serve(ctx context.Context, restart chan bool) {
+func Serve(ctx context.Context, configDB *data.ConfigDB, restart chan bool) {
 	log.Println("[INFO] Starting the zeroconf service...")
 
-	//	Get a reference to the config database
-	configDB := data.ConfigDB{
-		Database: viper.GetString("datastore.config")}
-
 	//	Get the configured appliance name
 	appName, err := configDB.Get("name")
 	if err != nil {